@@ -0,0 +1,111 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"gopkg.in/gorp.v1"
+)
+
+// SetAtomic makes Exec, ExecMax and ExecTo (and their patch mode versions)
+// run all planned migrations in a single transaction. See
+// MigrationSet.Atomic.
+func SetAtomic(v bool) {
+	migSet.Atomic = v
+}
+
+// atomicTx is the transaction all migrations run in when Atomic is set. Each
+// migration runs in a savepoint of it.
+type atomicTx struct {
+	tx         *sql.Tx
+	dialect    gorp.Dialect
+	savepoints int
+}
+
+// checkAtomic returns an error when the migrations can't run in a single
+// transaction on dialect.
+func checkAtomic(dialect gorp.Dialect, notransaction string) error {
+	if !transactionalDDL(dialect) {
+		return fmt.Errorf("Cannot run migrations atomically: DDL statements are not transactional on this database")
+	}
+	if notransaction != "" {
+		return newPlanError(notransaction, "notransaction migrations cannot run atomically")
+	}
+	return nil
+}
+
+// transactionalDDL reports whether DDL statements can be rolled back on
+// dialect, rather than committing the transaction they run in.
+func transactionalDDL(dialect gorp.Dialect) bool {
+	switch dialect.(type) {
+	case gorp.MySQLDialect, OracleDialect:
+		return false
+	}
+	return true
+}
+
+// runAtomically runs apply in a single transaction, which is committed when
+// all migrations were applied and rolled back otherwise.
+func (ms MigrationSet) runAtomically(ctx context.Context, db *sql.DB, dialect gorp.Dialect,
+	apply func(ms MigrationSet) (int, error)) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	ms.atomic = &atomicTx{tx: tx, dialect: dialect}
+	applied, err := apply(ms)
+	if err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			ms.log(LogError, "Rollback failed", "error", rbErr)
+		} else {
+			ms.log(LogInfo, "Rolled back all migrations", "migrations", applied)
+		}
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	ms.log(LogDebug, "Committed transaction", "migrations", applied)
+	return applied, nil
+}
+
+// savepoint runs fn for the named migration in a new savepoint, which is
+// rolled back when fn fails.
+func (a *atomicTx) savepoint(ctx context.Context, ms MigrationSet, name string, fn func(SqlExecutorContext) error) error {
+	a.savepoints++
+	savepoint := fmt.Sprintf("sql_migrate_%d", a.savepoints)
+	create, release, rollback := savepointQueries(a.dialect, savepoint)
+
+	if _, err := a.tx.ExecContext(ctx, create); err != nil {
+		return err
+	}
+
+	if err := fn(a.tx); err != nil {
+		if _, rbErr := a.tx.ExecContext(context.Background(), rollback); rbErr != nil {
+			ms.log(LogError, "Rollback to savepoint failed", "migration", name, "error", rbErr)
+		} else {
+			ms.log(LogDebug, "Rolled back to savepoint", "migration", name)
+		}
+		return err
+	}
+
+	if release != "" {
+		if _, err := a.tx.ExecContext(ctx, release); err != nil {
+			return err
+		}
+	}
+	ms.log(LogDebug, "Released savepoint", "migration", name)
+	return nil
+}
+
+// savepointQueries returns the statements that create, release and roll back
+// to a savepoint. SQL Server has no way to release one.
+func savepointQueries(dialect gorp.Dialect, name string) (string, string, string) {
+	if _, ok := dialect.(gorp.SqlServerDialect); ok {
+		return "SAVE TRANSACTION " + name, "", "ROLLBACK TRANSACTION " + name
+	}
+	return "SAVEPOINT " + name, "RELEASE SAVEPOINT " + name, "ROLLBACK TO SAVEPOINT " + name
+}
@@ -0,0 +1,113 @@
+package migrate
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+var atomicMigrations = []*Migration{
+	{
+		Id:   "1_people.sql",
+		Up:   []string{"CREATE TABLE people (id int)"},
+		Down: []string{"DROP TABLE people"},
+	},
+	{
+		Id:   "2_pets.sql",
+		Up:   []string{"CREATE TABLE pets (id int)"},
+		Down: []string{"DROP TABLE pets"},
+	},
+	{
+		Id:   "3_broken.sql",
+		Up:   []string{"CREATE TABLE toys (id int)", "ALTER TABLE nothing ADD COLUMN name text"},
+		Down: []string{"DROP TABLE toys"},
+	},
+}
+
+func (s *SqliteMigrateSuite) TestAtomicRollsBackAll(c *C) {
+	migrations := &MemoryMigrationSource{Migrations: atomicMigrations}
+
+	ms := MigrationSet{Atomic: true}
+	n, err := ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, FitsTypeOf, &TxError{})
+	c.Assert(err.(*TxError).MigrationName, Equals, "3_broken.sql")
+	c.Assert(n, Equals, 0)
+
+	records, err := ms.GetMigrationRecords(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 0)
+	for _, table := range []string{"people", "pets", "toys"} {
+		_, err = s.Db.Exec("SELECT * FROM " + table)
+		c.Assert(err, NotNil)
+	}
+}
+
+func (s *SqliteMigrateSuite) TestAtomicCommitsAll(c *C) {
+	migrations := &MemoryMigrationSource{Migrations: atomicMigrations[:2]}
+
+	ms := MigrationSet{Atomic: true}
+	n, err := ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+
+	records, err := ms.GetMigrationRecords(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 2)
+	_, err = s.Db.Exec("SELECT * FROM pets")
+	c.Assert(err, IsNil)
+
+	n, err = ms.ExecMax(s.Db, "sqlite3", migrations, Down, 0)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+	_, err = s.Db.Exec("SELECT * FROM people")
+	c.Assert(err, NotNil)
+}
+
+func (s *SqliteMigrateSuite) TestAtomicRefusesNoTransaction(c *C) {
+	migrations := &MemoryMigrationSource{
+		Migrations: []*Migration{
+			atomicMigrations[0],
+			{
+				Id:                   "2_index.sql",
+				Up:                   []string{"CREATE INDEX people_id ON people (id)"},
+				Down:                 []string{"DROP INDEX people_id"},
+				DisableTransactionUp: true,
+			},
+		},
+	}
+
+	ms := MigrationSet{Atomic: true}
+	n, err := ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, FitsTypeOf, &PlanError{})
+	c.Assert(err.(*PlanError).MigrationName, Equals, "2_index.sql")
+	c.Assert(n, Equals, 0)
+
+	_, err = s.Db.Exec("SELECT * FROM people")
+	c.Assert(err, NotNil)
+}
+
+func (s *SqliteMigrateSuite) TestAtomicPatch(c *C) {
+	migrations := &MemoryMigrationSource{
+		MigrationsPatch: []*MigrationPatch{
+			{
+				Name: "0001_00_people.sql",
+				Up:   []string{"CREATE TABLE people (id int)"},
+				Down: []string{"DROP TABLE people"},
+			},
+			{
+				Name: "0001_01_broken.sql",
+				Up:   []string{"ALTER TABLE nothing ADD COLUMN name text"},
+				Down: []string{"SELECT 0"},
+			},
+		},
+	}
+
+	ms := MigrationSet{EnablePatchMode: true, Atomic: true}
+	n, err := ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, FitsTypeOf, &TxError{})
+	c.Assert(n, Equals, 0)
+
+	records, err := ms.GetMigrationPatchRecords(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 0)
+	_, err = s.Db.Exec("SELECT * FROM people")
+	c.Assert(err, NotNil)
+}
@@ -0,0 +1,169 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"gopkg.in/gorp.v1"
+)
+
+// Baseline an existing database
+//
+// Records every migration up to and including target as applied without
+// running it, to adopt sql-migrate on a database whose schema was created
+// before. Migrations that are already applied are left alone, and tags are
+// not taken into account.
+//
+// Returns the number of recorded migrations.
+func Baseline(db *sql.DB, dialect string, m MigrationSource, target string) (int, error) {
+	return migSet.Baseline(db, dialect, m, target)
+}
+
+// Baseline an existing database with a context
+//
+// Returns the number of recorded migrations.
+func BaselineContext(ctx context.Context, db *sql.DB, dialect string, m MigrationSource, target string) (int, error) {
+	return migSet.BaselineContext(ctx, db, dialect, m, target)
+}
+
+// Returns the number of recorded migrations.
+func (ms MigrationSet) Baseline(db *sql.DB, dialect string, m MigrationSource, target string) (int, error) {
+	return ms.BaselineContext(context.Background(), db, dialect, m, target)
+}
+
+// Returns the number of recorded migrations.
+func (ms MigrationSet) BaselineContext(ctx context.Context, db *sql.DB, dialect string, m MigrationSource, target string) (int, error) {
+	if ms.EnablePatchMode {
+		return ms.BaselinePatchContext(ctx, db, dialect, m, target)
+	}
+
+	lock, err := ms.lockIfEnabled(ctx, db, dialect)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = lock.Unlock() }()
+
+	migrations, dbMap, err := ms.PlanBaselineContext(ctx, db, dialect, m, target)
+	if err != nil {
+		return 0, err
+	}
+
+	err = ms.withExecutor(ctx, db, target, false, func(executor SqlExecutorContext) error {
+		for _, migration := range migrations {
+			if err := ms.insertRecord(ctx, executor, dbMap, ms.newRecord(migration.Migration, 0)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, newTxError(target, err)
+	}
+
+	ms.log(LogInfo, "Baselined migrations", "target", target, "count", len(migrations))
+	return len(migrations), nil
+}
+
+// Plan a baseline of an existing database.
+func PlanBaseline(db *sql.DB, dialect string, m MigrationSource, target string) ([]*PlannedMigration, *gorp.DbMap, error) {
+	return migSet.PlanBaseline(db, dialect, m, target)
+}
+
+// Plan a baseline of an existing database with a context.
+func PlanBaselineContext(ctx context.Context, db *sql.DB, dialect string, m MigrationSource, target string) ([]*PlannedMigration, *gorp.DbMap, error) {
+	return migSet.PlanBaselineContext(ctx, db, dialect, m, target)
+}
+
+func (ms MigrationSet) PlanBaseline(db *sql.DB, dialect string, m MigrationSource, target string) ([]*PlannedMigration, *gorp.DbMap, error) {
+	return ms.PlanBaselineContext(context.Background(), db, dialect, m, target)
+}
+
+// PlanBaselineContext returns the unapplied migrations up to and including
+// target, which Baseline records as applied. Nothing is planned when target
+// has been applied already.
+func (ms MigrationSet) PlanBaselineContext(ctx context.Context, db *sql.DB, dialect string, m MigrationSource,
+	target string) ([]*PlannedMigration, *gorp.DbMap, error) {
+	ms.Tags = TagFilter{}
+	migrations, dir, dbMap, err := ms.PlanToContext(ctx, db, dialect, m, target)
+	if err != nil {
+		return nil, nil, err
+	}
+	if dir != Up {
+		return []*PlannedMigration{}, dbMap, nil
+	}
+	return migrations, dbMap, nil
+}
+
+// Returns the number of recorded migrations.
+func (ms MigrationSet) BaselinePatch(db *sql.DB, dialect string, m MigrationSource, target string) (int, error) {
+	return ms.BaselinePatchContext(context.Background(), db, dialect, m, target)
+}
+
+// BaselinePatchContext is BaselineContext for patch mode. Every version up to
+// the one of target is recorded at its last patch, and the version of target
+// at the patch of target.
+//
+// Returns the number of recorded migrations.
+func (ms MigrationSet) BaselinePatchContext(ctx context.Context, db *sql.DB, dialect string, m MigrationSource, target string) (int, error) {
+	lock, err := ms.lockIfEnabled(ctx, db, dialect)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = lock.Unlock() }()
+
+	migrations, dbMap, err := ms.PlanBaselinePatchContext(ctx, db, dialect, m, target)
+	if err != nil {
+		return 0, err
+	}
+
+	err = ms.withExecutor(ctx, db, target, false, func(executor SqlExecutorContext) error {
+		now := time.Now()
+		for i, migration := range migrations {
+			// The record of a version holds its last applied patch.
+			if i+1 < len(migrations) && migrations[i+1].VerInt == migration.VerInt {
+				continue
+			}
+			if err := ms.upsertPatchRecord(ctx, executor, dbMap, migration.MigrationPatch, now, 0); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, newTxError(target, err)
+	}
+
+	ms.log(LogInfo, "Baselined migrations", "target", target, "count", len(migrations))
+	return len(migrations), nil
+}
+
+// Plan a baseline of an existing database in patch mode.
+func PlanBaselinePatch(db *sql.DB, dialect string, m MigrationSource, target string) ([]*PlannedMigrationPatch, *gorp.DbMap, error) {
+	return migSet.PlanBaselinePatch(db, dialect, m, target)
+}
+
+// Plan a baseline of an existing database in patch mode with a context.
+func PlanBaselinePatchContext(ctx context.Context, db *sql.DB, dialect string, m MigrationSource,
+	target string) ([]*PlannedMigrationPatch, *gorp.DbMap, error) {
+	return migSet.PlanBaselinePatchContext(ctx, db, dialect, m, target)
+}
+
+func (ms MigrationSet) PlanBaselinePatch(db *sql.DB, dialect string, m MigrationSource, target string) ([]*PlannedMigrationPatch, *gorp.DbMap, error) {
+	return ms.PlanBaselinePatchContext(context.Background(), db, dialect, m, target)
+}
+
+// PlanBaselinePatchContext is PlanBaselineContext for patch mode. The target
+// is given as accepted by PlanToPatch.
+func (ms MigrationSet) PlanBaselinePatchContext(ctx context.Context, db *sql.DB, dialect string, m MigrationSource,
+	target string) ([]*PlannedMigrationPatch, *gorp.DbMap, error) {
+	ms.Tags = TagFilter{}
+	migrations, dir, dbMap, err := ms.PlanToPatchContext(ctx, db, dialect, m, target)
+	if err != nil {
+		return nil, nil, err
+	}
+	if dir != Up {
+		return []*PlannedMigrationPatch{}, dbMap, nil
+	}
+	return migrations, dbMap, nil
+}
@@ -0,0 +1,93 @@
+package migrate
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+func (s *SqliteMigrateSuite) TestBaseline(c *C) {
+	migrations := &MemoryMigrationSource{
+		Migrations: []*Migration{
+			sqliteMigrations[0],
+			sqliteMigrations[1],
+			&Migration{
+				Id:   "125",
+				Up:   []string{"CREATE TABLE pets (id int)"},
+				Down: []string{"DROP TABLE pets"},
+			},
+		},
+	}
+
+	ms := MigrationSet{}
+
+	planned, _, err := ms.PlanBaseline(s.Db, "sqlite3", migrations, "124")
+	c.Assert(err, IsNil)
+	c.Assert(planned, HasLen, 2)
+	c.Assert(planned[0].Id, Equals, "123")
+	c.Assert(planned[1].Id, Equals, "124")
+
+	n, err := ms.Baseline(s.Db, "sqlite3", migrations, "124")
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+
+	// Nothing was run
+	_, err = s.DbMap.Exec("SELECT * FROM people")
+	c.Assert(err, Not(IsNil))
+
+	records, err := ms.GetMigrationRecords(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 2)
+	c.Assert(records[0].Id, Equals, "123")
+	c.Assert(records[1].Id, Equals, "124")
+
+	// Already there
+	n, err = ms.Baseline(s.Db, "sqlite3", migrations, "123")
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 0)
+
+	// The migrations after the baseline run as usual
+	n, err = ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+	_, err = s.DbMap.Exec("SELECT * FROM pets")
+	c.Assert(err, IsNil)
+
+	_, err = ms.Baseline(s.Db, "sqlite3", migrations, "999")
+	c.Assert(err, FitsTypeOf, &PlanError{})
+}
+
+func (s *SqliteMigrateSuite) TestBaselinePatch(c *C) {
+	migrations := &MemoryMigrationSource{
+		MigrationsPatch: []*MigrationPatch{
+			{Name: "0001_00_initial.sql", Up: []string{"CREATE TABLE people (id int)"}, Down: []string{"DROP TABLE people"}},
+			{Name: "0001_01_patch.sql", Up: []string{"ALTER TABLE people ADD COLUMN age int"}, Down: []string{}},
+			{Name: "0002_00_second.sql", Up: []string{"CREATE TABLE balance (id int)"}, Down: []string{"DROP TABLE balance"}},
+			{Name: "0002_01_patch.sql", Up: []string{"CREATE TABLE users (id int)"}, Down: []string{"DROP TABLE users"}},
+		},
+	}
+
+	ms := MigrationSet{EnablePatchMode: true}
+
+	planned, _, err := ms.PlanBaselinePatch(s.Db, "sqlite3", migrations, "0002_00")
+	c.Assert(err, IsNil)
+	c.Assert(planned, HasLen, 3)
+
+	n, err := ms.Baseline(s.Db, "sqlite3", migrations, "0002_00")
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 3)
+
+	records, err := ms.GetMigrationPatchRecords(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 2)
+	c.Assert(records[0].Ver, Equals, "0001")
+	c.Assert(records[0].Patch, Equals, "01")
+	c.Assert(records[1].Ver, Equals, "0002")
+	c.Assert(records[1].Patch, Equals, "00")
+
+	n, err = ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+	_, err = s.DbMap.Exec("SELECT * FROM users")
+	c.Assert(err, IsNil)
+	_, err = s.DbMap.Exec("SELECT * FROM people")
+	c.Assert(err, Not(IsNil))
+}
@@ -0,0 +1,69 @@
+package migrate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// ChecksumError is returned when planning a migration if a migration that has
+// already been applied no longer matches the checksum recorded when it was
+// applied: its file was edited afterwards.
+type ChecksumError struct {
+	MigrationName string
+	Applied       string
+	Current       string
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("Migration %s was changed after it was applied (checksum was %s, now %s)",
+		e.MigrationName, e.Applied, e.Current)
+}
+
+// SetWarnOnChecksumMismatch makes planning only warn about applied migrations
+// whose checksum changed, instead of failing with a *ChecksumError.
+func SetWarnOnChecksumMismatch(v bool) {
+	migSet.WarnOnChecksumMismatch = v
+}
+
+// Checksum returns a checksum of the Up and Down statements of the migration.
+func (m Migration) Checksum() string {
+	return checksum(m.Up, m.Down)
+}
+
+// Checksum returns a checksum of the Up and Down statements of the migration.
+func (m MigrationPatch) Checksum() string {
+	return checksum(m.Up, m.Down)
+}
+
+func checksum(up, down []string) string {
+	h := sha256.New()
+	for _, statements := range [][]string{up, down} {
+		_, _ = fmt.Fprintf(h, "%d\n", len(statements))
+		for _, stmt := range statements {
+			_, _ = fmt.Fprintf(h, "%d\n%s", len(stmt), stmt)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// verifyChecksum compares the checksum stored when a migration was applied
+// with its current one. Records from before checksums were stored have none
+// and are not verified.
+func (ms MigrationSet) verifyChecksum(name, applied, current string) error {
+	if applied == "" || applied == current {
+		return nil
+	}
+
+	err := &ChecksumError{
+		MigrationName: name,
+		Applied:       applied,
+		Current:       current,
+	}
+	if ms.WarnOnChecksumMismatch {
+		ms.log(LogWarn, "Migration was changed after it was applied", "migration", name,
+			"applied_checksum", applied, "current_checksum", current)
+		return nil
+	}
+	return err
+}
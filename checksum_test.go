@@ -0,0 +1,119 @@
+package migrate
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *SqliteMigrateSuite) TestChecksumStored(c *C) {
+	migrations := &MemoryMigrationSource{
+		Migrations: sqliteMigrations[:1],
+	}
+
+	ms := MigrationSet{}
+	n, err := ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+
+	records, err := ms.GetMigrationRecords(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 1)
+	c.Assert(records[0].Checksum, Equals, sqliteMigrations[0].Checksum())
+	c.Assert(records[0].Checksum, HasLen, 64)
+}
+
+func (s *SqliteMigrateSuite) TestChecksumMismatch(c *C) {
+	migrations := &MemoryMigrationSource{
+		Migrations: sqliteMigrations[:1],
+	}
+
+	ms := MigrationSet{}
+	_, err := ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+
+	// Edit the applied migration
+	migrations = &MemoryMigrationSource{
+		Migrations: []*Migration{
+			&Migration{
+				Id:   "123",
+				Up:   []string{"CREATE TABLE people (id int, name text)"},
+				Down: []string{"DROP TABLE people"},
+			},
+		},
+	}
+
+	_, _, err = ms.PlanMigration(s.Db, "sqlite3", migrations, Up, 0)
+	c.Assert(err, FitsTypeOf, &ChecksumError{})
+	c.Assert(err.(*ChecksumError).MigrationName, Equals, "123")
+	c.Assert(err.(*ChecksumError).Applied, Equals, sqliteMigrations[0].Checksum())
+
+	n, err := ms.Exec(s.Db, "sqlite3", migrations, Down)
+	c.Assert(err, FitsTypeOf, &ChecksumError{})
+	c.Assert(n, Equals, 0)
+
+	ms.WarnOnChecksumMismatch = true
+	planned, _, err := ms.PlanMigration(s.Db, "sqlite3", migrations, Down, 0)
+	c.Assert(err, IsNil)
+	c.Assert(planned, HasLen, 1)
+}
+
+func (s *SqliteMigrateSuite) TestChecksumUpgradesTable(c *C) {
+	// Table layout of older versions, with a migration applied
+	_, err := s.Db.Exec(`CREATE TABLE gorp_migrations (id varchar(255) not null primary key, applied_at datetime)`)
+	c.Assert(err, IsNil)
+	_, err = s.Db.Exec(`INSERT INTO gorp_migrations (id, applied_at) VALUES (?, ?)`, "123", time.Now())
+	c.Assert(err, IsNil)
+	_, err = s.Db.Exec(`CREATE TABLE people (id int)`)
+	c.Assert(err, IsNil)
+
+	migrations := &MemoryMigrationSource{
+		Migrations: sqliteMigrations[:2],
+	}
+
+	ms := MigrationSet{}
+	n, err := ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+
+	records, err := ms.GetMigrationRecords(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 2)
+	c.Assert(records[0].Checksum, Equals, "")
+	c.Assert(records[1].Checksum, Equals, sqliteMigrations[1].Checksum())
+}
+
+func (s *SqliteMigrateSuite) TestChecksumMismatchPatch(c *C) {
+	migrations := &MemoryMigrationSource{
+		MigrationsPatch: []*MigrationPatch{
+			{
+				Name: "0001_00_initial.sql",
+				Up:   []string{"CREATE TABLE people (id int)"},
+				Down: []string{"DROP TABLE people"},
+			},
+		},
+	}
+
+	ms := MigrationSet{EnablePatchMode: true}
+	_, err := ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+
+	records, err := ms.GetMigrationPatchRecords(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 1)
+	c.Assert(records[0].Checksum, Equals, migrations.MigrationsPatch[0].Checksum())
+
+	migrations.MigrationsPatch[0] = &MigrationPatch{
+		Name: "0001_00_initial.sql",
+		Up:   []string{"CREATE TABLE people (id int, name text)"},
+		Down: []string{"DROP TABLE people"},
+	}
+
+	_, _, err = ms.PlanMigrationPatch(s.Db, "sqlite3", migrations, Up, 0)
+	c.Assert(err, FitsTypeOf, &ChecksumError{})
+	c.Assert(err.(*ChecksumError).MigrationName, Equals, "0001_00_initial.sql")
+
+	ms.WarnOnChecksumMismatch = true
+	_, _, err = ms.PlanMigrationPatch(s.Db, "sqlite3", migrations, Up, 0)
+	c.Assert(err, IsNil)
+}
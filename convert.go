@@ -0,0 +1,526 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/gorp.v1"
+)
+
+// Conversion describes how a migration is renamed when its migration table is
+// converted to patch mode.
+type Conversion struct {
+	// Id of the migration in the legacy table, e.g. 1_initial.sql.
+	Id string
+	// Name of the migration in patch mode, e.g. 0001_00_initial.sql.
+	Name string
+	// Applied is set when the migration has a record in the migration table.
+	Applied bool
+}
+
+// conversionRecord remembers the legacy Id of a converted migration, so that
+// the conversion can be reverted.
+type conversionRecord struct {
+	Id   string `db:"id"`
+	Name string `db:"name"`
+}
+
+var conversionRecordColumns = []string{"id", "name"}
+
+var conversionNameRegex = regexp.MustCompile(`^\d+[_-]?(.*)$`)
+
+// Plan the conversion of the migration table to patch mode
+//
+// Every migration found in m becomes version 1, 2, ... of the patch mode
+// naming, in the order they are applied, each with patch 00. Nothing is
+// changed.
+func PlanConversion(db *sql.DB, dialect string, m MigrationSource) ([]*Conversion, error) {
+	return migSet.PlanConversion(db, dialect, m)
+}
+
+// Plan the conversion of the migration table to patch mode with a context
+func PlanConversionContext(ctx context.Context, db *sql.DB, dialect string, m MigrationSource) ([]*Conversion, error) {
+	return migSet.PlanConversionContext(ctx, db, dialect, m)
+}
+
+func (ms MigrationSet) PlanConversion(db *sql.DB, dialect string, m MigrationSource) ([]*Conversion, error) {
+	return ms.PlanConversionContext(context.Background(), db, dialect, m)
+}
+
+func (ms MigrationSet) PlanConversionContext(ctx context.Context, db *sql.DB, dialect string, m MigrationSource) ([]*Conversion, error) {
+	conversions, _, err := ms.planConversion(ctx, db, dialect, m)
+	return conversions, err
+}
+
+func (ms MigrationSet) planConversion(ctx context.Context, db *sql.DB, dialect string, m MigrationSource) ([]*Conversion, []*MigrationRecord, error) {
+	ms.EnablePatchMode = false
+	dbMap, err := ms.getMigrationDbMap(ctx, db, dialect)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	columns, err := tableColumns(ctx, db, ms.quotedTable(dbMap))
+	if err != nil {
+		return nil, nil, err
+	}
+	if !columns["id"] {
+		return nil, nil, fmt.Errorf("Migration table %s is not in the legacy layout", ms.getTableName())
+	}
+
+	migrations, err := ms.findMigrations(m, dialect)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	records, err := ms.selectRecords(ctx, db, dbMap)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	applied := make(map[string]bool)
+	for _, record := range records {
+		applied[record.Id] = true
+	}
+
+	width := len(strconv.Itoa(len(migrations)))
+	if width < 4 {
+		width = 4
+	}
+
+	conversions := make([]*Conversion, 0, len(migrations))
+	for i, migration := range migrations {
+		conversions = append(conversions, &Conversion{
+			Id:      migration.Id,
+			Name:    conversionName(i+1, width, migration.Id),
+			Applied: applied[migration.Id],
+		})
+		delete(applied, migration.Id)
+	}
+
+	for _, record := range records {
+		if applied[record.Id] {
+			return nil, nil, newPlanError(record.Id, "unknown migration in database")
+		}
+	}
+
+	return conversions, records, nil
+}
+
+// conversionName returns the patch mode name of the migration with id, at
+// version ver.
+func conversionName(ver, width int, id string) string {
+	name := id
+	if match := conversionNameRegex.FindStringSubmatch(id); match != nil && match[1] != "" && !strings.HasPrefix(match[1], ".") {
+		name = match[1]
+	}
+	return fmt.Sprintf("%0*d_00_%s", width, ver, name)
+}
+
+// Convert the migration table to patch mode
+//
+// The records of the migrations found in m are moved to a patch mode table of
+// the same name, as planned by PlanConversion. The legacy records are kept in
+// the <table>_legacy table and the original names in <table>_conversion, so
+// that RevertConversion can undo it. Renaming the migrations themselves is
+// left to the caller.
+//
+// On databases with transactional DDL the conversion runs in a single
+// transaction. Elsewhere the patch mode records are written to a new table
+// first, and the legacy table is only replaced by it once all of them are.
+func ConvertToPatch(db *sql.DB, dialect string, m MigrationSource) ([]*Conversion, error) {
+	return migSet.ConvertToPatch(db, dialect, m)
+}
+
+// Convert the migration table to patch mode with a context
+func ConvertToPatchContext(ctx context.Context, db *sql.DB, dialect string, m MigrationSource) ([]*Conversion, error) {
+	return migSet.ConvertToPatchContext(ctx, db, dialect, m)
+}
+
+func (ms MigrationSet) ConvertToPatch(db *sql.DB, dialect string, m MigrationSource) ([]*Conversion, error) {
+	return ms.ConvertToPatchContext(context.Background(), db, dialect, m)
+}
+
+func (ms MigrationSet) ConvertToPatchContext(ctx context.Context, db *sql.DB, dialect string, m MigrationSource) ([]*Conversion, error) {
+	lock, err := ms.lockIfEnabled(ctx, db, dialect)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = lock.Unlock() }()
+
+	legacy, backup, patch := ms.conversionSets()
+
+	conversions, records, err := legacy.planConversion(ctx, db, dialect, m)
+	if err != nil {
+		return nil, err
+	}
+
+	conversionMap := ms.conversionDbMap(db, dialect)
+	if _, err := tableColumns(ctx, db, ms.quotedConversionTable(conversionMap)); err == nil {
+		return nil, fmt.Errorf("Migration table %s was converted before, revert that conversion first", ms.getTableName())
+	}
+
+	// The patch mode records are written to a staging table, which takes the
+	// place of the legacy table once all of them are.
+	staging := patch
+	staging.TableName = ms.getTableName() + "_patch"
+	d := conversionMap.Dialect
+	exists, err := tableExists(ctx, db, d, ms.SchemaName, staging.getTableName())
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, fmt.Errorf("Migration table %s exists, drop it before converting", staging.getTableName())
+	}
+	backupExists, err := tableExists(ctx, db, d, ms.SchemaName, backup.getTableName())
+	if err != nil {
+		return nil, err
+	}
+
+	// gorp can't create tables in a transaction, so they are created up
+	// front and dropped again when the conversion fails.
+	created := []string{ms.quotedConversionTable(conversionMap), d.QuotedTableForQuery(ms.SchemaName, staging.getTableName())}
+	if !backupExists {
+		created = append(created, d.QuotedTableForQuery(ms.SchemaName, backup.getTableName()))
+	}
+	fail := func(err error) ([]*Conversion, error) {
+		for _, table := range created {
+			if _, dropErr := tableColumns(context.Background(), db, table); dropErr != nil {
+				continue
+			}
+			if dropErr := dropTable(context.Background(), db, table); dropErr != nil {
+				ms.log(LogError, "Dropping table failed", "table", table, "error", dropErr)
+			}
+		}
+		return nil, err
+	}
+
+	if err := createTables(conversionMap); err != nil {
+		return fail(err)
+	}
+	backupMap, err := backup.getMigrationDbMap(ctx, db, dialect)
+	if err != nil {
+		return fail(err)
+	}
+	stagingMap, err := staging.getMigrationDbMap(ctx, db, dialect)
+	if err != nil {
+		return fail(err)
+	}
+
+	recordsById := make(map[string]*MigrationRecord)
+	for _, record := range records {
+		recordsById[record.Id] = record
+	}
+	// Keep the legacy records and names around, and write the patch mode
+	// records.
+	copyRecords := func(tx *sql.Tx) error {
+		for _, record := range records {
+			if err := backup.insertRecord(ctx, tx, backupMap, record); err != nil {
+				return err
+			}
+		}
+		for _, conversion := range conversions {
+			query := insertQuery(d, ms.quotedConversionTable(conversionMap), conversionRecordColumns)
+			if _, err := tx.ExecContext(ctx, query, conversion.Id, conversion.Name); err != nil {
+				return err
+			}
+
+			record := recordsById[conversion.Id]
+			if record == nil {
+				continue
+			}
+			prefix := numberPrefixPatchRegex.FindStringSubmatch(conversion.Name)
+			err := staging.insertPatchRecord(ctx, tx, stagingMap, &MigrationPatchRecord{
+				Ver:         prefix[1],
+				Patch:       prefix[2],
+				Name:        conversion.Name,
+				CreatedAt:   record.AppliedAt,
+				UpdatedAt:   record.AppliedAt,
+				Checksum:    record.Checksum,
+				DurationMs:  record.DurationMs,
+				AppliedBy:   record.AppliedBy,
+				Host:        record.Host,
+				ToolVersion: record.ToolVersion,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	legacyTable := legacy.quotedTable(backupMap)
+	if transactionalDDL(d) {
+		err = inTransaction(ctx, db, func(tx *sql.Tx) error {
+			if err := copyRecords(tx); err != nil {
+				return err
+			}
+			if err := dropTable(ctx, tx, legacyTable); err != nil {
+				return err
+			}
+			return renameTable(ctx, tx, d, ms.SchemaName, staging.getTableName(), ms.getTableName())
+		})
+		if err != nil {
+			return fail(err)
+		}
+	} else {
+		// DDL statements commit on their own here, so the legacy table is
+		// only dropped once everything else is in place.
+		if err := inTransaction(ctx, db, copyRecords); err != nil {
+			return fail(err)
+		}
+		if err := dropTable(ctx, db, legacyTable); err != nil {
+			return fail(err)
+		}
+		if err := renameTable(ctx, db, d, ms.SchemaName, staging.getTableName(), ms.getTableName()); err != nil {
+			return nil, fmt.Errorf("Migration table %s was dropped, but renaming %s to it failed: %v",
+				ms.getTableName(), staging.getTableName(), err)
+		}
+	}
+
+	ms.log(LogInfo, "Converted migration table to patch mode", "table", ms.getTableName(), "migrations", len(conversions))
+	return conversions, nil
+}
+
+// Plan reverting the conversion of the migration table to patch mode
+//
+// Returns the conversions done by ConvertToPatch. It fails when patches were
+// applied or rolled back since, as reverting would lose them. Nothing is
+// changed.
+func PlanRevertConversion(db *sql.DB, dialect string) ([]*Conversion, error) {
+	return migSet.PlanRevertConversion(db, dialect)
+}
+
+// Plan reverting the conversion of the migration table with a context
+func PlanRevertConversionContext(ctx context.Context, db *sql.DB, dialect string) ([]*Conversion, error) {
+	return migSet.PlanRevertConversionContext(ctx, db, dialect)
+}
+
+func (ms MigrationSet) PlanRevertConversion(db *sql.DB, dialect string) ([]*Conversion, error) {
+	return ms.PlanRevertConversionContext(context.Background(), db, dialect)
+}
+
+func (ms MigrationSet) PlanRevertConversionContext(ctx context.Context, db *sql.DB, dialect string) ([]*Conversion, error) {
+	conversions, _, err := ms.planRevertConversion(ctx, db, dialect)
+	return conversions, err
+}
+
+func (ms MigrationSet) planRevertConversion(ctx context.Context, db *sql.DB, dialect string) ([]*Conversion, []*MigrationRecord, error) {
+	_, backup, patch := ms.conversionSets()
+
+	conversionMap := ms.conversionDbMap(db, dialect)
+	if _, err := tableColumns(ctx, db, ms.quotedConversionTable(conversionMap)); err != nil {
+		return nil, nil, fmt.Errorf("Migration table %s was not converted to patch mode", ms.getTableName())
+	}
+
+	patchMap, err := patch.getMigrationDbMap(ctx, db, dialect)
+	if err != nil {
+		return nil, nil, err
+	}
+	patchRecords, err := patch.selectPatchRecords(ctx, db, patchMap)
+	if err != nil {
+		return nil, nil, err
+	}
+	backupMap, err := backup.getMigrationDbMap(ctx, db, dialect)
+	if err != nil {
+		return nil, nil, err
+	}
+	records, err := backup.selectRecords(ctx, db, backupMap)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	query := selectQuery(conversionMap.Dialect, ms.quotedConversionTable(conversionMap), conversionRecordColumns, "")
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	applied := make(map[string]bool)
+	for _, record := range records {
+		applied[record.Id] = true
+	}
+
+	var conversions []*Conversion
+	for rows.Next() {
+		conversion := &Conversion{}
+		if err := rows.Scan(&conversion.Id, &conversion.Name); err != nil {
+			return nil, nil, err
+		}
+		conversion.Applied = applied[conversion.Id]
+		conversions = append(conversions, conversion)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	sort.Slice(conversions, func(i, j int) bool { return conversions[i].Name < conversions[j].Name })
+
+	// The patch table must still be exactly as converted. The name of a
+	// record is the one of its first patch, so compare versions and patches.
+	converted := make(map[string]*Conversion)
+	for _, conversion := range conversions {
+		if conversion.Applied {
+			prefix := numberPrefixPatchRegex.FindStringSubmatch(conversion.Name)
+			converted[prefix[1]+"_"+prefix[2]] = conversion
+		}
+	}
+	for _, record := range patchRecords {
+		key := record.Ver + "_" + record.Patch
+		if converted[key] == nil {
+			return nil, nil, newPlanError(key, "applied after the conversion, roll it back first")
+		}
+		delete(converted, key)
+	}
+	for _, conversion := range conversions {
+		for _, remaining := range converted {
+			if remaining == conversion {
+				return nil, nil, newPlanError(conversion.Name, "rolled back after the conversion, apply it first")
+			}
+		}
+	}
+
+	return conversions, records, nil
+}
+
+// Revert the conversion of the migration table to patch mode
+//
+// Restores the legacy migration table saved by ConvertToPatch and returns the
+// conversions that were reverted, so the caller can rename the migrations
+// back.
+func RevertConversion(db *sql.DB, dialect string) ([]*Conversion, error) {
+	return migSet.RevertConversion(db, dialect)
+}
+
+// Revert the conversion of the migration table to patch mode with a context
+func RevertConversionContext(ctx context.Context, db *sql.DB, dialect string) ([]*Conversion, error) {
+	return migSet.RevertConversionContext(ctx, db, dialect)
+}
+
+func (ms MigrationSet) RevertConversion(db *sql.DB, dialect string) ([]*Conversion, error) {
+	return ms.RevertConversionContext(context.Background(), db, dialect)
+}
+
+func (ms MigrationSet) RevertConversionContext(ctx context.Context, db *sql.DB, dialect string) ([]*Conversion, error) {
+	lock, err := ms.lockIfEnabled(ctx, db, dialect)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = lock.Unlock() }()
+
+	legacy, backup, _ := ms.conversionSets()
+
+	conversions, records, err := ms.planRevertConversion(ctx, db, dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	conversionMap := ms.conversionDbMap(db, dialect)
+	if err := dropTable(ctx, db, legacy.quotedTable(conversionMap)); err != nil {
+		return nil, err
+	}
+	legacyMap, err := legacy.getMigrationDbMap(ctx, db, dialect)
+	if err != nil {
+		return nil, err
+	}
+	err = inTransaction(ctx, db, func(tx *sql.Tx) error {
+		for _, record := range records {
+			if err := legacy.insertRecord(ctx, tx, legacyMap, record); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := dropTable(ctx, db, backup.quotedTable(conversionMap)); err != nil {
+		return nil, err
+	}
+	if err := dropTable(ctx, db, ms.quotedConversionTable(conversionMap)); err != nil {
+		return nil, err
+	}
+
+	ms.log(LogInfo, "Reverted migration table conversion", "table", ms.getTableName(), "migrations", len(conversions))
+	return conversions, nil
+}
+
+// conversionSets returns the migration sets of the legacy table, its backup
+// and the patch mode table.
+func (ms MigrationSet) conversionSets() (MigrationSet, MigrationSet, MigrationSet) {
+	legacy, backup, patch := ms, ms, ms
+	legacy.EnablePatchMode = false
+	backup.EnablePatchMode = false
+	backup.TableName = ms.getTableName() + "_legacy"
+	patch.EnablePatchMode = true
+	return legacy, backup, patch
+}
+
+func (ms MigrationSet) conversionTableName() string {
+	return ms.getTableName() + "_conversion"
+}
+
+func (ms MigrationSet) quotedConversionTable(dbMap *gorp.DbMap) string {
+	return dbMap.Dialect.QuotedTableForQuery(ms.SchemaName, ms.conversionTableName())
+}
+
+func (ms MigrationSet) conversionDbMap(db *sql.DB, dialect string) *gorp.DbMap {
+	dbMap := &gorp.DbMap{Db: db, Dialect: MigrationDialects[dialect]}
+	table := dbMap.AddTableWithNameAndSchema(conversionRecord{}, ms.SchemaName, ms.conversionTableName()).
+		SetKeys(false, "Id")
+	if dialect == "oci8" || dialect == "godror" {
+		table.ColMap("Id").SetMaxSize(4000)
+	}
+	return dbMap
+}
+
+func createTables(dbMap *gorp.DbMap) error {
+	err := dbMap.CreateTablesIfNotExists()
+	// Oracle database does not support `if not exists`, so use `ORA-00955:` error code
+	// to check if the table exists.
+	if _, oracle := dbMap.Dialect.(OracleDialect); err != nil && !(oracle && strings.Contains(err.Error(), "ORA-00955:")) {
+		return err
+	}
+	return nil
+}
+
+func dropTable(ctx context.Context, executor SqlExecutorContext, table string) error {
+	_, err := executor.ExecContext(ctx, fmt.Sprintf("DROP TABLE %s", table))
+	return err
+}
+
+// renameTable renames the table from to the table to, both in schema.
+func renameTable(ctx context.Context, executor SqlExecutorContext, d gorp.Dialect, schema, from, to string) error {
+	var query string
+	switch d.(type) {
+	case gorp.SqlServerDialect:
+		if schema != "" {
+			from = schema + "." + from
+		}
+		query = fmt.Sprintf("EXEC sp_rename '%s', '%s'", from, to)
+	case gorp.MySQLDialect:
+		query = fmt.Sprintf("RENAME TABLE %s TO %s", d.QuotedTableForQuery(schema, from), d.QuotedTableForQuery(schema, to))
+	default:
+		query = fmt.Sprintf("ALTER TABLE %s RENAME TO %s", d.QuotedTableForQuery(schema, from), d.QuoteField(to))
+	}
+	_, err := executor.ExecContext(ctx, query)
+	return err
+}
+
+// inTransaction runs fn in a transaction, which is committed when fn succeeds.
+func inTransaction(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
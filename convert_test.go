@@ -0,0 +1,184 @@
+package migrate
+
+import (
+	"context"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/gorp.v1"
+)
+
+func (s *SqliteMigrateSuite) TestConvertToPatch(c *C) {
+	migrations := &MemoryMigrationSource{
+		Migrations: []*Migration{
+			&Migration{
+				Id:   "1_initial.sql",
+				Up:   []string{"CREATE TABLE people (id int)"},
+				Down: []string{"DROP TABLE people"},
+			},
+			&Migration{
+				Id:   "2.sql",
+				Up:   []string{"ALTER TABLE people ADD COLUMN first_name text"},
+				Down: []string{"SELECT 0"},
+			},
+			&Migration{
+				Id:   "20200101_add_pets.sql",
+				Up:   []string{"CREATE TABLE pets (id int)"},
+				Down: []string{"DROP TABLE pets"},
+			},
+		},
+	}
+
+	ms := MigrationSet{}
+	_, err := ms.ExecMax(s.Db, "sqlite3", migrations, Up, 2)
+	c.Assert(err, IsNil)
+
+	conversions, err := ms.PlanConversion(s.Db, "sqlite3", migrations)
+	c.Assert(err, IsNil)
+	c.Assert(conversions, DeepEquals, []*Conversion{
+		{Id: "1_initial.sql", Name: "0001_00_initial.sql", Applied: true},
+		{Id: "2.sql", Name: "0002_00_2.sql", Applied: true},
+		{Id: "20200101_add_pets.sql", Name: "0003_00_add_pets.sql"},
+	})
+
+	_, err = ms.ConvertToPatch(s.Db, "sqlite3", migrations)
+	c.Assert(err, IsNil)
+
+	// The patch mode table picks up where the legacy one left off
+	patches := &MemoryMigrationSource{}
+	for i, conversion := range conversions {
+		patches.MigrationsPatch = append(patches.MigrationsPatch, &MigrationPatch{
+			Name: conversion.Name,
+			Up:   migrations.Migrations[i].Up,
+			Down: migrations.Migrations[i].Down,
+		})
+	}
+	patchSet := MigrationSet{EnablePatchMode: true}
+	records, err := patchSet.GetMigrationPatchRecords(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 2)
+	c.Assert(records[1].Ver, Equals, "0002")
+	c.Assert(records[1].Patch, Equals, "00")
+
+	planned, _, err := patchSet.PlanMigrationPatch(s.Db, "sqlite3", patches, Up, 0)
+	c.Assert(err, IsNil)
+	c.Assert(planned, HasLen, 1)
+	c.Assert(planned[0].Name, Equals, "0003_00_add_pets.sql")
+
+	_, err = ms.ConvertToPatch(s.Db, "sqlite3", migrations)
+	c.Assert(err, NotNil)
+
+	// Revert it
+	reverted, err := ms.RevertConversion(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(reverted, DeepEquals, conversions)
+
+	legacy, err := ms.GetMigrationRecords(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(legacy, HasLen, 2)
+	c.Assert(legacy[1].Id, Equals, "2.sql")
+	c.Assert(legacy[1].Checksum, Equals, migrations.Migrations[1].Checksum())
+
+	_, err = ms.RevertConversion(s.Db, "sqlite3")
+	c.Assert(err, NotNil)
+}
+
+func (s *SqliteMigrateSuite) TestRevertConversionAfterChanges(c *C) {
+	migrations := &MemoryMigrationSource{
+		Migrations: []*Migration{
+			&Migration{
+				Id:   "1_initial.sql",
+				Up:   []string{"CREATE TABLE people (id int)"},
+				Down: []string{"DROP TABLE people"},
+			},
+		},
+	}
+
+	ms := MigrationSet{}
+	_, err := ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+	_, err = ms.ConvertToPatch(s.Db, "sqlite3", migrations)
+	c.Assert(err, IsNil)
+
+	patches := &MemoryMigrationSource{
+		MigrationsPatch: []*MigrationPatch{
+			{
+				Name: "0001_00_initial.sql",
+				Up:   []string{"CREATE TABLE people (id int)"},
+				Down: []string{"DROP TABLE people"},
+			},
+			{
+				Name: "0001_01_name.sql",
+				Up:   []string{"ALTER TABLE people ADD COLUMN first_name text"},
+				Down: []string{"SELECT 0"},
+			},
+		},
+	}
+	_, err = MigrationSet{EnablePatchMode: true}.Exec(s.Db, "sqlite3", patches, Up)
+	c.Assert(err, IsNil)
+
+	_, err = ms.PlanRevertConversion(s.Db, "sqlite3")
+	c.Assert(err, FitsTypeOf, &PlanError{})
+	c.Assert(err.(*PlanError).MigrationName, Equals, "0001_01")
+}
+
+func (s *SqliteMigrateSuite) TestConvertToPatchFailure(c *C) {
+	migrations := &MemoryMigrationSource{
+		Migrations: sqliteMigrations,
+	}
+
+	ms := MigrationSet{}
+	_, err := ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+
+	// The legacy records can't be kept aside in a table of another layout
+	_, err = s.Db.Exec("CREATE TABLE gorp_migrations_legacy (x int)")
+	c.Assert(err, IsNil)
+	_, err = ms.ConvertToPatch(s.Db, "sqlite3", migrations)
+	c.Assert(err, NotNil)
+
+	// Nothing was changed, so the conversion can be retried
+	records, err := ms.GetMigrationRecords(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 2)
+	for _, table := range []string{"gorp_migrations_conversion", "gorp_migrations_patch"} {
+		exists, err := tableExists(context.Background(), s.Db, gorp.SqliteDialect{}, "", table)
+		c.Assert(err, IsNil)
+		c.Assert(exists, Equals, false)
+	}
+
+	_, err = s.Db.Exec("DROP TABLE gorp_migrations_legacy")
+	c.Assert(err, IsNil)
+	_, err = ms.ConvertToPatch(s.Db, "sqlite3", migrations)
+	c.Assert(err, IsNil)
+	patchRecords, err := MigrationSet{EnablePatchMode: true}.GetMigrationPatchRecords(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(patchRecords, HasLen, 2)
+}
+
+func (s *SqliteMigrateSuite) TestPlanConversionNonNumericId(c *C) {
+	migrations := &MemoryMigrationSource{
+		Migrations: []*Migration{
+			&Migration{
+				Id:   "1_initial.sql",
+				Up:   []string{"CREATE TABLE people (id int)"},
+				Down: []string{"DROP TABLE people"},
+			},
+			&Migration{
+				Id:   "init.sql",
+				Up:   []string{"CREATE TABLE pets (id int)"},
+				Down: []string{"DROP TABLE pets"},
+			},
+		},
+	}
+
+	ms := MigrationSet{}
+	_, err := ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+
+	conversions, err := ms.PlanConversion(s.Db, "sqlite3", migrations)
+	c.Assert(err, IsNil)
+	c.Assert(conversions, DeepEquals, []*Conversion{
+		{Id: "1_initial.sql", Name: "0001_00_initial.sql", Applied: true},
+		{Id: "init.sql", Name: "0002_00_init.sql", Applied: true},
+	})
+}
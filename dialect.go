@@ -0,0 +1,45 @@
+package migrate
+
+import (
+	"github.com/rubenv/sql-migrate/sqlparse"
+)
+
+// forDialect returns the migration with the statements of its sections for
+// dialect in place of the generic ones.
+func (m *Migration) forDialect(dialect string) *Migration {
+	up, down := m.UpDialects[dialect], m.DownDialects[dialect]
+	if up == nil && down == nil {
+		return m
+	}
+
+	selected := *m
+	if up != nil {
+		selected.Up, selected.UpLines, selected.DisableTransactionUp = sectionStatements(up)
+	}
+	if down != nil {
+		selected.Down, selected.DownLines, selected.DisableTransactionDown = sectionStatements(down)
+	}
+	return &selected
+}
+
+// forDialect returns the migration with the statements of its sections for
+// dialect in place of the generic ones.
+func (m *MigrationPatch) forDialect(dialect string) *MigrationPatch {
+	up, down := m.UpDialects[dialect], m.DownDialects[dialect]
+	if up == nil && down == nil {
+		return m
+	}
+
+	selected := *m
+	if up != nil {
+		selected.Up, selected.UpLines, selected.DisableTransactionUp = sectionStatements(up)
+	}
+	if down != nil {
+		selected.Down, selected.DownLines, selected.DisableTransactionDown = sectionStatements(down)
+	}
+	return &selected
+}
+
+func sectionStatements(section *sqlparse.DialectSection) ([]string, []int, bool) {
+	return section.Statements, section.Lines, section.DisableTransaction
+}
@@ -0,0 +1,73 @@
+package migrate
+
+import (
+	"sort"
+	"strings"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/rubenv/sql-migrate/sqlparse"
+)
+
+const dialectMigration = `-- +migrate Up
+CREATE TABLE people (id int);
+-- +migrate Up dialect=sqlite3
+CREATE TABLE people (id integer primary key autoincrement);
+-- +migrate Up dialect=postgres
+CREATE TABLE people (id serial primary key);
+-- +migrate Down
+DROP TABLE people;
+`
+
+func (s *SqliteMigrateSuite) TestDialectSections(c *C) {
+	migration, err := ParseMigration("1_people.sql", strings.NewReader(dialectMigration))
+	c.Assert(err, IsNil)
+	migrations := &MemoryMigrationSource{Migrations: []*Migration{migration}}
+
+	ms := MigrationSet{}
+	planned, _, err := ms.PlanMigration(s.Db, "sqlite3", migrations, Up, 0)
+	c.Assert(err, IsNil)
+	c.Assert(planned, HasLen, 1)
+	c.Assert(planned[0].Queries, DeepEquals, []string{"CREATE TABLE people (id integer primary key autoincrement);\n"})
+	c.Assert(planned[0].Down, DeepEquals, []string{"DROP TABLE people;\n"})
+	c.Assert(planned[0].UpLines, DeepEquals, []int{4})
+
+	// Other dialects use the generic section
+	mssql, err := ms.findMigrations(migrations, "mssql")
+	c.Assert(err, IsNil)
+	c.Assert(mssql[0].Up, DeepEquals, []string{"CREATE TABLE people (id int);\n"})
+	postgres, err := ms.findMigrations(migrations, "postgres")
+	c.Assert(err, IsNil)
+	c.Assert(postgres[0].Up, DeepEquals, []string{"CREATE TABLE people (id serial primary key);\n"})
+	c.Assert(migration.Up, DeepEquals, []string{"CREATE TABLE people (id int);\n"})
+
+	n, err := ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+	_, err = s.Db.Exec("INSERT INTO people DEFAULT VALUES")
+	c.Assert(err, IsNil)
+}
+
+func (s *SqliteMigrateSuite) TestDialectSectionsPatch(c *C) {
+	migration, err := ParseMigrationPatch("0001_00_people.sql", strings.NewReader(dialectMigration))
+	c.Assert(err, IsNil)
+	migrations := &MemoryMigrationSource{MigrationsPatch: []*MigrationPatch{migration}}
+
+	ms := MigrationSet{EnablePatchMode: true}
+	planned, _, err := ms.PlanMigrationPatch(s.Db, "sqlite3", migrations, Up, 0)
+	c.Assert(err, IsNil)
+	c.Assert(planned, HasLen, 1)
+	c.Assert(planned[0].Queries, DeepEquals, []string{"CREATE TABLE people (id integer primary key autoincrement);\n"})
+}
+
+func (s *SqliteMigrateSuite) TestKnownDialects(c *C) {
+	// Dialect sections can only be written for dialects that can be used.
+	var dialects []string
+	for dialect := range MigrationDialects {
+		dialects = append(dialects, dialect)
+	}
+	known := append([]string(nil), sqlparse.KnownDialects...)
+	sort.Strings(dialects)
+	sort.Strings(known)
+	c.Assert(known, DeepEquals, dialects)
+}
@@ -0,0 +1,137 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"gopkg.in/gorp.v1"
+)
+
+// DirtyError is returned when planning while a notransaction migration is
+// dirty: it was interrupted without recording how far it got, for example
+// because the process crashed. The database may be half-migrated, so repair it
+// by hand and use ForceMigration to mark the migration applied or unapplied.
+type DirtyError struct {
+	MigrationName string
+	Direction     string
+}
+
+func (e *DirtyError) Error() string {
+	return fmt.Sprintf("Migration %s was interrupted while migrating %s and the database may be half-migrated, "+
+		"repair it and force the migration to applied or unapplied", e.MigrationName, e.Direction)
+}
+
+// Force the state of a migration
+//
+// Records the migration named id as applied or unapplied without running it,
+// and clears its progress, including the dirty mark. Meant to resolve a
+// *DirtyError after repairing the database by hand.
+func ForceMigration(db *sql.DB, dialect string, m MigrationSource, id string, applied bool) error {
+	return migSet.ForceMigration(db, dialect, m, id, applied)
+}
+
+// Force the state of a migration with a context
+func ForceMigrationContext(ctx context.Context, db *sql.DB, dialect string, m MigrationSource, id string, applied bool) error {
+	return migSet.ForceMigrationContext(ctx, db, dialect, m, id, applied)
+}
+
+func (ms MigrationSet) ForceMigration(db *sql.DB, dialect string, m MigrationSource, id string, applied bool) error {
+	return ms.ForceMigrationContext(context.Background(), db, dialect, m, id, applied)
+}
+
+func (ms MigrationSet) ForceMigrationContext(ctx context.Context, db *sql.DB, dialect string, m MigrationSource, id string, applied bool) error {
+	lock, err := ms.lockIfEnabled(ctx, db, dialect)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = lock.Unlock() }()
+
+	dbMap, err := ms.getMigrationDbMap(ctx, db, dialect)
+	if err != nil {
+		return err
+	}
+
+	var name string
+	err = ms.withExecutor(ctx, db, id, false, func(executor SqlExecutorContext) error {
+		if ms.EnablePatchMode {
+			name, err = ms.forcePatch(ctx, executor, dbMap, dialect, m, id, applied)
+		} else {
+			name, err = ms.force(ctx, executor, dbMap, dialect, m, id, applied)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	exists, err := tableExists(ctx, db, dbMap.Dialect, ms.SchemaName, ms.progressTableName())
+	if err != nil {
+		return err
+	}
+	if exists {
+		table := ms.quotedProgressTable(ms.newProgressDbMap(db, dbMap.Dialect))
+		if _, err := db.ExecContext(ctx, deleteQuery(dbMap.Dialect, table, "migration"), name); err != nil {
+			return err
+		}
+	}
+
+	ms.log(LogInfo, "Forced migration", "migration", name, "applied", applied)
+	return nil
+}
+
+func (ms MigrationSet) force(ctx context.Context, executor SqlExecutorContext, dbMap *gorp.DbMap, dialect string,
+	m MigrationSource, id string, applied bool) (string, error) {
+	migrations, err := ms.findMigrations(m, dialect)
+	if err != nil {
+		return "", err
+	}
+
+	var migration *Migration
+	for _, candidate := range migrations {
+		if candidate.Id == id {
+			migration = candidate
+		}
+	}
+	if migration == nil {
+		return "", newPlanError(id, "unknown migration")
+	}
+
+	if err := ms.deleteRecord(ctx, executor, dbMap, id); err != nil {
+		return "", err
+	}
+	if applied {
+		if err := ms.insertRecord(ctx, executor, dbMap, ms.newRecord(migration, 0)); err != nil {
+			return "", err
+		}
+	}
+	return id, nil
+}
+
+// forcePatch forces the patch named by id, which is a name or a target as
+// accepted by ExecTo. Forcing a patch unapplied moves its version back to the
+// preceding patch.
+func (ms MigrationSet) forcePatch(ctx context.Context, executor SqlExecutorContext, dbMap *gorp.DbMap, dialect string,
+	m MigrationSource, id string, applied bool) (string, error) {
+	migrations, err := ms.findMigrationsPatch(m, dialect)
+	if err != nil {
+		return "", err
+	}
+
+	index := findPatchTarget(migrations, id)
+	if index < 0 {
+		return "", newPlanError(id, "unknown migration")
+	}
+	migration := migrations[index]
+
+	if applied {
+		return migration.Name, ms.upsertPatchRecord(ctx, executor, dbMap, migration, time.Now(), 0)
+	}
+
+	previous := previousPatch(migrations, migration)
+	if previous == nil {
+		return migration.Name, ms.deletePatchRecord(ctx, executor, dbMap, migration.Ver)
+	}
+	return migration.Name, ms.upsertPatchRecord(ctx, executor, dbMap, previous, time.Now(), 0)
+}
@@ -0,0 +1,120 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *SqliteMigrateSuite) TestDirtyMigration(c *C) {
+	migration := &Migration{
+		Id:                   "124",
+		Up:                   []string{"ALTER TABLE people ADD COLUMN first_name text", "SELECT 1"},
+		Down:                 []string{"SELECT 0"},
+		DisableTransactionUp: true,
+	}
+	migrations := &MemoryMigrationSource{
+		Migrations: []*Migration{sqliteMigrations[0], migration},
+	}
+
+	ms := MigrationSet{}
+	_, err := ms.ExecMax(s.Db, "sqlite3", migrations, Up, 1)
+	c.Assert(err, IsNil)
+
+	// The process crashes after the first statement
+	event := &MigrationEvent{Migration: &PlannedMigration{Migration: migration}, Direction: Up}
+	progress, err := ms.trackProgress(context.Background(), s.Db, MigrationDialects["sqlite3"], event, migration.Up)
+	c.Assert(err, IsNil)
+	_, err = s.Db.Exec(migration.Up[0])
+	c.Assert(err, IsNil)
+	c.Assert(progress.completed(context.Background(), 1), IsNil)
+
+	_, _, err = ms.PlanMigration(s.Db, "sqlite3", migrations, Up, 0)
+	c.Assert(err, FitsTypeOf, &DirtyError{})
+	c.Assert(err.(*DirtyError).MigrationName, Equals, "124")
+	_, err = ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, FitsTypeOf, &DirtyError{})
+
+	// After repairing it by hand
+	c.Assert(ms.ForceMigration(s.Db, "sqlite3", migrations, "125", true), NotNil)
+	c.Assert(ms.ForceMigration(s.Db, "sqlite3", migrations, "124", true), IsNil)
+
+	planned, _, err := ms.PlanMigration(s.Db, "sqlite3", migrations, Up, 0)
+	c.Assert(err, IsNil)
+	c.Assert(planned, HasLen, 0)
+	records, err := ms.GetMigrationRecords(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 2)
+
+	c.Assert(ms.ForceMigration(s.Db, "sqlite3", migrations, "124", false), IsNil)
+	records, err = ms.GetMigrationRecords(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 1)
+}
+
+func (s *SqliteMigrateSuite) TestForceMigrationPatch(c *C) {
+	migrations := &MemoryMigrationSource{
+		MigrationsPatch: []*MigrationPatch{
+			{
+				Name: "0001_00_initial.sql",
+				Up:   []string{"CREATE TABLE people (id int)"},
+				Down: []string{"DROP TABLE people"},
+			},
+			{
+				Name: "0001_01_name.sql",
+				Up:   []string{"ALTER TABLE people ADD COLUMN first_name text"},
+				Down: []string{"SELECT 0"},
+			},
+		},
+	}
+
+	ms := MigrationSet{EnablePatchMode: true}
+	c.Assert(ms.ForceMigration(s.Db, "sqlite3", migrations, "0001_01", true), IsNil)
+	records, err := ms.GetMigrationPatchRecords(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 1)
+	c.Assert(records[0].Patch, Equals, "01")
+
+	c.Assert(ms.ForceMigration(s.Db, "sqlite3", migrations, "0001_01_name.sql", false), IsNil)
+	records, err = ms.GetMigrationPatchRecords(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 1)
+	c.Assert(records[0].Patch, Equals, "00")
+
+	c.Assert(ms.ForceMigration(s.Db, "sqlite3", migrations, "0001_00", false), IsNil)
+	records, err = ms.GetMigrationPatchRecords(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 0)
+}
+
+func (s *SqliteMigrateSuite) TestDirtyMigrationFunc(c *C) {
+	migration := &Migration{
+		Id: "124",
+		UpFunc: func(ctx context.Context, executor SqlExecutorContext) error {
+			if _, err := executor.ExecContext(ctx, "ALTER TABLE people ADD COLUMN first_name text"); err != nil {
+				return err
+			}
+			return errors.New("failed halfway")
+		},
+		DisableTransactionUp: true,
+	}
+	migrations := &MemoryMigrationSource{
+		Migrations: []*Migration{sqliteMigrations[0], migration},
+	}
+
+	ms := MigrationSet{}
+	n, err := ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, NotNil)
+	c.Assert(n, Equals, 1)
+
+	// Nothing tells how far the function got
+	_, _, err = ms.PlanMigration(s.Db, "sqlite3", migrations, Up, 0)
+	c.Assert(err, FitsTypeOf, &DirtyError{})
+	c.Assert(err.(*DirtyError).MigrationName, Equals, "124")
+
+	c.Assert(ms.ForceMigration(s.Db, "sqlite3", migrations, "124", true), IsNil)
+	planned, _, err := ms.PlanMigration(s.Db, "sqlite3", migrations, Up, 0)
+	c.Assert(err, IsNil)
+	c.Assert(planned, HasLen, 0)
+}
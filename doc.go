@@ -27,11 +27,19 @@ The main command is called sql-migrate.
 	usage: sql-migrate [--version] [--help] <command> [<args>]
 
 	Available commands are:
+		baseline  Mark the migrations up to a target as applied without running them
+		convert   Convert migrations and the migration table to patch mode
 		down      Undo a database migration
+		dump      Dump the schema of the database
+		force     Mark a migration as applied or unapplied without running it
+		lint      Check migrations for common problems
 		new       Create a new migration
+		progress  Show or reset the progress of interrupted notransaction migrations
 		redo      Reapply the last migration
+		squash    Squash a range of migrations into a single migration
 		status    Show migration status
 		up        Migrates the database to the most recent version available
+		verify    Verify that migrations can be rolled back
 
 Each command requires a configuration file (which defaults to dbconfig.yml, but can be specified with the -config flag). This config file should specify one or more environments:
 
@@ -48,6 +56,12 @@ Each command requires a configuration file (which defaults to dbconfig.yml, but
 
 The `table` setting is optional and will default to `gorp_migrations`.
 
+The up, down, redo, skip and baseline commands hold a migration lock while they run, so concurrent runs against the same database wait for each other. The optional `lock_timeout` setting (e.g. `30s`) limits how long to wait for it.
+
+Migrations that are older than the last applied one but were never applied, for example because they were merged later, are applied before the newer ones. The optional `out_of_order` setting changes that: `allow` (the default) applies them, `warn` applies them and logs a warning, and `error` refuses to migrate and lists them. The status command marks them as out of order. From a library use SetOutOfOrderPolicy; the error mode fails with an *OutOfOrderError.
+
+The dump command prints the tables, columns, indexes, constraints, views and (on postgres) sequences of the configured schema as sorted DDL, followed by the applied migrations, for sqlite3, postgres and mysql. With the optional `schema_dump` setting, up, down and redo write the dump to that file after every successful run. From a library use DumpSchema.
+
 The environment that will be used can be specified with the -env flag (defaults to development).
 
 Use the --help flag in combination with any of the commands to get an overview of its usage:
@@ -62,12 +76,25 @@ Use the --help flag in combination with any of the commands to get an overview o
 	  -config=config.yml   Configuration file to use.
 	  -env="development"   Environment.
 	  -limit=0             Limit the number of migrations (0 = unlimited).
+	  -to=<id>             Migrate up to this migration instead (overrides -limit).
 	  -dryrun              Don't apply migrations, just print them.
 
 The up command applies all available migrations. By contrast, down will only apply one migration by default. This behavior can be changed for both by using the -limit parameter.
 
+To migrate to a specific migration instead, pass its file name with -to: up -to applies everything up to and including it, down -to rolls back everything applied after it. In patch mode the target can also be given as 0005_01, or as 0005 for the last patch of a version. The status command accepts -to as well, to show which migrations that would run.
+
+Pass -report to up, down or redo to get a summary table of the migrations that ran, with their duration and the number of affected rows.
+
 The redo command will unapply the last migration and reapply it. This is useful during development, when you're writing migrations.
 
+The baseline command marks every migration up to and including the one given with -to as applied without running it, to adopt sql-migrate on an existing database. Pass -dryrun to list them instead. From a library use Baseline.
+
+The squash command replaces the migrations from -from up to and including -to by a single migration, with their Up statements in order and their Down statements in reverse, and removes them. Its "-- +migrate Squashes:" header lists the replaced migrations, so databases that have them applied count it as applied. From a library use Squash and WriteMigration.
+
+The verify command applies, rolls back and reapplies every pending migration, and checks that rolling back restores the schema. It reports each migration, with the first differing object of one that fails. Run it against a scratch environment, or pass -sqlite for a throwaway SQLite database. From a library use Verify.
+
+The lint command checks migrations for empty Down sections, notransaction sections with several statements, Postgres indexes on big tables created without CONCURRENTLY, DROP TABLE and DROP COLUMN in Up sections, and ids that don't start with a number among ones that do. The lint setting of an environment disables rules and lists the big tables, and -format json gives output for CI. From a library use Lint.
+
 Use the status command to see the state of the applied migrations:
 
 	$ sql-migrate status
@@ -136,6 +163,33 @@ Then use the Exec function to upgrade your database:
 
 Note that n can be greater than 0 even if there is an error: any migration that succeeded will remain applied even if a later one fails.
 
+Every entry point also has a variant that takes a context.Context (ExecContext, ExecMaxContext, PlanMigrationContext, SkipMaxContext, ...). The context is passed to every statement and transaction, so a run can be cancelled or given a deadline:
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	n, err := migrate.ExecContext(ctx, db, "sqlite3", migrations, migrate.Up)
+
+When the context is done, the migration being run is rolled back and a *TxError naming it is returned.
+
+When a statement fails, the *TxError also carries its StatementIndex, its SQL (Statement) and the Line it starts on in the migration file. The command line tool prints an excerpt of the file pointing at that line.
+
+To bring the database to a given migration, whichever way that is, use ExecTo. It applies the migrations up to and including the target if it hasn't been applied yet, and otherwise rolls back the ones applied after it. PlanTo returns the plan along with its direction. An unknown target results in a *PlanError.
+
+ExecReport and ExecToReport return a *Report with an entry per migration that was run: its direction, start and end time, whether it ran in a transaction, and the duration and affected rows of each statement. On failure the report covers everything up to and including the failed migration.
+
+Migrations can also be written in Go by setting UpFunc and DownFunc, which run after the Up/Down statements and are given the transaction of the migration (or the *sql.DB when transactions are disabled for it). A MultiMigrationSource combines such migrations with migration files.
+
+To run your own code around migrations, set Hooks on the MigrationSet (embed NopHooks to implement only some of them). BeforePlan is called before planning, BeforeMigration, AfterStatement and AfterMigration inside the transaction of each migration, and OnError after a failed migration was rolled back. A hook returning an error aborts the run and rolls back the migration being run.
+
+The library logs nothing by default. Set a Logger on the MigrationSet (or call SetLogger) to get plan decisions and applied migrations at info level, every statement with its duration and every commit and rollback at debug level. NewStdLogger adapts a *log.Logger, NewLevelledLogger adapts loggers with Debug/Info/Warn/Error methods. The command line tool logs at info level, -verbose adds the statements and -quiet only shows errors.
+
+A checksum of the Up and Down statements of every applied migration is stored in the migration table. Planning fails with a *ChecksumError when an applied migration was edited afterwards, unless WarnOnChecksumMismatch is set on the MigrationSet. Existing migration tables get the checksum column added automatically.
+
+Every applied migration also records its duration, the OS user and host that applied it and the tool version, which defaults to "sql-migrate " followed by Version and can be changed with ToolVersion on the MigrationSet or SetToolVersion. Older migration tables get these columns added in place.
+
+When several processes migrate the same database at startup, set EnableLocking (and optionally LockTimeout) on the MigrationSet so they don't apply the same migrations concurrently. Postgres uses advisory locks, MySQL GET_LOCK and MSSQL sp_getapplock; other dialects insert a row into a <table>_lock table. A *LockError is returned when the lock can't be acquired in time.
+
 The full set of capabilities can be found in the API docs below.
 
 Writing migrations
@@ -174,6 +228,35 @@ If you have complex statements which contain semicolons, use StatementBegin and
 	DROP FUNCTION do_something();
 	DROP TABLE people;
 
+Migrations that differ between environments can be written as a text/template by adding the Template annotation:
+
+	-- +migrate Template
+	-- +migrate Up
+	CREATE TABLE people (id int) TABLESPACE {{.tablespace}};
+
+	-- +migrate Down
+	DROP TABLE people;
+
+The variables come from the vars map of the environment in dbconfig.yml, or from TemplateVars on the MigrationSet. The template is rendered before it is split into statements, so checksums and dry runs reflect the rendered SQL.
+
+Statements that differ between databases can be put in sections for a dialect. A section annotated with dialect=<name> (several separated by commas) replaces the generic section of the same direction for that dialect, so one set of migrations can serve several databases:
+
+	-- +migrate Up
+	CREATE TABLE people (id int);
+	-- +migrate Up dialect=postgres
+	CREATE TABLE people (id serial primary key);
+
+	-- +migrate Down
+	DROP TABLE people;
+
+The sections are selected when migrations are planned, based on the dialect passed in. An unknown dialect name fails parsing; a dialect added to MigrationDialects has to be added to sqlparse.KnownDialects as well.
+
+Migrations can be tagged with a header such as "-- +migrate Tags: seed,staging". Set Tags on the MigrationSet (or use the -tags and -skip-tags flags of the tool) to only run tagged migrations with one of the included tags, and to skip those with an excluded tag. Migrations without tags always run.
+
+Repeatable migrations, for views and functions that are easier to maintain as a single file, have a file name starting with "R_" or carry the "-- +migrate Repeatable" annotation. They run after all versioned migrations whenever they are new or their checksum changed, are recorded in the <table>_repeatable table and are never rolled back. They can't have Go functions, as the checksum only covers their statements.
+
+A migration can name the migrations it depends on in a header such as "-- +migrate Requires: 1_people.sql". It is applied after them, even when they sort after it, and rolled back before them. Migrating to a target also applies the migrations it requires, and waiting for a required migration doesn't make a migration out of order. Planning fails with a *PlanError when a required migration doesn't exist or isn't applied first, when migrations require each other in a cycle, and when a migration would be rolled back while one that requires it stays applied. In patch mode migrations can only require ones that sort before them.
+
 The order in which migrations are applied is defined through the filename: sql-migrate will sort migrations based on their name. It's recommended to use an increasing version number or a timestamp as the first part of the filename.
 
 Normally each migration is run within a transaction in order to guarantee that it is fully atomic. However some SQL commands (for example creating an index concurrently in PostgreSQL) cannot be executed inside a transaction. In order to execute such a command in a migration, the migration can be run using the notransaction option:
@@ -184,6 +267,12 @@ Normally each migration is run within a transaction in order to guarantee that i
 	-- +migrate Down
 	DROP INDEX people_unique_id_idx;
 
+When a statement of such a migration fails, the ones before it already took effect. Their progress is recorded, and the next run resumes the migration at the statement that failed, as long as the statements that already ran are unchanged. GetMigrationProgress and ResetMigrationProgress (or the progress command of the tool) inspect and reset it.
+
+While such a migration runs it is marked dirty in the <table>_progress table. A migration with a Go function stays dirty when it fails after its statements, as the function may have taken effect in part. When the process dies before it can record how far it got, planning fails with a *DirtyError until the database was repaired by hand and the migration forced to applied or unapplied with ForceMigration (or the force command of the tool).
+
+On databases with transactional DDL, SetAtomic(true) (or the -atomic flag of the tool) runs the whole plan, including the updates of the migration table, in a single transaction with a savepoint per migration. It refuses to start when a notransaction migration is planned.
+
 Patching migration
 
 For Enable Patching migrations use function EnablePatchMode(true)
@@ -194,6 +283,10 @@ Recommended set new table name or delete old migration table SetTable("migration
 
 It is possible to delete the first versions of major migrations. For example, two files 0001_00_name.sql and 0001_01_name.sql can be merged into one file 0001_01_name.sql.
 
+The migration table holds one record per version, with the last applied patch. Rolling back a patch moves that record back to the patch before it, and rolling back the first patch of a version removes the record.
+
+Existing migration tables can be converted in place with ConvertToPatch, or the convert command of the tool, which also renames the migration files (1_initial.sql becomes 0001_00_initial.sql). PlanConversion previews it. The legacy records are kept aside, so RevertConversion (convert -rollback) can undo it as long as no patches were applied or rolled back since.
+
 Embedding migrations with packr
 
 If you like your Go applications self-contained (that is: a single binary): use packr (https://github.com/gobuffalo/packr) to embed the migration files.
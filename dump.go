@@ -0,0 +1,324 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"gopkg.in/gorp.v1"
+)
+
+// Dump the schema of a database
+//
+// Writes the tables, columns, indexes and constraints in the schema of the
+// migration set as DDL to w, sorted by table and name so that dumps of
+// databases with the same migrations are equal. The dump ends with the
+// migrations applied according to the migration table. Supported for
+// sqlite3, postgres and mysql.
+func DumpSchema(db *sql.DB, dialect string, w io.Writer) error {
+	return migSet.DumpSchema(db, dialect, w)
+}
+
+// Dump the schema of a database with a context
+func DumpSchemaContext(ctx context.Context, db *sql.DB, dialect string, w io.Writer) error {
+	return migSet.DumpSchemaContext(ctx, db, dialect, w)
+}
+
+func (ms MigrationSet) DumpSchema(db *sql.DB, dialect string, w io.Writer) error {
+	return ms.DumpSchemaContext(context.Background(), db, dialect, w)
+}
+
+func (ms MigrationSet) DumpSchemaContext(ctx context.Context, db *sql.DB, dialect string, w io.Writer) error {
+	dump, err := getSchemaDumper(dialect)
+	if err != nil {
+		return err
+	}
+
+	dbMap, err := ms.getMigrationDbMap(ctx, db, dialect)
+	if err != nil {
+		return err
+	}
+
+	objects, err := dump(ctx, db, dbMap.Dialect, ms.SchemaName)
+	if err != nil {
+		return err
+	}
+
+	var applied []string
+	if ms.EnablePatchMode {
+		records, err := ms.selectPatchRecords(ctx, db, dbMap)
+		if err != nil {
+			return err
+		}
+		for _, record := range records {
+			applied = append(applied, record.Name)
+		}
+	} else {
+		records, err := ms.selectRecords(ctx, db, dbMap)
+		if err != nil {
+			return err
+		}
+		for _, record := range records {
+			applied = append(applied, record.Id)
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("-- Schema dumped by sql-migrate, do not edit.\n")
+	for _, object := range objects {
+		fmt.Fprintf(&b, "\n%s;\n", object.DDL)
+	}
+	fmt.Fprintf(&b, "\n-- Applied migrations (%s):\n", ms.getTableName())
+	for _, name := range applied {
+		fmt.Fprintf(&b, "-- %s\n", name)
+	}
+
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+// schemaObject is a table, index or other object of a schema, with the DDL
+// that creates it.
+type schemaObject struct {
+	Kind  string
+	Name  string
+	Table string
+	DDL   string
+}
+
+// schemaDumper returns the objects of the schema, in a stable order.
+type schemaDumper func(ctx context.Context, db *sql.DB, d gorp.Dialect, schema string) ([]*schemaObject, error)
+
+func getSchemaDumper(dialect string) (schemaDumper, error) {
+	switch MigrationDialects[dialect].(type) {
+	case gorp.SqliteDialect:
+		return dumpSqlite, nil
+	case gorp.PostgresDialect:
+		return dumpPostgres, nil
+	case gorp.MySQLDialect:
+		return dumpMySQL, nil
+	default:
+		return nil, fmt.Errorf("Schema dumps are not supported for dialect %s", dialect)
+	}
+}
+
+// queryStrings runs query and returns the rows of its string columns.
+func queryStrings(ctx context.Context, db *sql.DB, query string, args ...interface{}) ([][]string, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	var result [][]string
+	for rows.Next() {
+		row := make([]string, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range row {
+			dest[i] = &row[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+
+// dumpSqlite returns the statements SQLite stored for the tables, indexes,
+// views and triggers of schema, which is an attached database.
+func dumpSqlite(ctx context.Context, db *sql.DB, d gorp.Dialect, schema string) ([]*schemaObject, error) {
+	master := "sqlite_master"
+	if schema != "" {
+		master = d.QuoteField(schema) + ".sqlite_master"
+	}
+
+	rows, err := queryStrings(ctx, db, fmt.Sprintf(`SELECT type, name, tbl_name, sql FROM %s
+		WHERE sql IS NOT NULL AND name NOT LIKE 'sqlite_%%'
+		ORDER BY CASE type WHEN 'table' THEN 0 WHEN 'index' THEN 1 ELSE 2 END, tbl_name, name`, master))
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []*schemaObject
+	for _, row := range rows {
+		objects = append(objects, &schemaObject{
+			Kind:  row[0],
+			Name:  row[1],
+			Table: row[2],
+			DDL:   strings.TrimSuffix(strings.TrimSpace(row[3]), ";"),
+		})
+	}
+	return objects, nil
+}
+
+// dumpPostgres renders the sequences of schema, public by default, its tables
+// with their columns and constraints, the indexes that don't back a
+// constraint and its views.
+func dumpPostgres(ctx context.Context, db *sql.DB, d gorp.Dialect, schema string) ([]*schemaObject, error) {
+	if schema == "" {
+		schema = "public"
+	}
+
+	sequences, err := queryStrings(ctx, db, `SELECT sequence_name, data_type, increment, minimum_value, maximum_value,
+			start_value, CASE WHEN cycle_option = 'YES' THEN ' CYCLE' ELSE '' END
+		FROM information_schema.sequences
+		WHERE sequence_schema = $1
+		ORDER BY sequence_name`, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	columns, err := queryStrings(ctx, db, `SELECT c.relname, a.attname, format_type(a.atttypid, a.atttypmod),
+			CASE WHEN a.attnotnull THEN ' NOT NULL' ELSE '' END,
+			COALESCE(' DEFAULT ' || pg_get_expr(ad.adbin, ad.adrelid), '')
+		FROM pg_attribute a
+		JOIN pg_class c ON c.oid = a.attrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		LEFT JOIN pg_attrdef ad ON ad.adrelid = a.attrelid AND ad.adnum = a.attnum
+		WHERE n.nspname = $1 AND c.relkind IN ('r', 'p') AND a.attnum > 0 AND NOT a.attisdropped
+		ORDER BY c.relname, a.attnum`, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	constraints, err := queryStrings(ctx, db, `SELECT c.relname, con.conname, pg_get_constraintdef(con.oid)
+		FROM pg_constraint con
+		JOIN pg_class c ON c.oid = con.conrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $1
+		ORDER BY c.relname, con.conname`, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	indexes, err := queryStrings(ctx, db, `SELECT i.tablename, i.indexname, i.indexdef FROM pg_indexes i
+		WHERE i.schemaname = $1 AND NOT EXISTS (
+			SELECT 1 FROM pg_constraint con
+			JOIN pg_namespace n ON n.oid = con.connamespace
+			WHERE n.nspname = i.schemaname AND con.conname = i.indexname)
+		ORDER BY i.tablename, i.indexname`, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	views, err := queryStrings(ctx, db, `SELECT viewname, definition FROM pg_views
+		WHERE schemaname = $1
+		ORDER BY viewname`, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	var tables []string
+	definitions := make(map[string][]string)
+	for _, column := range columns {
+		table := column[0]
+		if _, ok := definitions[table]; !ok {
+			tables = append(tables, table)
+		}
+		definitions[table] = append(definitions[table],
+			fmt.Sprintf("%s %s%s%s", d.QuoteField(column[1]), column[2], column[3], column[4]))
+	}
+	for _, constraint := range constraints {
+		table := constraint[0]
+		if _, ok := definitions[table]; ok {
+			definitions[table] = append(definitions[table],
+				fmt.Sprintf("CONSTRAINT %s %s", d.QuoteField(constraint[1]), constraint[2]))
+		}
+	}
+
+	var objects []*schemaObject
+	for _, sequence := range sequences {
+		objects = append(objects, &schemaObject{
+			Kind: "sequence",
+			Name: sequence[0],
+			DDL: fmt.Sprintf("CREATE SEQUENCE %s AS %s INCREMENT BY %s MINVALUE %s MAXVALUE %s START WITH %s%s",
+				d.QuotedTableForQuery(schema, sequence[0]), sequence[1], sequence[2], sequence[3], sequence[4],
+				sequence[5], sequence[6]),
+		})
+	}
+	for _, table := range tables {
+		objects = append(objects, &schemaObject{
+			Kind:  "table",
+			Name:  table,
+			Table: table,
+			DDL: fmt.Sprintf("CREATE TABLE %s (\n    %s\n)",
+				d.QuotedTableForQuery(schema, table), strings.Join(definitions[table], ",\n    ")),
+		})
+	}
+	for _, index := range indexes {
+		objects = append(objects, &schemaObject{Kind: "index", Name: index[1], Table: index[0], DDL: index[2]})
+	}
+	for _, view := range views {
+		objects = append(objects, &schemaObject{
+			Kind: "view",
+			Name: view[0],
+			DDL: fmt.Sprintf("CREATE VIEW %s AS\n%s",
+				d.QuotedTableForQuery(schema, view[0]), strings.TrimSuffix(strings.TrimSpace(view[1]), ";")),
+		})
+	}
+	return objects, nil
+}
+
+var (
+	autoIncrementRegex = regexp.MustCompile(` AUTO_INCREMENT=\d+`)
+	definerRegex       = regexp.MustCompile(` DEFINER=\S+`)
+)
+
+// dumpMySQL returns the CREATE TABLE statements of the tables of schema, the
+// current database by default, without their AUTO_INCREMENT counters,
+// followed by the CREATE VIEW statements of its views, without their definer.
+// MySQL has no sequences, the AUTO_INCREMENT columns are part of the tables.
+func dumpMySQL(ctx context.Context, db *sql.DB, d gorp.Dialect, schema string) ([]*schemaObject, error) {
+	tables, err := queryStrings(ctx, db, `SELECT table_name FROM information_schema.tables
+		WHERE table_schema = COALESCE(NULLIF(?, ''), DATABASE()) AND table_type = 'BASE TABLE'
+		ORDER BY table_name`, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []*schemaObject
+	for _, table := range tables {
+		rows, err := queryStrings(ctx, db, "SHOW CREATE TABLE "+d.QuotedTableForQuery(schema, table[0]))
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			objects = append(objects, &schemaObject{
+				Kind:  "table",
+				Name:  table[0],
+				Table: table[0],
+				DDL:   autoIncrementRegex.ReplaceAllString(row[1], ""),
+			})
+		}
+	}
+
+	views, err := queryStrings(ctx, db, `SELECT table_name FROM information_schema.views
+		WHERE table_schema = COALESCE(NULLIF(?, ''), DATABASE())
+		ORDER BY table_name`, schema)
+	if err != nil {
+		return nil, err
+	}
+	for _, view := range views {
+		rows, err := queryStrings(ctx, db, "SHOW CREATE VIEW "+d.QuotedTableForQuery(schema, view[0]))
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			objects = append(objects, &schemaObject{
+				Kind: "view",
+				Name: view[0],
+				DDL:  definerRegex.ReplaceAllString(row[1], ""),
+			})
+		}
+	}
+	return objects, nil
+}
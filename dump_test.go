@@ -0,0 +1,50 @@
+package migrate
+
+import (
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *SqliteMigrateSuite) TestDumpSchema(c *C) {
+	migrations := &MemoryMigrationSource{
+		Migrations: []*Migration{
+			sqliteMigrations[0],
+			sqliteMigrations[1],
+			&Migration{
+				Id:   "125",
+				Up:   []string{"CREATE INDEX people_first_name ON people (first_name)"},
+				Down: []string{"DROP INDEX people_first_name"},
+			},
+		},
+	}
+
+	ms := MigrationSet{}
+	_, err := ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+
+	var b strings.Builder
+	err = ms.DumpSchema(s.Db, "sqlite3", &b)
+	c.Assert(err, IsNil)
+
+	dump := b.String()
+	c.Assert(strings.HasPrefix(dump, "-- Schema dumped by sql-migrate, do not edit.\n"), Equals, true)
+	c.Assert(strings.Contains(dump, "\nCREATE TABLE people (id int, first_name text);\n"), Equals, true)
+	c.Assert(strings.Contains(dump, "\nCREATE INDEX people_first_name ON people (first_name);\n"), Equals, true)
+	c.Assert(strings.HasSuffix(dump, "\n-- Applied migrations (gorp_migrations):\n-- 123\n-- 124\n-- 125\n"), Equals, true)
+
+	// Tables come before indexes
+	c.Assert(strings.Index(dump, "CREATE TABLE people") < strings.Index(dump, "CREATE INDEX"), Equals, true)
+
+	// Dumps are stable
+	var again strings.Builder
+	c.Assert(ms.DumpSchema(s.Db, "sqlite3", &again), IsNil)
+	c.Assert(again.String(), Equals, dump)
+}
+
+func (s *SqliteMigrateSuite) TestDumpSchemaUnsupportedDialect(c *C) {
+	ms := MigrationSet{}
+	var b strings.Builder
+	err := ms.DumpSchema(s.Db, "mssql", &b)
+	c.Assert(err, ErrorMatches, "Schema dumps are not supported for dialect mssql")
+}
@@ -0,0 +1,220 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"gopkg.in/gorp.v1"
+)
+
+// Hooks are called around the execution of migrations by Exec, ExecMax, ExecTo
+// and their patch mode and context versions. A hook that returns an error
+// aborts the run. Errors from the migration hooks roll back the migration
+// being run, unless transactions are disabled for it, and are returned
+// wrapped in a *TxError.
+//
+// Embed NopHooks to implement only some of them.
+type Hooks interface {
+	// BeforePlan is called before the migrations to run are planned.
+	BeforePlan(ctx context.Context, event *PlanEvent) error
+	// BeforeMigration is called before the statements of a migration run,
+	// inside its transaction.
+	BeforeMigration(ctx context.Context, event *MigrationEvent) error
+	// AfterStatement is called after every statement of a migration.
+	AfterStatement(ctx context.Context, event *StatementEvent) error
+	// AfterMigration is called once a migration and its record update ran,
+	// before its transaction is committed.
+	AfterMigration(ctx context.Context, event *MigrationEvent) error
+	// OnError is called when a migration failed, after its transaction was
+	// rolled back. The executor of the event is the database.
+	OnError(ctx context.Context, event *MigrationEvent, err error)
+}
+
+// NopHooks implements Hooks by doing nothing.
+type NopHooks struct{}
+
+func (NopHooks) BeforePlan(ctx context.Context, event *PlanEvent) error           { return nil }
+func (NopHooks) BeforeMigration(ctx context.Context, event *MigrationEvent) error { return nil }
+func (NopHooks) AfterStatement(ctx context.Context, event *StatementEvent) error  { return nil }
+func (NopHooks) AfterMigration(ctx context.Context, event *MigrationEvent) error  { return nil }
+func (NopHooks) OnError(ctx context.Context, event *MigrationEvent, err error)    {}
+
+// PlanEvent describes a run that is about to be planned.
+type PlanEvent struct {
+	// Direction to migrate in. Unknown until planned when Target is set.
+	Direction MigrationDirection
+	// Max is the maximum number of migrations to run, 0 for no limit.
+	Max int
+	// Target is the migration to migrate to for ExecTo, empty otherwise.
+	Target   string
+	Executor SqlExecutorContext
+}
+
+// MigrationEvent describes a migration being run. Exactly one of Migration
+// and MigrationPatch is set, depending on whether patch mode is enabled.
+type MigrationEvent struct {
+	Migration      *PlannedMigration
+	MigrationPatch *PlannedMigrationPatch
+	Direction      MigrationDirection
+	// Executor is the transaction of the migration, or the database when
+	// transactions are disabled for it.
+	Executor  SqlExecutorContext
+	StartedAt time.Time
+	// Duration is set for AfterMigration and OnError.
+	Duration time.Duration
+}
+
+// Name returns the Id or, in patch mode, the name of the migration.
+func (e *MigrationEvent) Name() string {
+	if e.MigrationPatch != nil {
+		return e.MigrationPatch.Name
+	}
+	return e.Migration.Id
+}
+
+// lines returns the source lines of the statements being run.
+func (e *MigrationEvent) lines() []int {
+	switch {
+	case e.MigrationPatch != nil && e.Direction == Up:
+		return e.MigrationPatch.UpLines
+	case e.MigrationPatch != nil:
+		return e.MigrationPatch.DownLines
+	case e.Direction == Up:
+		return e.Migration.UpLines
+	default:
+		return e.Migration.DownLines
+	}
+}
+
+// StatementEvent describes a statement of a migration that was run.
+type StatementEvent struct {
+	*MigrationEvent
+
+	// Index of the statement among those of the migration.
+	Index  int
+	Query  string
+	Result sql.Result
+	// StartedAt and Duration are those of the statement.
+	StartedAt time.Time
+	Duration  time.Duration
+}
+
+// SetHooks sets the hooks called while migrations are executed.
+func SetHooks(hooks Hooks) {
+	migSet.Hooks = hooks
+}
+
+func (ms MigrationSet) hooks() Hooks {
+	if ms.Hooks == nil {
+		return NopHooks{}
+	}
+	return ms.Hooks
+}
+
+// runMigration runs the statements and function of a migration, followed by
+// record to update the migration table with how long it took, with the hooks
+// called around them. Outside of a transaction, it resumes after the
+// statements that completed in an earlier, failed run.
+func (ms MigrationSet) runMigration(ctx context.Context, db *sql.DB, dbMap *gorp.DbMap, event *MigrationEvent, disableTransaction bool,
+	queries []string, fn MigrationFunc, record func(executor SqlExecutorContext, duration time.Duration) error) error {
+	hooks := ms.hooks()
+
+	ms.log(LogDebug, "Applying migration", "migration", event.Name(), "direction", event.Direction)
+
+	// Statements outside of a transaction take effect right away, so
+	// remember which completed.
+	var progress *progressTracker
+
+	event.StartedAt = time.Now()
+	err := ms.withExecutor(ctx, db, event.Name(), disableTransaction, func(executor SqlExecutorContext) error {
+		event.Executor = executor
+		if err := hooks.BeforeMigration(ctx, event); err != nil {
+			return err
+		}
+
+		skip := 0
+		if disableTransaction && (len(queries) > 0 || fn != nil) {
+			var err error
+			progress, err = ms.trackProgress(ctx, db, dbMap.Dialect, event, queries)
+			if err != nil {
+				return err
+			}
+			progress.hasFunc = fn != nil
+			skip = progress.skip()
+			if skip > 0 {
+				ms.log(LogInfo, "Resuming migration", "migration", event.Name(), "skipped", skip)
+			}
+		}
+
+		afterStatement := func(index int, query string, result sql.Result, startedAt time.Time) error {
+			index += skip
+			if progress != nil {
+				if err := progress.completed(ctx, index+1); err != nil {
+					return err
+				}
+			}
+
+			duration := time.Since(startedAt)
+			ms.log(LogDebug, "Executed statement", "migration", event.Name(), "index", index,
+				"duration", duration, "query", query)
+			return hooks.AfterStatement(ctx, &StatementEvent{
+				MigrationEvent: event,
+				Index:          index,
+				Query:          query,
+				Result:         result,
+				StartedAt:      startedAt,
+				Duration:       duration,
+			})
+		}
+		if err := execMigration(ctx, executor, queries[skip:], fn, afterStatement); err != nil {
+			if stmtErr, ok := err.(*statementError); ok {
+				stmtErr.Index += skip
+			}
+			return err
+		}
+
+		if err := record(executor, time.Since(event.StartedAt)); err != nil {
+			return err
+		}
+		if progress != nil {
+			if err := progress.finish(ctx); err != nil {
+				return err
+			}
+		}
+
+		event.Duration = time.Since(event.StartedAt)
+		return hooks.AfterMigration(ctx, event)
+	})
+	if err != nil {
+		event.Executor = db
+		event.Duration = time.Since(event.StartedAt)
+
+		// Record the failure even when ctx is done, or the migration stays
+		// dirty.
+		if progress != nil {
+			if perr := progress.interrupted(context.Background()); perr != nil {
+				ms.log(LogError, "Recording progress failed", "migration", event.Name(), "error", perr)
+			}
+		}
+
+		// Hooks get the error of the driver, the statement is added by the
+		// returned *TxError.
+		cause := err
+		if stmtErr, ok := err.(*statementError); ok {
+			if lines := event.lines(); stmtErr.Index < len(lines) {
+				stmtErr.Line = lines[stmtErr.Index]
+			}
+			cause = stmtErr.Err
+		}
+
+		ms.log(LogError, "Migration failed", "migration", event.Name(), "direction", event.Direction,
+			"duration", event.Duration, "error", err)
+		hooks.OnError(ctx, event, cause)
+		return err
+	}
+
+	ms.log(LogInfo, "Applied migration", "migration", event.Name(), "direction", event.Direction,
+		"duration", event.Duration)
+	return nil
+}
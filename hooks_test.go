@@ -0,0 +1,156 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	. "gopkg.in/check.v1"
+)
+
+type recordingHooks struct {
+	calls      []string
+	failBefore string
+	failAfter  string
+	errs       []error
+}
+
+func (h *recordingHooks) BeforePlan(ctx context.Context, event *PlanEvent) error {
+	h.calls = append(h.calls, fmt.Sprintf("plan %d", event.Direction))
+	return nil
+}
+
+func (h *recordingHooks) BeforeMigration(ctx context.Context, event *MigrationEvent) error {
+	h.calls = append(h.calls, "before "+event.Name())
+	if event.Name() == h.failBefore {
+		return errors.New("before failed")
+	}
+	return nil
+}
+
+func (h *recordingHooks) AfterStatement(ctx context.Context, event *StatementEvent) error {
+	h.calls = append(h.calls, fmt.Sprintf("statement %s %d", event.Name(), event.Index))
+	return nil
+}
+
+func (h *recordingHooks) AfterMigration(ctx context.Context, event *MigrationEvent) error {
+	h.calls = append(h.calls, "after "+event.Name())
+	if event.Name() == h.failAfter {
+		return errors.New("after failed")
+	}
+	return nil
+}
+
+func (h *recordingHooks) OnError(ctx context.Context, event *MigrationEvent, err error) {
+	h.calls = append(h.calls, "error "+event.Name())
+	h.errs = append(h.errs, err)
+}
+
+func (s *SqliteMigrateSuite) TestHooks(c *C) {
+	migrations := &MemoryMigrationSource{
+		Migrations: sqliteMigrations,
+	}
+
+	hooks := &recordingHooks{}
+	ms := MigrationSet{Hooks: hooks}
+
+	n, err := ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+	c.Assert(hooks.calls, DeepEquals, []string{
+		"plan 0",
+		"before 123",
+		"statement 123 0",
+		"after 123",
+		"before 124",
+		"statement 124 0",
+		"after 124",
+	})
+}
+
+func (s *SqliteMigrateSuite) TestHookErrorRollsBack(c *C) {
+	migrations := &MemoryMigrationSource{
+		Migrations: sqliteMigrations,
+	}
+
+	hooks := &recordingHooks{failAfter: "124"}
+	ms := MigrationSet{Hooks: hooks}
+
+	n, err := ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, FitsTypeOf, &TxError{})
+	c.Assert(err.(*TxError).Err, ErrorMatches, "after failed")
+	c.Assert(n, Equals, 1)
+	c.Assert(hooks.calls[len(hooks.calls)-1], Equals, "error 124")
+	c.Assert(hooks.errs, HasLen, 1)
+
+	// The second migration was rolled back
+	_, err = s.DbMap.Exec("SELECT first_name FROM people")
+	c.Assert(err, Not(IsNil))
+	records, err := ms.GetMigrationRecords(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 1)
+
+	hooks = &recordingHooks{failBefore: "124"}
+	ms.Hooks = hooks
+	_, err = ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, FitsTypeOf, &TxError{})
+	c.Assert(hooks.calls, DeepEquals, []string{"plan 0", "before 124", "error 124"})
+}
+
+func (s *SqliteMigrateSuite) TestHooksPatch(c *C) {
+	migrations := &MemoryMigrationSource{
+		MigrationsPatch: []*MigrationPatch{
+			{
+				Name: "0001_00_initial.sql",
+				Up:   []string{"CREATE TABLE people (id int)"},
+				Down: []string{"DROP TABLE people"},
+			},
+			{
+				Name: "0002_00_second.sql",
+				Up:   []string{"CREATE TABLE balance (id int, balance int)"},
+				Down: []string{"DROP TABLE balance"},
+			},
+		},
+	}
+
+	hooks := &recordingHooks{}
+	ms := MigrationSet{EnablePatchMode: true, Hooks: hooks}
+
+	n, err := ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+	c.Assert(hooks.calls, DeepEquals, []string{
+		"plan 0",
+		"before 0001_00_initial.sql",
+		"statement 0001_00_initial.sql 0",
+		"after 0001_00_initial.sql",
+		"before 0002_00_second.sql",
+		"statement 0002_00_second.sql 0",
+		"after 0002_00_second.sql",
+	})
+}
+
+func (s *SqliteMigrateSuite) TestHooksExecTo(c *C) {
+	migrations := &MemoryMigrationSource{
+		Migrations: sqliteMigrations,
+	}
+
+	hooks := &recordingHooks{}
+	ms := MigrationSet{Hooks: hooks}
+
+	n, err := ms.ExecTo(s.Db, "sqlite3", migrations, "124")
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+
+	// Migrating down to a target runs the hooks as well
+	hooks.calls = nil
+	n, err = ms.ExecTo(s.Db, "sqlite3", migrations, "123")
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+	c.Assert(hooks.calls, DeepEquals, []string{
+		"plan 0",
+		"before 124",
+		"statement 124 0",
+		"after 124",
+	})
+}
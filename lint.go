@@ -0,0 +1,299 @@
+package migrate
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// LintRule names a check of Lint.
+type LintRule string
+
+const (
+	// LintEmptyDown reports migrations that can't be rolled back because
+	// their Down section is empty.
+	LintEmptyDown LintRule = "empty-down"
+	// LintNoTransactionStatements reports notransaction sections with
+	// several statements, of which the first stay applied when a later one
+	// fails.
+	LintNoTransactionStatements LintRule = "notransaction-statements"
+	// LintIndexNotConcurrent reports Postgres indexes on big tables that are
+	// created without CONCURRENTLY, which blocks writes to the table.
+	LintIndexNotConcurrent LintRule = "index-not-concurrently"
+	// LintDestructiveUp reports DROP TABLE and DROP COLUMN in Up sections.
+	LintDestructiveUp LintRule = "destructive-up"
+	// LintMixedIds reports non-numeric ids among numeric ones, as they sort
+	// after all numeric ids whatever their name.
+	LintMixedIds LintRule = "mixed-ids"
+)
+
+// LintRules are all rules checked by Lint.
+var LintRules = []LintRule{
+	LintEmptyDown,
+	LintNoTransactionStatements,
+	LintIndexNotConcurrent,
+	LintDestructiveUp,
+	LintMixedIds,
+}
+
+// Validate returns an error for an unknown rule.
+func (r LintRule) Validate() error {
+	for _, rule := range LintRules {
+		if r == rule {
+			return nil
+		}
+	}
+	return fmt.Errorf("Unknown lint rule %q", string(r))
+}
+
+// LintConfig configures Lint.
+type LintConfig struct {
+	// Disabled rules are not checked.
+	Disabled []LintRule
+	// BigTables are the tables on which Postgres indexes have to be created
+	// concurrently, optionally qualified with their schema.
+	BigTables []string
+}
+
+func (c LintConfig) enabled(rule LintRule) bool {
+	for _, disabled := range c.Disabled {
+		if disabled == rule {
+			return false
+		}
+	}
+	return true
+}
+
+// LintIssue is a problem found by Lint.
+type LintIssue struct {
+	Migration string   `json:"migration"`
+	Rule      LintRule `json:"rule"`
+	// Line is the line of the statement the issue is about, 0 when it is
+	// about the whole migration or the line is unknown.
+	Line    int    `json:"line,omitempty"`
+	Message string `json:"message"`
+}
+
+func (i *LintIssue) String() string {
+	if i.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s (%s)", i.Migration, i.Line, i.Message, i.Rule)
+	}
+	return fmt.Sprintf("%s: %s (%s)", i.Migration, i.Message, i.Rule)
+}
+
+// Lint migrations
+//
+// Checks the migrations of m, as parsed for dialect, for problems that
+// would only show when they run against a database. Returns the issues
+// found, in the order of the migrations.
+func Lint(m MigrationSource, dialect string, config LintConfig) ([]*LintIssue, error) {
+	return migSet.Lint(m, dialect, config)
+}
+
+func (ms MigrationSet) Lint(m MigrationSource, dialect string, config LintConfig) ([]*LintIssue, error) {
+	for _, rule := range config.Disabled {
+		if err := rule.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	var migrations []*lintMigration
+	if ms.EnablePatchMode {
+		all, err := ms.findAllMigrationsPatch(m, dialect)
+		if err != nil {
+			return nil, err
+		}
+		for _, migration := range all {
+			migrations = append(migrations, &lintMigration{
+				name:        migration.Name,
+				up:          migration.Up,
+				upLines:     migration.UpLines,
+				hasDown:     len(migration.Down) > 0 || migration.DownFunc != nil,
+				noTxUp:      migration.DisableTransactionUp,
+				noTxDown:    migration.DisableTransactionDown,
+				down:        migration.Down,
+				downLines:   migration.DownLines,
+				repeatable:  migration.Repeatable,
+				numericName: true,
+			})
+		}
+	} else {
+		all, err := ms.findAllMigrations(m, dialect)
+		if err != nil {
+			return nil, err
+		}
+		for _, migration := range all {
+			migrations = append(migrations, &lintMigration{
+				name:        migration.Id,
+				up:          migration.Up,
+				upLines:     migration.UpLines,
+				hasDown:     len(migration.Down) > 0 || migration.DownFunc != nil,
+				noTxUp:      migration.DisableTransactionUp,
+				noTxDown:    migration.DisableTransactionDown,
+				down:        migration.Down,
+				downLines:   migration.DownLines,
+				repeatable:  migration.Repeatable,
+				numericName: migration.isNumeric(),
+			})
+		}
+	}
+
+	l := &linter{config: config, dialect: dialect}
+	l.lint(migrations)
+	return l.issues, nil
+}
+
+// lintMigration holds what Lint checks of a Migration or MigrationPatch.
+type lintMigration struct {
+	name       string
+	up         []string
+	upLines    []int
+	down       []string
+	downLines  []int
+	hasDown    bool
+	noTxUp     bool
+	noTxDown   bool
+	repeatable bool
+
+	numericName bool
+}
+
+type linter struct {
+	config  LintConfig
+	dialect string
+	issues  []*LintIssue
+}
+
+func (l *linter) report(migration *lintMigration, rule LintRule, line int, format string, args ...interface{}) {
+	if !l.config.enabled(rule) {
+		return
+	}
+	l.issues = append(l.issues, &LintIssue{
+		Migration: migration.name,
+		Rule:      rule,
+		Line:      line,
+		Message:   fmt.Sprintf(format, args...),
+	})
+}
+
+func (l *linter) lint(migrations []*lintMigration) {
+	numeric := false
+	for _, migration := range migrations {
+		if !migration.repeatable && migration.numericName {
+			numeric = true
+		}
+	}
+
+	for _, migration := range migrations {
+		if migration.repeatable {
+			continue
+		}
+
+		if numeric && !migration.numericName {
+			l.report(migration, LintMixedIds, 0, "id doesn't start with a number, so it sorts after all numbered migrations")
+		}
+
+		if !migration.hasDown {
+			l.report(migration, LintEmptyDown, 0, "Down section is empty, so the migration can't be rolled back")
+		}
+
+		if migration.noTxUp && len(migration.up) > 1 {
+			l.report(migration, LintNoTransactionStatements, lineOf(migration.upLines, 0),
+				"notransaction Up section has %d statements, when one fails those before it stay applied", len(migration.up))
+		}
+		if migration.noTxDown && len(migration.down) > 1 {
+			l.report(migration, LintNoTransactionStatements, lineOf(migration.downLines, 0),
+				"notransaction Down section has %d statements, when one fails those before it stay applied", len(migration.down))
+		}
+
+		for i, stmt := range migration.up {
+			stmt = stripComments(stmt)
+			line := lineOf(migration.upLines, i)
+
+			if dropTableRegex.MatchString(stmt) {
+				l.report(migration, LintDestructiveUp, line, "DROP TABLE in Up loses data")
+			}
+			if dropsColumn(stmt) {
+				l.report(migration, LintDestructiveUp, line, "DROP COLUMN in Up loses data")
+			}
+
+			if l.dialect == "postgres" {
+				match := createIndexRegex.FindStringSubmatch(stmt)
+				if match != nil && match[1] == "" && l.bigTable(match[2]) {
+					l.report(migration, LintIndexNotConcurrent, line,
+						"CREATE INDEX on big table %s without CONCURRENTLY blocks writes to it", match[2])
+				}
+			}
+		}
+	}
+}
+
+var (
+	dropTableRegex   = regexp.MustCompile(`(?is)^DROP\s+TABLE\b`)
+	alterTableRegex  = regexp.MustCompile(`(?is)^ALTER\s+TABLE\s+(?:IF\s+EXISTS\s+)?(?:ONLY\s+)?\S+\s+(.*)$`)
+	dropColumnRegex  = regexp.MustCompile(`(?is)^DROP\s+(COLUMN\s+)?(\w+)`)
+	createIndexRegex = regexp.MustCompile(`(?is)^CREATE\s+(?:UNIQUE\s+)?INDEX\s+(CONCURRENTLY\s+)?.*?\bON\s+(?:ONLY\s+)?([^\s(]+)`)
+)
+
+// alterDropKeywords are the words after ALTER TABLE ... DROP that drop
+// something else than a column, which may be dropped without the COLUMN
+// keyword.
+var alterDropKeywords = map[string]bool{
+	"CONSTRAINT": true,
+	"INDEX":      true,
+	"KEY":        true,
+	"PRIMARY":    true,
+	"FOREIGN":    true,
+	"UNIQUE":     true,
+	"CHECK":      true,
+	"DEFAULT":    true,
+	"PARTITION":  true,
+}
+
+// dropsColumn reports whether stmt is an ALTER TABLE statement of which one of
+// the comma separated actions drops a column.
+func dropsColumn(stmt string) bool {
+	match := alterTableRegex.FindStringSubmatch(stmt)
+	if match == nil {
+		return false
+	}
+	for _, action := range strings.Split(match[1], ",") {
+		drop := dropColumnRegex.FindStringSubmatch(strings.TrimSpace(action))
+		if drop != nil && (drop[1] != "" || !alterDropKeywords[strings.ToUpper(drop[2])]) {
+			return true
+		}
+	}
+	return false
+}
+
+// bigTable reports whether table, as written in a statement, is one of the
+// configured big tables.
+func (l *linter) bigTable(table string) bool {
+	table = strings.ToLower(strings.Replace(table, `"`, "", -1))
+	unqualified := table[strings.LastIndex(table, ".")+1:]
+	for _, big := range l.config.BigTables {
+		big = strings.ToLower(big)
+		if big == table || big == unqualified {
+			return true
+		}
+	}
+	return false
+}
+
+func lineOf(lines []int, i int) int {
+	if i < len(lines) {
+		return lines[i]
+	}
+	return 0
+}
+
+// stripComments removes the comment lines of a statement.
+func stripComments(stmt string) string {
+	var lines []string
+	for _, line := range strings.Split(stmt, "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "--") {
+			lines = append(lines, line)
+		}
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
@@ -0,0 +1,84 @@
+package migrate
+
+import (
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+var lintMigrations = []string{
+	"1_people.sql", `-- +migrate Up
+CREATE TABLE people (id int);
+-- +migrate Down
+DROP TABLE people;
+`,
+	"2_index.sql", `-- +migrate Up
+CREATE INDEX people_id ON people (id);
+CREATE INDEX CONCURRENTLY people_id2 ON "people" (id);
+-- +migrate Down
+`,
+	"3_notransaction.sql", `-- +migrate Up notransaction
+CREATE INDEX CONCURRENTLY pets_id ON pets (id);
+ALTER TABLE people DROP COLUMN name;
+-- +migrate Down
+SELECT 1;
+`,
+	"4_drop.sql", `-- +migrate Up
+ALTER TABLE people DROP age;
+ALTER TABLE people DROP CONSTRAINT people_pkey;
+ALTER TABLE people ADD COLUMN nickname text, DROP COLUMN name;
+-- +migrate Down
+SELECT 1;
+`,
+	"seed.sql", `-- +migrate Up
+INSERT INTO people (id) VALUES (1);
+-- +migrate Down
+DELETE FROM people;
+`,
+}
+
+func lintSource(c *C) *MemoryMigrationSource {
+	source := &MemoryMigrationSource{}
+	for i := 0; i < len(lintMigrations); i += 2 {
+		migration, err := ParseMigration(lintMigrations[i], strings.NewReader(lintMigrations[i+1]))
+		c.Assert(err, IsNil)
+		source.Migrations = append(source.Migrations, migration)
+	}
+	return source
+}
+
+func (s *SqliteMigrateSuite) TestLint(c *C) {
+	ms := MigrationSet{}
+	issues, err := ms.Lint(lintSource(c), "postgres", LintConfig{BigTables: []string{"people"}})
+	c.Assert(err, IsNil)
+
+	var found []string
+	for _, issue := range issues {
+		found = append(found, issue.String())
+	}
+	c.Assert(found, DeepEquals, []string{
+		"2_index.sql: Down section is empty, so the migration can't be rolled back (empty-down)",
+		"2_index.sql:2: CREATE INDEX on big table people without CONCURRENTLY blocks writes to it (index-not-concurrently)",
+		"3_notransaction.sql:2: notransaction Up section has 2 statements, when one fails those before it stay applied (notransaction-statements)",
+		"3_notransaction.sql:3: DROP COLUMN in Up loses data (destructive-up)",
+		"4_drop.sql:2: DROP COLUMN in Up loses data (destructive-up)",
+		"4_drop.sql:4: DROP COLUMN in Up loses data (destructive-up)",
+		"seed.sql: id doesn't start with a number, so it sorts after all numbered migrations (mixed-ids)",
+	})
+}
+
+func (s *SqliteMigrateSuite) TestLintConfig(c *C) {
+	ms := MigrationSet{}
+
+	// Indexes are only checked for Postgres
+	issues, err := ms.Lint(lintSource(c), "sqlite3", LintConfig{
+		BigTables: []string{"people"},
+		Disabled:  []LintRule{LintEmptyDown, LintMixedIds, LintDestructiveUp},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(issues, HasLen, 1)
+	c.Assert(issues[0].Rule, Equals, LintNoTransactionStatements)
+
+	_, err = ms.Lint(lintSource(c), "sqlite3", LintConfig{Disabled: []LintRule{"unknown"}})
+	c.Assert(err, ErrorMatches, `Unknown lint rule "unknown"`)
+}
@@ -0,0 +1,306 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/gorp.v1"
+)
+
+// LockPollInterval is how often an unavailable migration lock is retried.
+var LockPollInterval = 500 * time.Millisecond
+
+// LockError is returned when the migration lock could not be acquired within
+// MigrationSet.LockTimeout, usually because another process is migrating the
+// same database.
+type LockError struct {
+	LockName string
+	Timeout  time.Duration
+}
+
+func (e *LockError) Error() string {
+	return fmt.Sprintf("Unable to acquire migration lock %s within %s", e.LockName, e.Timeout)
+}
+
+// SetLockTimeout sets how long to wait for the migration lock. Zero waits
+// until the lock is available.
+func SetLockTimeout(d time.Duration) {
+	migSet.LockTimeout = d
+}
+
+// EnableLocking makes Exec, ExecMax and SkipMax hold the migration lock while
+// they run.
+func EnableLocking(v bool) {
+	migSet.EnableLocking = v
+}
+
+// A MigrationLock is a held migration lock. It must be released with Unlock.
+type MigrationLock struct {
+	name   string
+	locker dialectLocker
+}
+
+// Unlock releases the lock.
+func (l *MigrationLock) Unlock() error {
+	if l == nil {
+		return nil
+	}
+	return l.locker.unlock(context.Background())
+}
+
+// dialectLocker takes a named lock in a dialect specific way. tryLock must not
+// block: it reports whether the lock was taken.
+type dialectLocker interface {
+	tryLock(ctx context.Context) (bool, error)
+	unlock(ctx context.Context) error
+}
+
+// Lock acquires the migration lock of the default migration table, waiting at
+// most LockTimeout for it.
+func Lock(db *sql.DB, dialect string) (*MigrationLock, error) {
+	return migSet.Lock(db, dialect)
+}
+
+// LockContext acquires the migration lock with a context.
+func LockContext(ctx context.Context, db *sql.DB, dialect string) (*MigrationLock, error) {
+	return migSet.LockContext(ctx, db, dialect)
+}
+
+func (ms MigrationSet) Lock(db *sql.DB, dialect string) (*MigrationLock, error) {
+	return ms.LockContext(context.Background(), db, dialect)
+}
+
+// LockContext acquires the migration lock of the migration set. Processes that
+// migrate the same table (and schema) of the same database exclude each other.
+//
+// Postgres uses advisory locks, MySQL GET_LOCK and MSSQL sp_getapplock; these
+// are bound to a connection that is held until Unlock and are released by the
+// database if the process dies. Other dialects insert a row into a
+// <table>_lock table, which has to be deleted by hand if a process crashes
+// while holding it.
+func (ms MigrationSet) LockContext(ctx context.Context, db *sql.DB, dialect string) (*MigrationLock, error) {
+	d, ok := MigrationDialects[dialect]
+	if !ok {
+		return nil, fmt.Errorf("Unknown dialect: %s", dialect)
+	}
+
+	name := ms.lockName()
+	locker, err := ms.newDialectLocker(ctx, db, dialect, d, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var deadline <-chan time.Time
+	if ms.LockTimeout > 0 {
+		timer := time.NewTimer(ms.LockTimeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	for {
+		locked, err := locker.tryLock(ctx)
+		if err != nil {
+			_ = locker.unlock(context.Background())
+			return nil, err
+		}
+		if locked {
+			return &MigrationLock{name: name, locker: locker}, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			_ = locker.unlock(context.Background())
+			return nil, ctx.Err()
+		case <-deadline:
+			_ = locker.unlock(context.Background())
+			return nil, &LockError{LockName: name, Timeout: ms.LockTimeout}
+		case <-time.After(LockPollInterval):
+		}
+	}
+}
+
+// lockIfEnabled takes the migration lock when EnableLocking is set. The
+// returned lock may be nil, which is safe to Unlock.
+func (ms MigrationSet) lockIfEnabled(ctx context.Context, db *sql.DB, dialect string) (*MigrationLock, error) {
+	if !ms.EnableLocking {
+		return nil, nil
+	}
+	return ms.LockContext(ctx, db, dialect)
+}
+
+func (ms MigrationSet) lockName() string {
+	if ms.SchemaName != "" {
+		return fmt.Sprintf("sql-migrate:%s.%s", ms.SchemaName, ms.getTableName())
+	}
+	return "sql-migrate:" + ms.getTableName()
+}
+
+func (ms MigrationSet) newDialectLocker(ctx context.Context, db *sql.DB, dialect string, d gorp.Dialect, name string) (dialectLocker, error) {
+	switch dialect {
+	case "postgres", "mysql", "mssql":
+		// Session level locks belong to the connection that took them.
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return &sessionLocker{conn: conn, dialect: dialect, bind: d.BindVar(0), name: name}, nil
+	default:
+		return ms.newTableLocker(ctx, db, dialect, d)
+	}
+}
+
+// sessionLocker uses the advisory lock functions of the database.
+type sessionLocker struct {
+	conn    *sql.Conn
+	dialect string
+	bind    string
+	name    string
+	key     interface{}
+	locked  bool
+}
+
+func (l *sessionLocker) tryLock(ctx context.Context) (bool, error) {
+	var err error
+	switch l.dialect {
+	case "postgres":
+		l.key = lockKey(l.name)
+		err = l.conn.QueryRowContext(ctx, fmt.Sprintf("SELECT pg_try_advisory_lock(%s)", l.bind), l.key).Scan(&l.locked)
+	case "mysql":
+		if l.key == nil {
+			// Lock names are server wide and at most 64 characters long.
+			var database string
+			if err := l.conn.QueryRowContext(ctx, "SELECT COALESCE(DATABASE(), '')").Scan(&database); err != nil {
+				return false, err
+			}
+			name := database + "." + l.name
+			if len(name) > 64 {
+				name = fmt.Sprintf("sql-migrate:%x", lockKey(name))
+			}
+			l.key = name
+		}
+		var result sql.NullInt64
+		err = l.conn.QueryRowContext(ctx, fmt.Sprintf("SELECT GET_LOCK(%s, 0)", l.bind), l.key).Scan(&result)
+		l.locked = result.Valid && result.Int64 == 1
+	case "mssql":
+		l.key = l.name
+		var result int
+		err = l.conn.QueryRowContext(ctx, fmt.Sprintf(`DECLARE @result int;
+EXEC @result = sp_getapplock @Resource = %s, @LockMode = 'Exclusive', @LockOwner = 'Session', @LockTimeout = 0;
+SELECT @result`, l.bind), l.key).Scan(&result)
+		l.locked = err == nil && result >= 0
+	}
+	return l.locked, err
+}
+
+func (l *sessionLocker) unlock(ctx context.Context) error {
+	defer func() { _ = l.conn.Close() }()
+
+	if !l.locked {
+		return nil
+	}
+	l.locked = false
+
+	var err error
+	switch l.dialect {
+	case "postgres":
+		_, err = l.conn.ExecContext(ctx, fmt.Sprintf("SELECT pg_advisory_unlock(%s)", l.bind), l.key)
+	case "mysql":
+		_, err = l.conn.ExecContext(ctx, fmt.Sprintf("SELECT RELEASE_LOCK(%s)", l.bind), l.key)
+	case "mssql":
+		_, err = l.conn.ExecContext(ctx, fmt.Sprintf("EXEC sp_releaseapplock @Resource = %s, @LockOwner = 'Session'", l.bind), l.key)
+	}
+	return err
+}
+
+func lockKey(name string) int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(name))
+	return int64(h.Sum64())
+}
+
+type migrationLockRecord struct {
+	Id       int       `db:"id"`
+	LockedAt time.Time `db:"locked_at"`
+	LockedBy string    `db:"locked_by"`
+}
+
+// tableLocker holds the lock by owning the single row of a lock table.
+type tableLocker struct {
+	db     *sql.DB
+	dbMap  *gorp.DbMap
+	table  string
+	locked bool
+}
+
+func (ms MigrationSet) newTableLocker(ctx context.Context, db *sql.DB, dialect string, d gorp.Dialect) (dialectLocker, error) {
+	dbMap := &gorp.DbMap{Db: db, Dialect: d}
+	tableName := ms.getTableName() + "_lock"
+	dbMap.AddTableWithNameAndSchema(migrationLockRecord{}, ms.SchemaName, tableName).SetKeys(false, "Id")
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	err := dbMap.CreateTablesIfNotExists()
+	if err != nil {
+		// Oracle database does not support `if not exists`, so use `ORA-00955:` error code
+		// to check if the table exists.
+		if !((dialect == "oci8" || dialect == "godror") && strings.Contains(err.Error(), "ORA-00955:")) {
+			return nil, err
+		}
+	}
+
+	return &tableLocker{
+		db:    db,
+		dbMap: dbMap,
+		table: d.QuotedTableForQuery(ms.SchemaName, tableName),
+	}, nil
+}
+
+func (l *tableLocker) lockHeld(ctx context.Context) (bool, error) {
+	var count int64
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s = 1", l.table, l.dbMap.Dialect.QuoteField("id"))
+	if err := l.db.QueryRowContext(ctx, query).Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (l *tableLocker) tryLock(ctx context.Context) (bool, error) {
+	held, err := l.lockHeld(ctx)
+	if err != nil || held {
+		return false, err
+	}
+
+	owner, _ := os.Hostname()
+	owner = fmt.Sprintf("%s:%d", owner, os.Getpid())
+
+	query := insertQuery(l.dbMap.Dialect, l.table, []string{"id", "locked_at", "locked_by"})
+	_, err = l.db.ExecContext(ctx, query, 1, time.Now(), owner)
+	if err != nil {
+		// Lost the race against another process: the primary key stops the
+		// second insert.
+		if held, heldErr := l.lockHeld(ctx); heldErr == nil && held {
+			return false, nil
+		}
+		return false, err
+	}
+
+	l.locked = true
+	return true, nil
+}
+
+func (l *tableLocker) unlock(ctx context.Context) error {
+	if !l.locked {
+		return nil
+	}
+	l.locked = false
+
+	_, err := l.db.ExecContext(ctx, deleteQuery(l.dbMap.Dialect, l.table, "id"), 1)
+	return err
+}
@@ -0,0 +1,96 @@
+package migrate
+
+import (
+	"context"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *SqliteMigrateSuite) TestLock(c *C) {
+	ms := MigrationSet{LockTimeout: 10 * time.Millisecond}
+
+	lock, err := ms.Lock(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+
+	// Held, so a second attempt times out
+	_, err = ms.Lock(s.Db, "sqlite3")
+	c.Assert(err, FitsTypeOf, &LockError{})
+	c.Assert(err.(*LockError).LockName, Equals, "sql-migrate:gorp_migrations")
+
+	// Another migration table has its own lock
+	other, err := MigrationSet{TableName: "other_migrations"}.Lock(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(other.Unlock(), IsNil)
+
+	c.Assert(lock.Unlock(), IsNil)
+
+	lock, err = ms.Lock(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(lock.Unlock(), IsNil)
+}
+
+func (s *SqliteMigrateSuite) TestLockCancelled(c *C) {
+	ms := MigrationSet{}
+
+	lock, err := ms.Lock(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	defer func() { _ = lock.Unlock() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = ms.LockContext(ctx, s.Db, "sqlite3")
+	c.Assert(err, Equals, context.DeadlineExceeded)
+}
+
+func (s *SqliteMigrateSuite) TestExecWithLocking(c *C) {
+	migrations := &MemoryMigrationSource{
+		Migrations: sqliteMigrations[:1],
+	}
+
+	ms := MigrationSet{EnableLocking: true, LockTimeout: 10 * time.Millisecond}
+
+	lock, err := ms.Lock(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+
+	// Can't run while another process holds the lock
+	n, err := ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, FitsTypeOf, &LockError{})
+	c.Assert(n, Equals, 0)
+
+	n, err = ms.SkipMax(s.Db, "sqlite3", migrations, Up, 0)
+	c.Assert(err, FitsTypeOf, &LockError{})
+	c.Assert(n, Equals, 0)
+
+	c.Assert(lock.Unlock(), IsNil)
+
+	n, err = ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+
+	// The lock was released again
+	count, err := s.DbMap.SelectInt("SELECT COUNT(*) FROM gorp_migrations_lock")
+	c.Assert(err, IsNil)
+	c.Assert(count, Equals, int64(0))
+}
+
+func (s *SqliteMigrateSuite) TestExecWithLockingPatch(c *C) {
+	migrations := &MemoryMigrationSource{
+		MigrationsPatch: sqliteMigrationsPatch[:1],
+	}
+
+	ms := MigrationSet{EnablePatchMode: true, EnableLocking: true, LockTimeout: 10 * time.Millisecond}
+
+	lock, err := ms.Lock(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+
+	n, err := ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, FitsTypeOf, &LockError{})
+	c.Assert(n, Equals, 0)
+
+	c.Assert(lock.Unlock(), IsNil)
+
+	n, err = ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+}
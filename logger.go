@@ -0,0 +1,135 @@
+package migrate
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// LogLevel is the severity of a log message.
+type LogLevel int
+
+const (
+	LogDebug LogLevel = iota
+	LogInfo
+	LogWarn
+	LogError
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LogDebug:
+		return "DEBUG"
+	case LogInfo:
+		return "INFO"
+	case LogWarn:
+		return "WARN"
+	case LogError:
+		return "ERROR"
+	default:
+		return fmt.Sprintf("LogLevel(%d)", int(l))
+	}
+}
+
+// Logger receives what happens while migrations are planned and run: plan
+// decisions and applied migrations at info level, every statement with its
+// duration and every commit and rollback at debug level, failed migrations at
+// error level. keyvals are alternating keys and values.
+type Logger interface {
+	Log(level LogLevel, msg string, keyvals ...interface{})
+}
+
+// SetLogger sets the logger of the library. It logs nothing by default.
+func SetLogger(logger Logger) {
+	migSet.Logger = logger
+}
+
+// NewStdLogger returns a Logger that writes messages of at least level to l,
+// or to the standard error when l is nil.
+func NewStdLogger(l *log.Logger, level LogLevel) Logger {
+	if l == nil {
+		l = log.New(os.Stderr, "", log.LstdFlags)
+	}
+	return &stdLogger{logger: l, level: level}
+}
+
+type stdLogger struct {
+	logger *log.Logger
+	level  LogLevel
+}
+
+func (l *stdLogger) Log(level LogLevel, msg string, keyvals ...interface{}) {
+	if level < l.level {
+		return
+	}
+	l.logger.Printf("sql-migrate: %s %s", level, formatLog(msg, keyvals))
+}
+
+// LevelledLogger is implemented by loggers with a method per level, such as
+// logrus.
+type LevelledLogger interface {
+	Debug(args ...interface{})
+	Info(args ...interface{})
+	Warn(args ...interface{})
+	Error(args ...interface{})
+}
+
+// NewLevelledLogger returns a Logger that passes messages on to the method of
+// l for their level. Filtering by level is left to l.
+func NewLevelledLogger(l LevelledLogger) Logger {
+	return &levelledLogger{logger: l}
+}
+
+type levelledLogger struct {
+	logger LevelledLogger
+}
+
+func (l *levelledLogger) Log(level LogLevel, msg string, keyvals ...interface{}) {
+	line := formatLog(msg, keyvals)
+	switch level {
+	case LogDebug:
+		l.logger.Debug(line)
+	case LogInfo:
+		l.logger.Info(line)
+	case LogWarn:
+		l.logger.Warn(line)
+	default:
+		l.logger.Error(line)
+	}
+}
+
+// formatLog appends keyvals to msg as key=value pairs, quoting values that
+// contain spaces.
+func formatLog(msg string, keyvals []interface{}) string {
+	var b strings.Builder
+	b.WriteString(msg)
+	for i := 0; i < len(keyvals); i += 2 {
+		var value interface{} = "(missing)"
+		if i+1 < len(keyvals) {
+			value = keyvals[i+1]
+		}
+
+		s := fmt.Sprint(value)
+		if strings.ContainsAny(s, " \t\n\"") {
+			s = fmt.Sprintf("%q", s)
+		}
+		fmt.Fprintf(&b, " %v=%s", keyvals[i], s)
+	}
+	return b.String()
+}
+
+func (ms MigrationSet) log(level LogLevel, msg string, keyvals ...interface{}) {
+	if ms.Logger != nil {
+		ms.Logger.Log(level, msg, keyvals...)
+	}
+}
+
+// gorpLogger passes the statements traced by gorp on to a Logger.
+type gorpLogger struct {
+	logger Logger
+}
+
+func (l gorpLogger) Printf(format string, v ...interface{}) {
+	l.logger.Log(LogDebug, strings.TrimSpace(fmt.Sprintf(format, v...)))
+}
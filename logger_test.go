@@ -0,0 +1,105 @@
+package migrate
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type LoggerSuite struct{}
+
+var _ = Suite(&LoggerSuite{})
+
+func (s *LoggerSuite) TestStdLogger(c *C) {
+	var buf bytes.Buffer
+	logger := NewStdLogger(log.New(&buf, "", 0), LogInfo)
+
+	logger.Log(LogDebug, "Hidden")
+	logger.Log(LogInfo, "Applied migration", "migration", "1_initial.sql", "query", "SELECT 1")
+	logger.Log(LogError, "Odd", "key")
+
+	c.Assert(buf.String(), Equals, `sql-migrate: INFO Applied migration migration=1_initial.sql query="SELECT 1"
+sql-migrate: ERROR Odd key=(missing)
+`)
+}
+
+type testLevelledLogger struct {
+	lines []string
+}
+
+func (l *testLevelledLogger) Debug(args ...interface{}) { l.log("debug", args) }
+func (l *testLevelledLogger) Info(args ...interface{})  { l.log("info", args) }
+func (l *testLevelledLogger) Warn(args ...interface{})  { l.log("warn", args) }
+func (l *testLevelledLogger) Error(args ...interface{}) { l.log("error", args) }
+
+func (l *testLevelledLogger) log(level string, args []interface{}) {
+	l.lines = append(l.lines, level+": "+fmt.Sprint(args...))
+}
+
+func (s *LoggerSuite) TestLevelledLogger(c *C) {
+	l := &testLevelledLogger{}
+	logger := NewLevelledLogger(l)
+
+	logger.Log(LogDebug, "Committed transaction", "migration", "123")
+	logger.Log(LogWarn, "Changed", "migration", "124")
+
+	c.Assert(l.lines, DeepEquals, []string{
+		"debug: Committed transaction migration=123",
+		"warn: Changed migration=124",
+	})
+}
+
+func (s *SqliteMigrateSuite) TestLogger(c *C) {
+	migrations := &MemoryMigrationSource{
+		Migrations: []*Migration{
+			sqliteMigrations[0],
+			&Migration{
+				Id:   "125",
+				Up:   []string{"CREATE TABLE pets (id int)"},
+				Down: []string{"DROP TABLE pets"},
+			},
+		},
+	}
+
+	l := &testLevelledLogger{}
+	ms := MigrationSet{Logger: NewLevelledLogger(l)}
+	_, err := ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+
+	joined := strings.Join(l.lines, "\n")
+	c.Assert(joined, Matches, `(?s).*debug: Executed statement migration=123 index=0 duration=\S+ query="CREATE TABLE people \(id int\)".*`)
+	c.Assert(joined, Matches, `(?s).*debug: Committed transaction migration=125.*`)
+	c.Assert(joined, Matches, `(?s).*info: Applied migration migration=125 direction=up.*`)
+
+	// A catch-up migration
+	migrations.Migrations = []*Migration{migrations.Migrations[0], sqliteMigrations[1], migrations.Migrations[1]}
+	l.lines = nil
+	_, err = ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+	c.Assert(strings.Join(l.lines, "\n"), Matches,
+		`(?s).*info: Catching up on migration older than the last applied one migration=124 last_applied=125.*`)
+
+	// A failing one is rolled back
+	migrations.Migrations = append(migrations.Migrations, &Migration{
+		Id:   "126",
+		Up:   []string{"CREATE TABLE pets (id int)"},
+		Down: []string{"SELECT 0"},
+	})
+	l.lines = nil
+	_, err = ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, NotNil)
+	joined = strings.Join(l.lines, "\n")
+	c.Assert(joined, Matches, `(?s).*debug: Rolled back transaction migration=126.*`)
+	c.Assert(joined, Matches, `(?s).*error: Migration failed migration=126 direction=up.*`)
+
+	// Unknown migrations in the database
+	ms.IgnoreUnknown = true
+	migrations.Migrations = migrations.Migrations[:1]
+	l.lines = nil
+	_, _, err = ms.PlanMigration(s.Db, "sqlite3", migrations, Up, 0)
+	c.Assert(err, IsNil)
+	c.Assert(strings.Join(l.lines, "\n"), Matches, `(?s).*info: Ignoring unknown migration in database migration=124.*`)
+}
@@ -2,6 +2,7 @@ package migrate
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -27,9 +28,22 @@ const (
 	Down
 )
 
+func (d MigrationDirection) String() string {
+	if d == Down {
+		return "down"
+	}
+	return "up"
+}
+
 // MigrationSet provides database parameters for a migration execution
 type MigrationSet struct {
 	// TableName name of the table used to store migration info.
+	//
+	// Tables named after it store the rest of the state: <table>_progress
+	// holds the progress and dirty mark of notransaction migrations,
+	// <table>_repeatable the repeatable migrations and, for dialects
+	// without a native lock, <table>_lock the migration lock. They are
+	// shared by both modes.
 	TableName string
 	// SchemaName schema that the migration table be referenced.
 	SchemaName string
@@ -41,10 +55,53 @@ type MigrationSet struct {
 	// EnablePatchMode enables patch mode for migrations
 	// Now it requires a new migration name format: 0001_00_name.sql and new table structure for save migrations
 	//
-	// It is recommended that you set a new table name(ex. "migrations") or delete the old migration table.
+	// It is recommended that you set a new table name(ex. "migrations") or delete the old migration table,
+	// or convert the old migration table with ConvertToPatch.
 	EnablePatchMode bool
+	// EnableLocking makes Exec, ExecMax and SkipMax (and their patch mode
+	// versions) hold the migration lock while they run, so that concurrent
+	// processes don't apply the same migrations. See LockContext.
+	EnableLocking bool
+	// LockTimeout is how long to wait for the migration lock before failing
+	// with a *LockError. Zero waits until the lock is available.
+	LockTimeout time.Duration
+	// WarnOnChecksumMismatch only logs a warning to the Logger when an
+	// applied migration was changed afterwards, instead of failing with a
+	// *ChecksumError.
+	WarnOnChecksumMismatch bool
+	// Hooks are called around the execution of every migration, see Hooks.
+	Hooks Hooks
+	// Logger receives plan decisions, statements, commits and rollbacks.
+	// Nothing is logged when it is nil.
+	Logger Logger
+	// ToolVersion is stored with every applied migration. It defaults to
+	// "sql-migrate " followed by Version.
+	ToolVersion string
+	// Atomic runs all planned migrations, and the updates of the migration
+	// table, in a single transaction with a savepoint per migration, so that
+	// a failure leaves the schema as it was before. It requires a database
+	// with transactional DDL and fails when a notransaction migration is
+	// planned.
+	Atomic bool
+	// TemplateVars are the variables that migrations annotated with
+	// '-- +migrate Template' are rendered with, as the data of a
+	// text/template.
+	TemplateVars map[string]interface{}
+	// Tags filters the migrations that are planned by their tags.
+	Tags TagFilter
+	// OutOfOrder decides what planning does with migrations that are older
+	// than the last applied one but were never applied. They are applied by
+	// default, see OutOfOrderPolicy.
+	OutOfOrder OutOfOrderPolicy
+
+	atomic *atomicTx
+	// progressMap maps the progress table, once a run created it.
+	progressMap *gorp.DbMap
 }
 
+// Version of the library.
+const Version = "1.0.0"
+
 var migSet = MigrationSet{}
 
 // NewMigrationSet returns a parametrized Migration object
@@ -55,6 +112,13 @@ func (ms MigrationSet) getTableName() string {
 	return ms.TableName
 }
 
+func (ms MigrationSet) getToolVersion() string {
+	if ms.ToolVersion == "" {
+		return "sql-migrate " + Version
+	}
+	return ms.ToolVersion
+}
+
 var numberPrefixRegex = regexp.MustCompile(`^(\d+).*$`)
 
 // PlanError happens where no migration plan could be created between the sets
@@ -79,20 +143,48 @@ func (p *PlanError) Error() string {
 // TxError is returned when any error is encountered during a database
 // transaction. It contains the relevant *Migration and notes it's Id in the
 // Error function output.
+//
+// When a statement of the migration failed, Statement holds its SQL,
+// StatementIndex its index among the statements of the migration and Line the
+// line it starts on in the source, or 0 when that is unknown. Statement is
+// empty when the error didn't come from a statement.
 type TxError struct {
-	MigrationName string
-	Err           error
+	MigrationName  string
+	Err            error
+	StatementIndex int
+	Statement      string
+	Line           int
 }
 
 func newTxError(migrationName string, err error) error {
-	return &TxError{
+	txErr := &TxError{
 		MigrationName: migrationName,
 		Err:           err,
 	}
+	if stmtErr, ok := err.(*statementError); ok {
+		txErr.Err = stmtErr.Err
+		txErr.StatementIndex = stmtErr.Index
+		txErr.Statement = stmtErr.Query
+		txErr.Line = stmtErr.Line
+	}
+	return txErr
 }
 
 func (e *TxError) Error() string {
-	return e.Err.Error() + " handling " + e.MigrationName
+	msg := e.Err.Error() + " handling " + e.MigrationName
+	if e.Statement != "" {
+		msg += fmt.Sprintf(": statement %d", e.StatementIndex+1)
+		if e.Line > 0 {
+			msg += fmt.Sprintf(" at line %d", e.Line)
+		}
+	}
+	return msg
+}
+
+// Unwrap returns the underlying error, for example context.Canceled when the
+// context of ExecContext was cancelled.
+func (e *TxError) Unwrap() error {
+	return e.Err
 }
 
 // Set the name of the table used to store migration info.
@@ -111,6 +203,11 @@ func SetSchema(name string) {
 	}
 }
 
+// SetToolVersion sets the tool version stored with applied migrations.
+func SetToolVersion(version string) {
+	migSet.ToolVersion = version
+}
+
 // SetIgnoreUnknown sets the flag that skips database check to see if there is a
 // migration in the database that is not in migration source.
 //
@@ -129,10 +226,58 @@ type Migration struct {
 	Up   []string
 	Down []string
 
+	// UpFunc and DownFunc are optional Go functions run after the Up and
+	// Down statements respectively.
+	UpFunc   MigrationFunc
+	DownFunc MigrationFunc
+
 	DisableTransactionUp   bool
 	DisableTransactionDown bool
+
+	// UpLines and DownLines hold the line on which each of the Up and Down
+	// statements starts in the source, when it was parsed from one.
+	UpLines   []int
+	DownLines []int
+
+	// Tags are those of the '-- +migrate Tags:' header. Migrations can be
+	// filtered by them, see TagFilter.
+	Tags []string
+
+	// Squashes holds the ids of the migrations this one replaces, from the
+	// '-- +migrate Squashes:' header. A database that has all of them applied
+	// has this migration applied, see Squash.
+	Squashes []string
+
+	// Requires holds the ids of the migrations that have to be applied
+	// before this one, from the '-- +migrate Requires:' header. They are
+	// planned first, whatever the order of the ids.
+	Requires []string
+
+	// UpDialects and DownDialects hold the statements of sections annotated
+	// with a dialect, by dialect. When planning for that dialect they replace
+	// Up and Down.
+	UpDialects   map[string]*sqlparse.DialectSection
+	DownDialects map[string]*sqlparse.DialectSection
+
+	// Template holds the source of a migration annotated with
+	// '-- +migrate Template'. It is rendered with the TemplateVars of the
+	// MigrationSet, and parsed into Up and Down, when migrations are planned.
+	Template string
+
+	// Repeatable migrations have no version. They run again, after the
+	// versioned migrations, whenever their checksum changes. Migrations
+	// whose name starts with R_ or that are annotated with
+	// '-- +migrate Repeatable' are repeatable. They can't have Go
+	// functions, which the checksum doesn't cover.
+	Repeatable bool
 }
 
+// MigrationFunc is a migration written in Go. It runs in the transaction of
+// the migration, or directly against the *sql.DB when transactions are
+// disabled for it, and is given that as executor. Returning an error fails
+// the migration and rolls the transaction back.
+type MigrationFunc func(ctx context.Context, executor SqlExecutorContext) error
+
 func (m Migration) Less(other *Migration) bool {
 	switch {
 	case m.isNumeric() && other.isNumeric() && m.VersionInt() != other.VersionInt():
@@ -168,6 +313,7 @@ type PlannedMigration struct {
 
 	DisableTransaction bool
 	Queries            []string
+	Func               MigrationFunc
 }
 
 type byId []*Migration
@@ -179,6 +325,17 @@ func (b byId) Less(i, j int) bool { return b[i].Less(b[j]) }
 type MigrationRecord struct {
 	Id        string    `db:"id"`
 	AppliedAt time.Time `db:"applied_at"`
+	// Checksum of the migration when it was applied, empty for migrations
+	// applied before checksums were stored.
+	Checksum string `db:"checksum"`
+
+	// How long the migration took, who applied it from where, and with which
+	// version of the tool. Empty for migrations applied before these were
+	// stored.
+	DurationMs  int64  `db:"duration_ms"`
+	AppliedBy   string `db:"applied_by"`
+	Host        string `db:"host"`
+	ToolVersion string `db:"tool_version"`
 }
 
 type OracleDialect struct {
@@ -230,6 +387,13 @@ func (m MemoryMigrationSource) FindMigrations() ([]*Migration, error) {
 	// of the m.Migrations.
 	migrations := make([]*Migration, len(m.Migrations))
 	copy(migrations, m.Migrations)
+	for i, migration := range migrations {
+		if !migration.Repeatable && strings.HasPrefix(migration.Id, repeatablePrefix) {
+			repeatable := *migration
+			repeatable.Repeatable = true
+			migrations[i] = &repeatable
+		}
+	}
 	sort.Sort(byId(migrations))
 	return migrations, nil
 }
@@ -403,12 +567,60 @@ func (p PackrMigrationSource) FindMigrations() ([]*Migration, error) {
 	return migrations, nil
 }
 
+// Migrations combined from several sources, for example SQL files from a
+// FileMigrationSource and Go migrations from a MemoryMigrationSource.
+type MultiMigrationSource struct {
+	Sources []MigrationSource
+}
+
+var _ MigrationSource = (*MultiMigrationSource)(nil)
+
+func (s MultiMigrationSource) FindMigrations() ([]*Migration, error) {
+	migrations := make([]*Migration, 0)
+	ids := make(map[string]struct{})
+
+	for _, source := range s.Sources {
+		found, err := source.FindMigrations()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, migration := range found {
+			if _, ok := ids[migration.Id]; ok {
+				return nil, fmt.Errorf("Duplicate migration %s", migration.Id)
+			}
+			ids[migration.Id] = struct{}{}
+		}
+		migrations = append(migrations, found...)
+	}
+
+	// Make sure migrations are sorted
+	sort.Sort(byId(migrations))
+
+	return migrations, nil
+}
+
 // Migration parsing
 func ParseMigration(id string, r io.ReadSeeker) (*Migration, error) {
 	m := &Migration{
 		Id: id,
 	}
 
+	repeatable, err := isRepeatable(id, r)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing migration (%s): %s", id, err)
+	}
+	m.Repeatable = repeatable
+
+	source, isTemplate, err := readTemplate(r)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing migration (%s): %s", id, err)
+	}
+	if isTemplate {
+		m.Template = source
+		return m, nil
+	}
+
 	parsed, err := sqlparse.ParseMigration(r)
 	if err != nil {
 		return nil, fmt.Errorf("Error parsing migration (%s): %s", id, err)
@@ -416,9 +628,16 @@ func ParseMigration(id string, r io.ReadSeeker) (*Migration, error) {
 
 	m.Up = parsed.UpStatements
 	m.Down = parsed.DownStatements
+	m.UpLines = parsed.UpLines
+	m.DownLines = parsed.DownLines
 
 	m.DisableTransactionUp = parsed.DisableTransactionUp
 	m.DisableTransactionDown = parsed.DisableTransactionDown
+	m.UpDialects = parsed.UpDialects
+	m.DownDialects = parsed.DownDialects
+	m.Tags = parsed.Tags
+	m.Squashes = parsed.Squashes
+	m.Requires = parsed.Requires
 
 	return m, nil
 }
@@ -431,6 +650,19 @@ type SqlExecutor interface {
 	Delete(list ...interface{}) (int64, error)
 }
 
+// SqlExecutorContext is what migrations are run against when executed with a
+// context: a *sql.Tx, or the *sql.DB itself for notransaction migrations.
+type SqlExecutorContext interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+var (
+	_ SqlExecutorContext = (*sql.DB)(nil)
+	_ SqlExecutorContext = (*sql.Tx)(nil)
+)
+
 // Execute a set of migrations
 //
 // Returns the number of applied migrations.
@@ -438,12 +670,24 @@ func Exec(db *sql.DB, dialect string, m MigrationSource, dir MigrationDirection)
 	return ExecMax(db, dialect, m, dir, 0)
 }
 
+// Execute a set of migrations with a context
+//
+// Returns the number of applied migrations.
+func ExecContext(ctx context.Context, db *sql.DB, dialect string, m MigrationSource, dir MigrationDirection) (int, error) {
+	return ExecMaxContext(ctx, db, dialect, m, dir, 0)
+}
+
 // Returns the number of applied migrations.
 func (ms MigrationSet) Exec(db *sql.DB, dialect string, m MigrationSource, dir MigrationDirection) (int, error) {
+	return ms.ExecContext(context.Background(), db, dialect, m, dir)
+}
+
+// Returns the number of applied migrations.
+func (ms MigrationSet) ExecContext(ctx context.Context, db *sql.DB, dialect string, m MigrationSource, dir MigrationDirection) (int, error) {
 	if ms.EnablePatchMode {
-		return ms.ExecMaxPatch(db, dialect, m, dir, 0)
+		return ms.ExecMaxPatchContext(ctx, db, dialect, m, dir, 0)
 	} else {
-		return ms.ExecMax(db, dialect, m, dir, 0)
+		return ms.ExecMaxContext(ctx, db, dialect, m, dir, 0)
 	}
 }
 
@@ -453,80 +697,95 @@ func (ms MigrationSet) Exec(db *sql.DB, dialect string, m MigrationSource, dir M
 //
 // Returns the number of applied migrations.
 func ExecMax(db *sql.DB, dialect string, m MigrationSource, dir MigrationDirection, max int) (int, error) {
+	return ExecMaxContext(context.Background(), db, dialect, m, dir, max)
+}
+
+// Execute a set of migrations with a context
+//
+// Will apply at most `max` migrations. Pass 0 for no limit (or use ExecContext).
+//
+// Returns the number of applied migrations.
+func ExecMaxContext(ctx context.Context, db *sql.DB, dialect string, m MigrationSource, dir MigrationDirection, max int) (int, error) {
 	if migSet.EnablePatchMode {
-		return migSet.ExecMaxPatch(db, dialect, m, dir, max)
+		return migSet.ExecMaxPatchContext(ctx, db, dialect, m, dir, max)
 	} else {
-		return migSet.ExecMax(db, dialect, m, dir, max)
+		return migSet.ExecMaxContext(ctx, db, dialect, m, dir, max)
 	}
 }
 
 // Returns the number of applied migrations.
 func (ms MigrationSet) ExecMax(db *sql.DB, dialect string, m MigrationSource, dir MigrationDirection, max int) (int, error) {
-	migrations, dbMap, err := ms.PlanMigration(db, dialect, m, dir, max)
+	return ms.ExecMaxContext(context.Background(), db, dialect, m, dir, max)
+}
+
+// Returns the number of applied migrations.
+//
+// The context is passed to every statement and transaction. Once it is done,
+// the migration being run is rolled back and a *TxError is returned.
+func (ms MigrationSet) ExecMaxContext(ctx context.Context, db *sql.DB, dialect string, m MigrationSource, dir MigrationDirection, max int) (int, error) {
+	lock, err := ms.lockIfEnabled(ctx, db, dialect)
 	if err != nil {
 		return 0, err
 	}
+	defer func() { _ = lock.Unlock() }()
 
-	// Apply migrations
-	applied := 0
-	for _, migration := range migrations {
-		var executor SqlExecutor
+	if err := ms.hooks().BeforePlan(ctx, &PlanEvent{Direction: dir, Max: max, Executor: db}); err != nil {
+		return 0, err
+	}
 
-		if migration.DisableTransaction {
-			executor = dbMap
-		} else {
-			executor, err = dbMap.Begin()
-			if err != nil {
-				return applied, newTxError(migration.Id, err)
-			}
-		}
+	migrations, dbMap, err := ms.PlanMigrationContext(ctx, db, dialect, m, dir, max)
+	if err != nil {
+		return 0, err
+	}
 
-		for _, stmt := range migration.Queries {
-			// remove the semicolon from stmt, fix ORA-00922 issue in database oracle
-			stmt = strings.TrimSuffix(stmt, "\n")
-			stmt = strings.TrimSuffix(stmt, " ")
-			stmt = strings.TrimSuffix(stmt, ";")
-			if _, err := executor.Exec(stmt); err != nil {
-				if trans, ok := executor.(*gorp.Transaction); ok {
-					_ = trans.Rollback()
-				}
+	return ms.applyMigrations(ctx, db, dbMap, migrations, dir)
+}
 
-				return applied, newTxError(migration.Id, err)
+// applyMigrations runs planned migrations in the given direction, each in its
+// own transaction together with the update of its migration record. With
+// Atomic set, they all run in one transaction.
+func (ms MigrationSet) applyMigrations(ctx context.Context, db *sql.DB, dbMap *gorp.DbMap, migrations []*PlannedMigration, dir MigrationDirection) (int, error) {
+	if ms.Atomic && ms.atomic == nil {
+		notransaction := ""
+		for _, migration := range migrations {
+			if migration.DisableTransaction {
+				notransaction = migration.Id
+				break
 			}
 		}
+		if err := checkAtomic(dbMap.Dialect, notransaction); err != nil {
+			return 0, err
+		}
+		return ms.runAtomically(ctx, db, dbMap.Dialect, func(ms MigrationSet) (int, error) {
+			return ms.applyMigrations(ctx, db, dbMap, migrations, dir)
+		})
+	}
 
-		switch dir {
-		case Up:
-			err = executor.Insert(&MigrationRecord{
-				Id:        migration.Id,
-				AppliedAt: time.Now(),
-			})
-			if err != nil {
-				if trans, ok := executor.(*gorp.Transaction); ok {
-					_ = trans.Rollback()
-				}
-
-				return applied, newTxError(migration.Id, err)
-			}
-		case Down:
-			_, err := executor.Delete(&MigrationRecord{
-				Id: migration.Id,
-			})
+	applied := 0
+	for _, migration := range migrations {
+		if migration.DisableTransaction && ms.progressMap == nil {
+			progressMap, err := ms.getProgressDbMap(db, dbMap.Dialect)
 			if err != nil {
-				if trans, ok := executor.(*gorp.Transaction); ok {
-					_ = trans.Rollback()
-				}
-
 				return applied, newTxError(migration.Id, err)
 			}
-		default:
-			panic("Not possible")
+			ms.progressMap = progressMap
 		}
 
-		if trans, ok := executor.(*gorp.Transaction); ok {
-			if err := trans.Commit(); err != nil {
-				return applied, newTxError(migration.Id, err)
+		event := &MigrationEvent{Migration: migration, Direction: dir}
+		err := ms.runMigration(ctx, db, dbMap, event, migration.DisableTransaction, migration.Queries, migration.Func, func(executor SqlExecutorContext, duration time.Duration) error {
+			switch {
+			case migration.Repeatable:
+				return ms.recordRepeatable(ctx, executor, dbMap, migration.Id, migration.Up, migration.Down, duration)
+			case dir == Up:
+				return ms.insertRecord(ctx, executor, dbMap, ms.newRecord(migration.Migration, duration))
+			case dir == Down:
+				return ms.deleteRecords(ctx, executor, dbMap, migration.Migration)
+			default:
+				panic("Not possible")
 			}
+		})
+		if err != nil {
+			return applied, newTxError(migration.Id, err)
 		}
 
 		applied++
@@ -535,51 +794,133 @@ func (ms MigrationSet) ExecMax(db *sql.DB, dialect string, m MigrationSource, di
 	return applied, nil
 }
 
+// withExecutor runs fn for the named migration inside a transaction bound to
+// ctx, which is committed when fn succeeds and rolled back otherwise. With
+// disableTransaction set, fn runs directly against db.
+func (ms MigrationSet) withExecutor(ctx context.Context, db *sql.DB, name string, disableTransaction bool, fn func(SqlExecutorContext) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if ms.atomic != nil {
+		return ms.atomic.savepoint(ctx, ms, name, fn)
+	}
+
+	if disableTransaction {
+		return fn(db)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			ms.log(LogError, "Rollback failed", "migration", name, "error", rbErr)
+		} else {
+			ms.log(LogDebug, "Rolled back transaction", "migration", name)
+		}
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	ms.log(LogDebug, "Committed transaction", "migration", name)
+	return nil
+}
+
+// execMigration runs the statements of a migration followed by its Go
+// function, if any.
+func execMigration(ctx context.Context, executor SqlExecutorContext, queries []string, fn MigrationFunc, afterStatement statementFunc) error {
+	if err := execQueries(ctx, executor, queries, afterStatement); err != nil {
+		return err
+	}
+
+	if fn != nil {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return fn(ctx, executor)
+	}
+
+	return nil
+}
+
+// statementFunc is called after each statement of a migration ran.
+type statementFunc func(index int, query string, result sql.Result, startedAt time.Time) error
+
+// statementError is returned by execQueries when a statement fails. Line is
+// filled in by runMigration, which knows where the statements come from.
+type statementError struct {
+	Index int
+	Query string
+	Line  int
+	Err   error
+}
+
+func (e *statementError) Error() string {
+	return e.Err.Error()
+}
+
+// execQueries runs the statements of a migration, stopping in between them
+// once ctx is done. afterStatement may be nil.
+func execQueries(ctx context.Context, executor SqlExecutorContext, queries []string, afterStatement statementFunc) error {
+	for i, stmt := range queries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// remove the semicolon from stmt, fix ORA-00922 issue in database oracle
+		stmt = strings.TrimSuffix(stmt, "\n")
+		stmt = strings.TrimSuffix(stmt, " ")
+		stmt = strings.TrimSuffix(stmt, ";")
+		startedAt := time.Now()
+		result, err := executor.ExecContext(ctx, stmt)
+		if err != nil {
+			return &statementError{Index: i, Query: stmt, Err: err}
+		}
+
+		if afterStatement != nil {
+			if err := afterStatement(i, stmt, result, startedAt); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
 // Plan a migration.
 func PlanMigration(db *sql.DB, dialect string, m MigrationSource, dir MigrationDirection, max int) ([]*PlannedMigration, *gorp.DbMap, error) {
 	return migSet.PlanMigration(db, dialect, m, dir, max)
 }
 
+// Plan a migration with a context.
+func PlanMigrationContext(ctx context.Context, db *sql.DB, dialect string, m MigrationSource, dir MigrationDirection, max int) ([]*PlannedMigration, *gorp.DbMap, error) {
+	return migSet.PlanMigrationContext(ctx, db, dialect, m, dir, max)
+}
+
 func (ms MigrationSet) PlanMigration(db *sql.DB, dialect string, m MigrationSource, dir MigrationDirection, max int) ([]*PlannedMigration, *gorp.DbMap, error) {
-	dbMap, err := ms.getMigrationDbMap(db, dialect)
+	return ms.PlanMigrationContext(context.Background(), db, dialect, m, dir, max)
+}
+
+func (ms MigrationSet) PlanMigrationContext(ctx context.Context, db *sql.DB, dialect string, m MigrationSource, dir MigrationDirection, max int) ([]*PlannedMigration, *gorp.DbMap, error) {
+	dbMap, err := ms.getMigrationDbMap(ctx, db, dialect)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	migrations, err := m.FindMigrations()
+	migrations, existingMigrations, err := ms.loadMigrations(ctx, db, dbMap, dialect, m)
 	if err != nil {
 		return nil, nil, err
 	}
-
-	var migrationRecords []MigrationRecord
-	_, err = dbMap.Select(&migrationRecords, fmt.Sprintf("SELECT * FROM %s", dbMap.Dialect.QuotedTableForQuery(ms.SchemaName, ms.getTableName())))
+	deps, err := migrationDependencies(migrations)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	// Sort migrations that have been run by Id.
-	var existingMigrations []*Migration
-	for _, migrationRecord := range migrationRecords {
-		existingMigrations = append(existingMigrations, &Migration{
-			Id: migrationRecord.Id,
-		})
-	}
-	sort.Sort(byId(existingMigrations))
-
-	// Make sure all migrations in the database are among the found migrations which
-	// are to be applied.
-	if !ms.IgnoreUnknown {
-		migrationsSearch := make(map[string]struct{})
-		for _, migration := range migrations {
-			migrationsSearch[migration.Id] = struct{}{}
-		}
-		for _, existingMigration := range existingMigrations {
-			if _, ok := migrationsSearch[existingMigration.Id]; !ok {
-				return nil, nil, newPlanError(existingMigration.Id, "unknown migration in database")
-			}
-		}
-	}
-
 	// Get last migration that was run
 	record := &Migration{}
 	if len(existingMigrations) > 0 {
@@ -589,13 +930,37 @@ func (ms MigrationSet) PlanMigration(db *sql.DB, dialect string, m MigrationSour
 	result := make([]*PlannedMigration, 0)
 
 	// Add missing migrations up to the last run migration.
-	// This can happen for example when merges happened.
-	if len(existingMigrations) > 0 {
-		result = append(result, ToCatchup(migrations, existingMigrations, record)...)
+	// This can happen for example when merges happened, or when they were
+	// filtered out by tags.
+	if dir == Up && len(existingMigrations) > 0 {
+		var names []string
+		for _, migration := range ToCatchup(migrations, existingMigrations, record) {
+			if ms.skipped(migration.Id, migration.Tags) {
+				continue
+			}
+			names = append(names, migration.Id)
+			result = append(result, migration)
+		}
+		if deps != nil {
+			names = deps.outOfOrder(migrationIds(migrations), names, appliedIds(existingMigrations))
+		}
+		if err := ms.checkOutOfOrder(names, record.Id); err != nil {
+			return nil, nil, err
+		}
 	}
 
-	// Figure out which migrations to apply
-	toApply := ToApply(migrations, record.Id, dir)
+	// Figure out which migrations to apply. Rolling back leaves out those
+	// that were never applied.
+	applied := appliedIds(existingMigrations)
+	var toApply []*Migration
+	for _, migration := range ToApply(migrations, record.Id, dir) {
+		if !ms.skipped(migration.Id, migration.Tags) && (dir == Up || applied[migration.Id]) {
+			toApply = append(toApply, migration)
+		}
+	}
+	if deps != nil {
+		toApply = deps.sortMigrations(toApply, dir)
+	}
 	toApplyCount := len(toApply)
 	if max > 0 && max < toApplyCount {
 		toApplyCount = max
@@ -606,27 +971,136 @@ func (ms MigrationSet) PlanMigration(db *sql.DB, dialect string, m MigrationSour
 			result = append(result, &PlannedMigration{
 				Migration:          v,
 				Queries:            v.Up,
+				Func:               v.UpFunc,
 				DisableTransaction: v.DisableTransactionUp,
 			})
 		} else if dir == Down {
 			result = append(result, &PlannedMigration{
 				Migration:          v,
 				Queries:            v.Down,
+				Func:               v.DownFunc,
 				DisableTransaction: v.DisableTransactionDown,
 			})
 		}
 	}
 
+	// Migrations run after those they require, and are rolled back before.
+	if deps != nil {
+		if result, err = deps.sortPlanned(result, applied, dir); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Repeatable migrations run after the versioned ones, once none are left.
+	if dir == Up && toApplyCount == len(toApply) && (max <= 0 || toApplyCount < max) {
+		remaining := 0
+		if max > 0 {
+			remaining = max - toApplyCount
+		}
+		repeatable, err := ms.planRepeatable(ctx, db, dialect, m, remaining)
+		if err != nil {
+			return nil, nil, err
+		}
+		result = append(result, repeatable...)
+	}
+
+	ms.log(LogDebug, "Planned migrations", "direction", dir, "count", len(result))
 	return result, dbMap, nil
 }
 
+// loadMigrations returns the migrations of m for dialect and those applied to
+// the database, sorted by Id, after making sure the two agree.
+func (ms MigrationSet) loadMigrations(ctx context.Context, db *sql.DB, dbMap *gorp.DbMap, dialect string, m MigrationSource) ([]*Migration, []*Migration, error) {
+	if err := ms.checkDirty(ctx, db, dbMap.Dialect); err != nil {
+		return nil, nil, err
+	}
+
+	migrations, err := ms.findMigrations(m, dialect)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	migrationRecords, err := ms.selectRecords(ctx, db, dbMap)
+	if err != nil {
+		return nil, nil, err
+	}
+	migrationRecords, err = squashRecords(migrations, migrationRecords)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Sort migrations that have been run by Id.
+	var existingMigrations []*Migration
+	for _, migrationRecord := range migrationRecords {
+		existingMigrations = append(existingMigrations, &Migration{
+			Id: migrationRecord.Id,
+		})
+	}
+	sort.Sort(byId(existingMigrations))
+
+	// Make sure all migrations in the database are among the found migrations which
+	// are to be applied.
+	migrationsSearch := make(map[string]struct{})
+	for _, migration := range migrations {
+		migrationsSearch[migration.Id] = struct{}{}
+	}
+	for _, existingMigration := range existingMigrations {
+		if _, ok := migrationsSearch[existingMigration.Id]; !ok {
+			if !ms.IgnoreUnknown {
+				return nil, nil, newPlanError(existingMigration.Id, "unknown migration in database")
+			}
+			ms.log(LogInfo, "Ignoring unknown migration in database", "migration", existingMigration.Id)
+		}
+	}
+
+	// Make sure the applied migrations weren't changed since.
+	migrationsById := make(map[string]*Migration)
+	for _, migration := range migrations {
+		migrationsById[migration.Id] = migration
+	}
+	for _, migrationRecord := range migrationRecords {
+		if migration, ok := migrationsById[migrationRecord.Id]; ok {
+			if err := ms.verifyChecksum(migration.Id, migrationRecord.Checksum, migration.Checksum()); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	return migrations, existingMigrations, nil
+}
+
 // Skip a set of migrations
 //
 // Will skip at most `max` migrations. Pass 0 for no limit.
 //
 // Returns the number of skipped migrations.
 func SkipMax(db *sql.DB, dialect string, m MigrationSource, dir MigrationDirection, max int) (int, error) {
-	migrations, dbMap, err := PlanMigration(db, dialect, m, dir, max)
+	return migSet.SkipMax(db, dialect, m, dir, max)
+}
+
+// Skip a set of migrations with a context
+//
+// Will skip at most `max` migrations. Pass 0 for no limit.
+//
+// Returns the number of skipped migrations.
+func SkipMaxContext(ctx context.Context, db *sql.DB, dialect string, m MigrationSource, dir MigrationDirection, max int) (int, error) {
+	return migSet.SkipMaxContext(ctx, db, dialect, m, dir, max)
+}
+
+// Returns the number of skipped migrations.
+func (ms MigrationSet) SkipMax(db *sql.DB, dialect string, m MigrationSource, dir MigrationDirection, max int) (int, error) {
+	return ms.SkipMaxContext(context.Background(), db, dialect, m, dir, max)
+}
+
+// Returns the number of skipped migrations.
+func (ms MigrationSet) SkipMaxContext(ctx context.Context, db *sql.DB, dialect string, m MigrationSource, dir MigrationDirection, max int) (int, error) {
+	lock, err := ms.lockIfEnabled(ctx, db, dialect)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = lock.Unlock() }()
+
+	migrations, dbMap, err := ms.PlanMigrationContext(ctx, db, dialect, m, dir, max)
 	if err != nil {
 		return 0, err
 	}
@@ -634,35 +1108,16 @@ func SkipMax(db *sql.DB, dialect string, m MigrationSource, dir MigrationDirecti
 	// Skip migrations
 	applied := 0
 	for _, migration := range migrations {
-		var executor SqlExecutor
-
-		if migration.DisableTransaction {
-			executor = dbMap
-		} else {
-			executor, err = dbMap.Begin()
-			if err != nil {
-				return applied, newTxError(migration.Id, err)
+		err := ms.withExecutor(ctx, db, migration.Id, migration.DisableTransaction, func(executor SqlExecutorContext) error {
+			if migration.Repeatable {
+				return ms.recordRepeatable(ctx, executor, dbMap, migration.Id, migration.Up, migration.Down, 0)
 			}
-		}
-
-		err = executor.Insert(&MigrationRecord{
-			Id:        migration.Id,
-			AppliedAt: time.Now(),
+			return ms.insertRecord(ctx, executor, dbMap, ms.newRecord(migration.Migration, 0))
 		})
 		if err != nil {
-			if trans, ok := executor.(*gorp.Transaction); ok {
-				_ = trans.Rollback()
-			}
-
 			return applied, newTxError(migration.Id, err)
 		}
 
-		if trans, ok := executor.(*gorp.Transaction); ok {
-			if err := trans.Commit(); err != nil {
-				return applied, newTxError(migration.Id, err)
-			}
-		}
-
 		applied++
 	}
 
@@ -713,6 +1168,7 @@ func ToCatchup(migrations, existingMigrations []*Migration, lastRun *Migration)
 			missing = append(missing, &PlannedMigration{
 				Migration:          migration,
 				Queries:            migration.Up,
+				Func:               migration.UpFunc,
 				DisableTransaction: migration.DisableTransactionUp,
 			})
 		}
@@ -724,23 +1180,24 @@ func GetMigrationRecords(db *sql.DB, dialect string) ([]*MigrationRecord, error)
 	return migSet.GetMigrationRecords(db, dialect)
 }
 
+func GetMigrationRecordsContext(ctx context.Context, db *sql.DB, dialect string) ([]*MigrationRecord, error) {
+	return migSet.GetMigrationRecordsContext(ctx, db, dialect)
+}
+
 func (ms MigrationSet) GetMigrationRecords(db *sql.DB, dialect string) ([]*MigrationRecord, error) {
-	dbMap, err := ms.getMigrationDbMap(db, dialect)
-	if err != nil {
-		return nil, err
-	}
+	return ms.GetMigrationRecordsContext(context.Background(), db, dialect)
+}
 
-	var records []*MigrationRecord
-	query := fmt.Sprintf("SELECT * FROM %s ORDER BY id ASC", dbMap.Dialect.QuotedTableForQuery(ms.SchemaName, ms.getTableName()))
-	_, err = dbMap.Select(&records, query)
+func (ms MigrationSet) GetMigrationRecordsContext(ctx context.Context, db *sql.DB, dialect string) ([]*MigrationRecord, error) {
+	dbMap, err := ms.getMigrationDbMap(ctx, db, dialect)
 	if err != nil {
 		return nil, err
 	}
 
-	return records, nil
+	return ms.selectRecords(ctx, db, dbMap)
 }
 
-func (ms MigrationSet) getMigrationDbMap(db *sql.DB, dialect string) (*gorp.DbMap, error) {
+func (ms MigrationSet) getMigrationDbMap(ctx context.Context, db *sql.DB, dialect string) (*gorp.DbMap, error) {
 	d, ok := MigrationDialects[dialect]
 	if !ok {
 		return nil, fmt.Errorf("Unknown dialect: %s", dialect)
@@ -751,7 +1208,7 @@ func (ms MigrationSet) getMigrationDbMap(db *sql.DB, dialect string) (*gorp.DbMa
 	// https://github.com/rubenv/sql-migrate/issues/2
 	if dialect == "mysql" {
 		var out *time.Time
-		err := db.QueryRow("SELECT NOW()").Scan(&out)
+		err := db.QueryRowContext(ctx, "SELECT NOW()").Scan(&out)
 		if err != nil {
 			if err.Error() == "sql: Scan error on column index 0: unsupported driver -> Scan pair: []uint8 -> *time.Time" ||
 				err.Error() == "sql: Scan error on column index 0: unsupported Scan, storing driver.Value type []uint8 into type *time.Time" ||
@@ -776,19 +1233,37 @@ Check https://github.com/go-sql-driver/mysql#parsetime for more info.`)
 		table = dbMap.AddTableWithNameAndSchema(MigrationRecord{}, ms.SchemaName, ms.getTableName()).
 			SetKeys(false, "Id")
 	}
-	//dbMap.TraceOn("", log.New(os.Stdout, "migrate: ", log.Lmicroseconds))
+	if ms.Logger != nil {
+		dbMap.TraceOn("", gorpLogger{ms.Logger})
+	}
 
-	if dialect == "oci8" || dialect == "godror" {
+	table.ColMap("Checksum").SetMaxSize(64)
+	if (dialect == "oci8" || dialect == "godror") && !ms.EnablePatchMode {
 		table.ColMap("Id").SetMaxSize(4000)
 	}
 
+	// gorp cannot be handed the context, so at least don't start creating
+	// the table once it is done.
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	err := dbMap.CreateTablesIfNotExists()
 	if err != nil {
 		// Oracle database does not support `if not exists`, so use `ORA-00955:` error code
 		// to check if the table exists.
-		if (dialect == "oci8" || dialect == "godror") && strings.Contains(err.Error(), "ORA-00955:") {
-			return dbMap, nil
+		if !((dialect == "oci8" || dialect == "godror") && strings.Contains(err.Error(), "ORA-00955:")) {
+			return nil, err
 		}
+	}
+
+	// Add the columns that tables created by older versions lack.
+	if ms.EnablePatchMode {
+		err = ms.upgradeTable(ctx, db, dbMap, dialect, table, MigrationPatchRecord{}, "ver", upgradedFields...)
+	} else {
+		err = ms.upgradeTable(ctx, db, dbMap, dialect, table, MigrationRecord{}, "id", upgradedFields...)
+	}
+	if err != nil {
 		return nil, err
 	}
 
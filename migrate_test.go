@@ -1,8 +1,11 @@
 package migrate
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"net/http"
+	"strings"
 
 	"github.com/gobuffalo/packr/v2"
 	_ "github.com/mattn/go-sqlite3"
@@ -431,25 +434,21 @@ func (s *SqliteMigrateSuite) TestPlanMigrationWithHoles(c *C) {
 	c.Assert(plannedMigrations[2].Migration.Id, Equals, "5")
 	c.Assert(plannedMigrations[2].Queries[0], Equals, up)
 
-	// first catch up to current target state 123, then migrate down 1 step to 12
+	// migrate down 1 step, leaving out the migrations that were never applied
 	plannedMigrations, _, err = PlanMigration(s.Db, "sqlite3", migrations, Down, 1)
 	c.Assert(err, IsNil)
-	c.Assert(plannedMigrations, HasLen, 2)
-	c.Assert(plannedMigrations[0].Migration.Id, Equals, "2")
-	c.Assert(plannedMigrations[0].Queries[0], Equals, up)
-	c.Assert(plannedMigrations[1].Migration.Id, Equals, "3")
-	c.Assert(plannedMigrations[1].Queries[0], Equals, down)
+	c.Assert(plannedMigrations, HasLen, 1)
+	c.Assert(plannedMigrations[0].Migration.Id, Equals, "3")
+	c.Assert(plannedMigrations[0].Queries[0], Equals, down)
 
-	// first catch up to current target state 123, then migrate down 2 steps to 1
+	// migrate down 2 steps, to nothing
 	plannedMigrations, _, err = PlanMigration(s.Db, "sqlite3", migrations, Down, 2)
 	c.Assert(err, IsNil)
-	c.Assert(plannedMigrations, HasLen, 3)
-	c.Assert(plannedMigrations[0].Migration.Id, Equals, "2")
-	c.Assert(plannedMigrations[0].Queries[0], Equals, up)
-	c.Assert(plannedMigrations[1].Migration.Id, Equals, "3")
+	c.Assert(plannedMigrations, HasLen, 2)
+	c.Assert(plannedMigrations[0].Migration.Id, Equals, "3")
+	c.Assert(plannedMigrations[0].Queries[0], Equals, down)
+	c.Assert(plannedMigrations[1].Migration.Id, Equals, "1")
 	c.Assert(plannedMigrations[1].Queries[0], Equals, down)
-	c.Assert(plannedMigrations[2].Migration.Id, Equals, "2")
-	c.Assert(plannedMigrations[2].Queries[0], Equals, down)
 }
 
 func (s *SqliteMigrateSuite) TestLess(c *C) {
@@ -648,3 +647,244 @@ func (s *SqliteMigrateSuite) TestRunMigrationObjOtherTable(c *C) {
 	c.Assert(err, IsNil)
 	c.Assert(n, Equals, 0)
 }
+
+func (s *SqliteMigrateSuite) TestExecContext(c *C) {
+	migrations := &MemoryMigrationSource{
+		Migrations: sqliteMigrations[:2],
+	}
+
+	ms := MigrationSet{}
+	n, err := ms.ExecContext(context.Background(), s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+
+	records, err := ms.GetMigrationRecordsContext(context.Background(), s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 2)
+	c.Assert(records[0].Id, Equals, "123")
+	c.Assert(records[1].Id, Equals, "124")
+
+	n, err = ms.ExecMaxContext(context.Background(), s.Db, "sqlite3", migrations, Down, 1)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+
+	records, err = ms.GetMigrationRecordsContext(context.Background(), s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 1)
+}
+
+func (s *SqliteMigrateSuite) TestExecContextCancelled(c *C) {
+	migrations := &MemoryMigrationSource{
+		Migrations: sqliteMigrations[:1],
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	ms := MigrationSet{}
+	n, err := ms.ExecContext(ctx, s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, Equals, context.Canceled)
+	c.Assert(n, Equals, 0)
+
+	// Nothing should have been applied
+	_, err = s.DbMap.Exec("SELECT * FROM people")
+	c.Assert(err, NotNil)
+}
+
+func (s *SqliteMigrateSuite) TestWithExecutorCancelledRollsBack(c *C) {
+	_, err := s.Db.Exec("CREATE TABLE people (id int)")
+	c.Assert(err, IsNil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err = MigrationSet{}.withExecutor(ctx, s.Db, "123", false, func(executor SqlExecutorContext) error {
+		queries := []string{"INSERT INTO people (id) VALUES (1)", "INSERT INTO people (id) VALUES (2)"}
+		if err := execQueries(ctx, executor, queries[:1], nil); err != nil {
+			return err
+		}
+		cancel()
+		return execQueries(ctx, executor, queries[1:], nil)
+	})
+	c.Assert(err, Equals, context.Canceled)
+
+	txErr := newTxError("1_people.sql", err)
+	c.Assert(txErr.(*TxError).Unwrap(), Equals, context.Canceled)
+
+	count, err := s.DbMap.SelectInt("SELECT COUNT(*) FROM people")
+	c.Assert(err, IsNil)
+	c.Assert(count, Equals, int64(0))
+}
+
+func (s *SqliteMigrateSuite) TestSkipMaxContext(c *C) {
+	migrations := &MemoryMigrationSource{
+		Migrations: sqliteMigrations[:2],
+	}
+
+	ms := MigrationSet{}
+	n, err := ms.SkipMaxContext(context.Background(), s.Db, "sqlite3", migrations, Up, 1)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+
+	// The skipped migration did not run
+	_, err = s.DbMap.Exec("SELECT * FROM people")
+	c.Assert(err, NotNil)
+
+	planned, _, err := ms.PlanMigrationContext(context.Background(), s.Db, "sqlite3", migrations, Up, 0)
+	c.Assert(err, IsNil)
+	c.Assert(planned, HasLen, 1)
+	c.Assert(planned[0].Id, Equals, "124")
+}
+
+func (s *SqliteMigrateSuite) TestGoMigration(c *C) {
+	migrations := &MemoryMigrationSource{
+		Migrations: []*Migration{
+			sqliteMigrations[0],
+			&Migration{
+				Id: "124_backfill",
+				UpFunc: func(ctx context.Context, executor SqlExecutorContext) error {
+					for i := 1; i <= 3; i++ {
+						if _, err := executor.ExecContext(ctx, "INSERT INTO people (id) VALUES (?)", i); err != nil {
+							return err
+						}
+					}
+					return nil
+				},
+				DownFunc: func(ctx context.Context, executor SqlExecutorContext) error {
+					_, err := executor.ExecContext(ctx, "DELETE FROM people")
+					return err
+				},
+			},
+		},
+	}
+
+	ms := MigrationSet{}
+	n, err := ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+
+	count, err := s.DbMap.SelectInt("SELECT COUNT(*) FROM people")
+	c.Assert(err, IsNil)
+	c.Assert(count, Equals, int64(3))
+
+	n, err = ms.ExecMax(s.Db, "sqlite3", migrations, Down, 1)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+
+	count, err = s.DbMap.SelectInt("SELECT COUNT(*) FROM people")
+	c.Assert(err, IsNil)
+	c.Assert(count, Equals, int64(0))
+}
+
+func (s *SqliteMigrateSuite) TestGoMigrationErrorRollsBack(c *C) {
+	failure := errors.New("failed")
+	migrations := &MemoryMigrationSource{
+		Migrations: []*Migration{
+			sqliteMigrations[0],
+			&Migration{
+				Id: "124_backfill",
+				Up: []string{"INSERT INTO people (id) VALUES (1)"},
+				UpFunc: func(ctx context.Context, executor SqlExecutorContext) error {
+					return failure
+				},
+			},
+		},
+	}
+
+	ms := MigrationSet{}
+	n, err := ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, FitsTypeOf, &TxError{})
+	c.Assert(err.(*TxError).Err, Equals, failure)
+	c.Assert(err.(*TxError).MigrationName, Equals, "124_backfill")
+	c.Assert(n, Equals, 1)
+
+	// The statements before it were rolled back, and it is not recorded
+	count, err := s.DbMap.SelectInt("SELECT COUNT(*) FROM people")
+	c.Assert(err, IsNil)
+	c.Assert(count, Equals, int64(0))
+
+	records, err := ms.GetMigrationRecords(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 1)
+}
+
+func (s *SqliteMigrateSuite) TestMultiMigrationSource(c *C) {
+	migrations := &MultiMigrationSource{
+		Sources: []MigrationSource{
+			&FileMigrationSource{
+				Dir: "test-migrations",
+			},
+			&MemoryMigrationSource{
+				Migrations: []*Migration{
+					&Migration{
+						Id:                   "3_go",
+						DisableTransactionUp: true,
+						UpFunc: func(ctx context.Context, executor SqlExecutorContext) error {
+							// notransaction migrations get the connection itself
+							if _, ok := executor.(*sql.DB); !ok {
+								return errors.New("expected *sql.DB")
+							}
+							_, err := executor.ExecContext(ctx, "UPDATE people SET id = 2")
+							return err
+						},
+					},
+				},
+			},
+		},
+	}
+
+	ms := MigrationSet{}
+	planned, _, err := ms.PlanMigration(s.Db, "sqlite3", migrations, Up, 0)
+	c.Assert(err, IsNil)
+	c.Assert(planned, HasLen, 3)
+	c.Assert(planned[0].Id, Equals, "1_initial.sql")
+	c.Assert(planned[1].Id, Equals, "2_record.sql")
+	c.Assert(planned[2].Id, Equals, "3_go")
+	c.Assert(planned[2].Func, NotNil)
+
+	n, err := ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 3)
+
+	id, err := s.DbMap.SelectInt("SELECT id FROM people")
+	c.Assert(err, IsNil)
+	c.Assert(id, Equals, int64(2))
+
+	// Duplicate ids across sources are refused
+	migrations.Sources = append(migrations.Sources, &MemoryMigrationSource{
+		Migrations: []*Migration{&Migration{Id: "3_go"}},
+	})
+	_, err = migrations.FindMigrations()
+	c.Assert(err, NotNil)
+}
+
+const failingMigration = `-- +migrate Up
+CREATE TABLE people (id int);
+
+-- Names
+ALTER TABLE people
+    ADD COLUMN first_name text;
+INSERT INTO nowhere (id) VALUES (1);
+
+-- +migrate Down
+DROP TABLE people;
+`
+
+func (s *SqliteMigrateSuite) TestTxErrorStatement(c *C) {
+	migration, err := ParseMigration("1_people.sql", strings.NewReader(failingMigration))
+	c.Assert(err, IsNil)
+	migrations := &MemoryMigrationSource{
+		Migrations: []*Migration{migration},
+	}
+
+	hooks := &recordingHooks{}
+	_, err = MigrationSet{Hooks: hooks}.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, FitsTypeOf, &TxError{})
+	txErr := err.(*TxError)
+	c.Assert(txErr.StatementIndex, Equals, 2)
+	c.Assert(txErr.Statement, Equals, "INSERT INTO nowhere (id) VALUES (1)")
+	c.Assert(txErr.Line, Equals, 7)
+	c.Assert(txErr.Err, ErrorMatches, "no such table: nowhere")
+	c.Assert(err, ErrorMatches, "no such table: nowhere handling 1_people.sql: statement 3 at line 7")
+
+	// Hooks get the error of the driver
+	c.Assert(hooks.errs[0], Equals, txErr.Err)
+}
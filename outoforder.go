@@ -0,0 +1,76 @@
+package migrate
+
+import (
+	"fmt"
+	"strings"
+)
+
+// OutOfOrderPolicy decides what planning does with migrations that were never
+// applied but are older than the last applied one, for example because they
+// were merged after newer migrations were applied.
+type OutOfOrderPolicy string
+
+const (
+	// OutOfOrderAllow applies them before the other planned migrations. This
+	// is the default.
+	OutOfOrderAllow OutOfOrderPolicy = "allow"
+	// OutOfOrderWarn applies them as well, but logs a warning to the Logger.
+	OutOfOrderWarn OutOfOrderPolicy = "warn"
+	// OutOfOrderFail fails planning with an *OutOfOrderError.
+	OutOfOrderFail OutOfOrderPolicy = "error"
+)
+
+// OutOfOrderError is returned when planning with OutOfOrderFail while
+// migrations older than the last applied one were never applied.
+type OutOfOrderError struct {
+	Migrations  []string
+	LastApplied string
+}
+
+func (e *OutOfOrderError) Error() string {
+	return fmt.Sprintf("Migrations older than the last applied migration %s were not applied: %s",
+		e.LastApplied, strings.Join(e.Migrations, ", "))
+}
+
+// SetOutOfOrderPolicy sets what planning does with migrations older than the
+// last applied one. See OutOfOrderPolicy.
+func SetOutOfOrderPolicy(policy OutOfOrderPolicy) {
+	migSet.OutOfOrder = policy
+}
+
+// Validate returns an error for an unknown policy. The empty policy is
+// OutOfOrderAllow.
+func (p OutOfOrderPolicy) Validate() error {
+	switch p {
+	case "", OutOfOrderAllow, OutOfOrderWarn, OutOfOrderFail:
+		return nil
+	}
+	return fmt.Errorf("Unknown out-of-order policy %q, use allow, warn or error", string(p))
+}
+
+// checkOutOfOrder applies the out-of-order policy to the named migrations
+// that are older than the last applied one.
+func (ms MigrationSet) checkOutOfOrder(migrations []string, lastApplied string) error {
+	if len(migrations) == 0 {
+		return nil
+	}
+	if err := ms.OutOfOrder.Validate(); err != nil {
+		return err
+	}
+
+	switch ms.OutOfOrder {
+	case OutOfOrderFail:
+		return &OutOfOrderError{Migrations: migrations, LastApplied: lastApplied}
+	case OutOfOrderWarn:
+		for _, name := range migrations {
+			ms.log(LogWarn, "Applying migration older than the last applied one",
+				"migration", name, "last_applied", lastApplied)
+		}
+	default:
+		for _, name := range migrations {
+			ms.log(LogInfo, "Catching up on migration older than the last applied one",
+				"migration", name, "last_applied", lastApplied)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package migrate
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+func (s *SqliteMigrateSuite) TestOutOfOrderPolicy(c *C) {
+	people := &Migration{
+		Id:   "1_people.sql",
+		Up:   []string{"CREATE TABLE people (id int)"},
+		Down: []string{"DROP TABLE people"},
+	}
+	merged := &Migration{
+		Id:   "2_pets.sql",
+		Up:   []string{"CREATE TABLE pets (id int)"},
+		Down: []string{"DROP TABLE pets"},
+	}
+	toys := &Migration{
+		Id:   "3_toys.sql",
+		Up:   []string{"CREATE TABLE toys (id int)"},
+		Down: []string{"DROP TABLE toys"},
+	}
+
+	ms := MigrationSet{OutOfOrder: OutOfOrderFail}
+	_, err := ms.Exec(s.Db, "sqlite3", &MemoryMigrationSource{Migrations: []*Migration{people, toys}}, Up)
+	c.Assert(err, IsNil)
+
+	// 2_pets.sql is merged after 3_toys.sql was applied
+	migrations := &MemoryMigrationSource{Migrations: []*Migration{people, merged, toys}}
+	_, _, err = ms.PlanMigration(s.Db, "sqlite3", migrations, Up, 0)
+	c.Assert(err, FitsTypeOf, &OutOfOrderError{})
+	c.Assert(err.(*OutOfOrderError).Migrations, DeepEquals, []string{"2_pets.sql"})
+	c.Assert(err.(*OutOfOrderError).LastApplied, Equals, "3_toys.sql")
+	_, err = ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, ErrorMatches, "Migrations older than the last applied migration 3_toys.sql were not applied: 2_pets.sql")
+
+	ms.OutOfOrder = "sometimes"
+	_, _, err = ms.PlanMigration(s.Db, "sqlite3", migrations, Up, 0)
+	c.Assert(err, ErrorMatches, "Unknown out-of-order policy .*")
+
+	ms.OutOfOrder = OutOfOrderWarn
+	n, err := ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+}
+
+func (s *SqliteMigrateSuite) TestOutOfOrderPolicyPatch(c *C) {
+	people := &MigrationPatch{
+		Name: "0001_00_people.sql",
+		Up:   []string{"CREATE TABLE people (id int)"},
+		Down: []string{"DROP TABLE people"},
+	}
+	merged := &MigrationPatch{
+		Name: "0001_01_name.sql",
+		Up:   []string{"ALTER TABLE people ADD COLUMN name text"},
+		Down: []string{"SELECT 0"},
+	}
+	pets := &MigrationPatch{
+		Name: "0002_00_pets.sql",
+		Up:   []string{"CREATE TABLE pets (id int)"},
+		Down: []string{"DROP TABLE pets"},
+	}
+
+	ms := MigrationSet{EnablePatchMode: true, OutOfOrder: OutOfOrderFail}
+	_, err := ms.Exec(s.Db, "sqlite3", &MemoryMigrationSource{MigrationsPatch: []*MigrationPatch{people, pets}}, Up)
+	c.Assert(err, IsNil)
+
+	migrations := &MemoryMigrationSource{MigrationsPatch: []*MigrationPatch{people, merged, pets}}
+	_, _, err = ms.PlanMigrationPatch(s.Db, "sqlite3", migrations, Up, 0)
+	c.Assert(err, FitsTypeOf, &OutOfOrderError{})
+	c.Assert(err.(*OutOfOrderError).Migrations, DeepEquals, []string{"0001_01_name.sql"})
+
+	ms.OutOfOrder = OutOfOrderAllow
+	n, err := ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+}
@@ -2,6 +2,7 @@ package migrate
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"fmt"
 	"io"
@@ -30,8 +31,45 @@ type MigrationPatch struct {
 	Up       []string
 	Down     []string
 
+	// UpFunc and DownFunc are optional Go functions run after the Up and
+	// Down statements respectively.
+	UpFunc   MigrationFunc
+	DownFunc MigrationFunc
+
 	DisableTransactionUp   bool
 	DisableTransactionDown bool
+
+	// UpLines and DownLines hold the line on which each of the Up and Down
+	// statements starts in the source, when it was parsed from one.
+	UpLines   []int
+	DownLines []int
+
+	// Tags are those of the '-- +migrate Tags:' header. Migrations can be
+	// filtered by them, see TagFilter.
+	Tags []string
+
+	// Requires holds the names of the migrations that have to be applied
+	// before this one, from the '-- +migrate Requires:' header. In patch
+	// mode they have to sort before it.
+	Requires []string
+
+	// UpDialects and DownDialects hold the statements of sections annotated
+	// with a dialect, by dialect. When planning for that dialect they replace
+	// Up and Down.
+	UpDialects   map[string]*sqlparse.DialectSection
+	DownDialects map[string]*sqlparse.DialectSection
+
+	// Template holds the source of a migration annotated with
+	// '-- +migrate Template'. It is rendered with the TemplateVars of the
+	// MigrationSet, and parsed into Up and Down, when migrations are planned.
+	Template string
+
+	// Repeatable migrations have no version. They run again, after the
+	// versioned migrations, whenever their checksum changes. Migrations
+	// whose name starts with R_ or that are annotated with
+	// '-- +migrate Repeatable' are repeatable. They can't have Go
+	// functions, which the checksum doesn't cover.
+	Repeatable bool
 }
 
 func (m MigrationPatch) Less(other *MigrationPatch) bool {
@@ -57,6 +95,7 @@ type PlannedMigrationPatch struct {
 
 	DisableTransaction bool
 	Queries            []string
+	Func               MigrationFunc
 }
 
 type byIdPatch []*MigrationPatch
@@ -71,6 +110,17 @@ type MigrationPatchRecord struct {
 	Name      string    `db:"name"`
 	CreatedAt time.Time `db:"created_at"`
 	UpdatedAt time.Time `db:"updated_at"`
+	// Checksum of the applied patch, empty for patches applied before
+	// checksums were stored.
+	Checksum string `db:"checksum"`
+
+	// How long the last patch took, who applied it from where, and with which
+	// version of the tool. Empty for patches applied before these were
+	// stored.
+	DurationMs  int64  `db:"duration_ms"`
+	AppliedBy   string `db:"applied_by"`
+	Host        string `db:"host"`
+	ToolVersion string `db:"tool_version"`
 }
 
 func (m MemoryMigrationSource) FindMigrationsPatch() ([]*MigrationPatch, error) {
@@ -79,7 +129,17 @@ func (m MemoryMigrationSource) FindMigrationsPatch() ([]*MigrationPatch, error)
 	// of the m.Migrations.
 	migrations := make([]*MigrationPatch, len(m.MigrationsPatch))
 	copy(migrations, m.MigrationsPatch)
-	for _, migration := range migrations {
+	for i, migration := range migrations {
+		if !migration.Repeatable && strings.HasPrefix(migration.Name, repeatablePrefix) {
+			repeatable := *migration
+			repeatable.Repeatable = true
+			migrations[i] = &repeatable
+			continue
+		}
+		if migration.Repeatable {
+			continue
+		}
+
 		prefixMatches := numberPrefixPatchRegex.FindStringSubmatch(migration.Name)
 		if len(prefixMatches) < 3 {
 			return nil, fmt.Errorf("failed. Name migrations %s not format 0000_00_name.sql", migration.Name)
@@ -219,23 +279,71 @@ func (p PackrMigrationSource) FindMigrationsPatch() ([]*MigrationPatch, error) {
 	return migrations, nil
 }
 
+func (s MultiMigrationSource) FindMigrationsPatch() ([]*MigrationPatch, error) {
+	migrations := make([]*MigrationPatch, 0)
+	versions := make(map[int64]map[int64]struct{})
+
+	for _, source := range s.Sources {
+		found, err := source.FindMigrationsPatch()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, migration := range found {
+			patches, ok := versions[migration.VerInt]
+			if !ok {
+				patches = make(map[int64]struct{})
+				versions[migration.VerInt] = patches
+			}
+			if _, ok := patches[migration.PatchInt]; ok {
+				return nil, fmt.Errorf("Duplicate migration %s", migration.Name)
+			}
+			patches[migration.PatchInt] = struct{}{}
+		}
+		migrations = append(migrations, found...)
+	}
+
+	// Make sure migrations are sorted
+	sort.Sort(byIdPatch(migrations))
+
+	return migrations, nil
+}
+
 // Migration parsing
 func ParseMigrationPatch(nameFile string, r io.ReadSeeker) (*MigrationPatch, error) {
 	m := &MigrationPatch{
 		Name: nameFile,
 	}
 
-	prefixMatches := numberPrefixPatchRegex.FindStringSubmatch(m.Name)
-	if len(prefixMatches) < 3 {
-		return nil, fmt.Errorf("failed. Name migrations %s not format 0000_00_name.sql", m.Name)
+	repeatable, err := isRepeatable(nameFile, r)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing migration (%s): %s", nameFile, err)
 	}
+	m.Repeatable = repeatable
+
+	// Repeatable migrations have no version and patch.
+	if !m.Repeatable {
+		prefixMatches := numberPrefixPatchRegex.FindStringSubmatch(m.Name)
+		if len(prefixMatches) < 3 {
+			return nil, fmt.Errorf("failed. Name migrations %s not format 0000_00_name.sql", m.Name)
+		}
+
+		m.Ver = prefixMatches[1]
+		m.Patch = prefixMatches[2]
 
-	m.Ver = prefixMatches[1]
-	m.Patch = prefixMatches[2]
+		err := m.ParseName()
+		if err != nil {
+			return nil, fmt.Errorf("error parsing name migrations (%s): %s", nameFile, err)
+		}
+	}
 
-	err := m.ParseName()
+	source, isTemplate, err := readTemplate(r)
 	if err != nil {
-		return nil, fmt.Errorf("error parsing name migrations (%s): %s", nameFile, err)
+		return nil, fmt.Errorf("Error parsing migration (%s): %s", nameFile, err)
+	}
+	if isTemplate {
+		m.Template = source
+		return m, nil
 	}
 
 	parsed, err := sqlparse.ParseMigration(r)
@@ -245,124 +353,103 @@ func ParseMigrationPatch(nameFile string, r io.ReadSeeker) (*MigrationPatch, err
 
 	m.Up = parsed.UpStatements
 	m.Down = parsed.DownStatements
+	m.UpLines = parsed.UpLines
+	m.DownLines = parsed.DownLines
 
 	m.DisableTransactionUp = parsed.DisableTransactionUp
 	m.DisableTransactionDown = parsed.DisableTransactionDown
+	m.UpDialects = parsed.UpDialects
+	m.DownDialects = parsed.DownDialects
+	m.Tags = parsed.Tags
+	m.Requires = parsed.Requires
 
 	return m, nil
 }
 
 // Returns the number of applied migrations.
 func (ms MigrationSet) ExecMaxPatch(db *sql.DB, dialect string, m MigrationSource, dir MigrationDirection, max int) (int, error) {
-	migrations, dbMap, err := ms.PlanMigrationPatch(db, dialect, m, dir, max)
+	return ms.ExecMaxPatchContext(context.Background(), db, dialect, m, dir, max)
+}
+
+// Returns the number of applied migrations.
+//
+// The context is passed to every statement and transaction. Once it is done,
+// the migration being run is rolled back and a *TxError is returned.
+func (ms MigrationSet) ExecMaxPatchContext(ctx context.Context, db *sql.DB, dialect string, m MigrationSource, dir MigrationDirection, max int) (int, error) {
+	lock, err := ms.lockIfEnabled(ctx, db, dialect)
 	if err != nil {
 		return 0, err
 	}
+	defer func() { _ = lock.Unlock() }()
 
-	minPatches := make(map[int64]int64)
-	for _, migration := range migrations {
-		curMinPatch, ok := minPatches[migration.VerInt]
-		if !ok || migration.PatchInt < curMinPatch {
-			minPatches[migration.VerInt] = migration.PatchInt
-		}
+	if err := ms.hooks().BeforePlan(ctx, &PlanEvent{Direction: dir, Max: max, Executor: db}); err != nil {
+		return 0, err
 	}
 
-	// Apply migrations
-	applied := 0
-	for _, migration := range migrations {
-		var executor SqlExecutor
+	migrations, dbMap, err := ms.PlanMigrationPatchContext(ctx, db, dialect, m, dir, max)
+	if err != nil {
+		return 0, err
+	}
 
-		if migration.DisableTransaction {
-			executor = dbMap
-		} else {
-			executor, err = dbMap.Begin()
-			if err != nil {
-				return applied, newTxError(migration.Name, err)
-			}
-		}
+	all, err := ms.findMigrationsPatch(m, dialect)
+	if err != nil {
+		return 0, err
+	}
 
-		for _, stmt := range migration.Queries {
-			// remove the semicolon from stmt, fix ORA-00922 issue in database oracle
-			stmt = strings.TrimSuffix(stmt, "\n")
-			stmt = strings.TrimSuffix(stmt, " ")
-			stmt = strings.TrimSuffix(stmt, ";")
-			if _, err := executor.Exec(stmt); err != nil {
-				if trans, ok := executor.(*gorp.Transaction); ok {
-					_ = trans.Rollback()
-				}
+	return ms.applyMigrationsPatch(ctx, db, dbMap, all, migrations, dir)
+}
 
-				return applied, newTxError(migration.Name, err)
+// applyMigrationsPatch runs planned migrations in the given direction, each in
+// its own transaction together with the update of its version's record. Rolling
+// back a patch moves the record to the preceding patch among all. With Atomic
+// set, they all run in one transaction.
+func (ms MigrationSet) applyMigrationsPatch(ctx context.Context, db *sql.DB, dbMap *gorp.DbMap, all []*MigrationPatch,
+	migrations []*PlannedMigrationPatch, dir MigrationDirection) (int, error) {
+	if ms.Atomic && ms.atomic == nil {
+		notransaction := ""
+		for _, migration := range migrations {
+			if migration.DisableTransaction {
+				notransaction = migration.Name
+				break
 			}
 		}
+		if err := checkAtomic(dbMap.Dialect, notransaction); err != nil {
+			return 0, err
+		}
+		return ms.runAtomically(ctx, db, dbMap.Dialect, func(ms MigrationSet) (int, error) {
+			return ms.applyMigrationsPatch(ctx, db, dbMap, all, migrations, dir)
+		})
+	}
 
-		switch dir {
-		case Up:
-			obj, err := executor.Get(MigrationPatchRecord{}, migration.Ver)
-			if err != nil {
-				if trans, ok := executor.(*gorp.Transaction); ok {
-					_ = trans.Rollback()
-				}
-				return applied, newTxError(migration.Name, err)
-			}
-
-			if obj == nil {
-				err = executor.Insert(&MigrationPatchRecord{
-					Ver:       migration.Ver,
-					Patch:     migration.Patch,
-					Name:      migration.Name,
-					CreatedAt: time.Now(),
-					UpdatedAt: time.Now(),
-				})
-			} else {
-				original := obj.(*MigrationPatchRecord)
-				original.Patch = migration.Patch
-				original.UpdatedAt = time.Now()
-				_, err = executor.Update(original)
-			}
-			if err != nil {
-				if trans, ok := executor.(*gorp.Transaction); ok {
-					_ = trans.Rollback()
-				}
-
-				return applied, newTxError(migration.Name, err)
-			}
-		case Down:
-			minPatch, ok := minPatches[migration.VerInt]
-
-			if !ok || migration.PatchInt == minPatch {
-				_, err = executor.Delete(&MigrationPatchRecord{
-					Ver:   migration.Ver,
-					Patch: migration.Patch,
-					Name:  migration.Name,
-				})
-			} else {
-				obj, err := executor.Get(MigrationPatchRecord{}, migration.Ver)
-				if err != nil {
-					if trans, ok := executor.(*gorp.Transaction); ok {
-						_ = trans.Rollback()
-					}
-					return 0, err
-				}
-				original := obj.(*MigrationPatchRecord)
-				original.Patch = migration.Patch
-				original.UpdatedAt = time.Now()
-				_, err = executor.Update(original)
-			}
+	applied := 0
+	for _, migration := range migrations {
+		if migration.DisableTransaction && ms.progressMap == nil {
+			progressMap, err := ms.getProgressDbMap(db, dbMap.Dialect)
 			if err != nil {
-				if trans, ok := executor.(*gorp.Transaction); ok {
-					_ = trans.Rollback()
-				}
-
 				return applied, newTxError(migration.Name, err)
 			}
-		default:
-			panic("Not possible")
+			ms.progressMap = progressMap
 		}
 
-		if trans, ok := executor.(*gorp.Transaction); ok {
-			if err := trans.Commit(); err != nil {
-				return applied, newTxError(migration.Name, err)
+		event := &MigrationEvent{MigrationPatch: migration, Direction: dir}
+		err := ms.runMigration(ctx, db, dbMap, event, migration.DisableTransaction, migration.Queries, migration.Func, func(executor SqlExecutorContext, duration time.Duration) error {
+			switch {
+			case migration.Repeatable:
+				return ms.recordRepeatable(ctx, executor, dbMap, migration.Name, migration.Up, migration.Down, duration)
+			case dir == Up:
+				return ms.upsertPatchRecord(ctx, executor, dbMap, migration.MigrationPatch, time.Now(), duration)
+			case dir == Down:
+				previous := previousPatch(all, migration.MigrationPatch)
+				if previous == nil {
+					return ms.deletePatchRecord(ctx, executor, dbMap, migration.Ver)
+				}
+				return ms.upsertPatchRecord(ctx, executor, dbMap, previous, time.Now(), duration)
+			default:
+				panic("Not possible")
 			}
+		})
+		if err != nil {
+			return applied, newTxError(migration.Name, err)
 		}
 
 		applied++
@@ -371,66 +458,52 @@ func (ms MigrationSet) ExecMaxPatch(db *sql.DB, dialect string, m MigrationSourc
 	return applied, nil
 }
 
+// previousPatch returns the patch of the same version that precedes migration,
+// or nil when migration is the first patch of its version.
+func previousPatch(migrations []*MigrationPatch, migration *MigrationPatch) *MigrationPatch {
+	var previous *MigrationPatch
+	for _, m := range migrations {
+		if m.VerInt == migration.VerInt && m.PatchInt < migration.PatchInt &&
+			(previous == nil || previous.PatchInt < m.PatchInt) {
+			previous = m
+		}
+	}
+	return previous
+}
+
 // Plan a migration.
 func PlanMigrationPatch(db *sql.DB, dialect string, m MigrationSource, dir MigrationDirection,
 	max int) ([]*PlannedMigrationPatch, *gorp.DbMap, error) {
 	return migSet.PlanMigrationPatch(db, dialect, m, dir, max)
 }
 
+// Plan a migration with a context.
+func PlanMigrationPatchContext(ctx context.Context, db *sql.DB, dialect string, m MigrationSource, dir MigrationDirection,
+	max int) ([]*PlannedMigrationPatch, *gorp.DbMap, error) {
+	return migSet.PlanMigrationPatchContext(ctx, db, dialect, m, dir, max)
+}
+
 func (ms MigrationSet) PlanMigrationPatch(db *sql.DB, dialect string, m MigrationSource, dir MigrationDirection,
 	max int) ([]*PlannedMigrationPatch, *gorp.DbMap, error) {
-	dbMap, err := ms.getMigrationDbMap(db, dialect)
+	return ms.PlanMigrationPatchContext(context.Background(), db, dialect, m, dir, max)
+}
+
+func (ms MigrationSet) PlanMigrationPatchContext(ctx context.Context, db *sql.DB, dialect string, m MigrationSource,
+	dir MigrationDirection, max int) ([]*PlannedMigrationPatch, *gorp.DbMap, error) {
+	dbMap, err := ms.getMigrationDbMap(ctx, db, dialect)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	newMigrations, err := m.FindMigrationsPatch()
+	newMigrations, existingMigrations, err := ms.loadMigrationsPatch(ctx, db, dbMap, dialect, m)
 	if err != nil {
 		return nil, nil, err
 	}
-
-	var migrationRecords []MigrationPatchRecord
-	_, err = dbMap.Select(&migrationRecords, fmt.Sprintf("SELECT * FROM %s ORDER BY ver", dbMap.Dialect.QuotedTableForQuery(ms.SchemaName, ms.getTableName())))
+	deps, err := migrationPatchDependencies(newMigrations)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	// Sort migrations that have been run by Id.
-	var existingMigrations []*MigrationPatch
-	for _, migrationRecord := range migrationRecords {
-		em := &MigrationPatch{
-			Name:  migrationRecord.Name,
-			Ver:   migrationRecord.Ver,
-			Patch: migrationRecord.Patch,
-		}
-
-		if err := em.ParseName(); err != nil {
-			return nil, nil, err
-		}
-		existingMigrations = append(existingMigrations, em)
-	}
-	sort.Sort(byIdPatch(existingMigrations))
-
-	// Make sure all migrations in the database are among the found migrations which
-	// are to be applied.
-	if !ms.IgnoreUnknown {
-		migrationsSearch := make(map[string]int64)
-		for _, migration := range newMigrations {
-			migrationsSearch[migration.Ver] = migration.PatchInt
-		}
-
-		for _, existingMigration := range existingMigrations {
-			patch, ok := migrationsSearch[existingMigration.Ver]
-
-			if !ok || existingMigration.PatchInt > patch {
-				return nil, nil, newPlanError(existingMigration.Name,
-					fmt.Sprintf("unknown migration in database (version: %s; patch: %s)",
-						existingMigration.Ver, existingMigration.Patch),
-				)
-			}
-		}
-	}
-
 	// Get last migration that was run
 	lastMigration := &MigrationPatch{}
 	if len(existingMigrations) > 0 {
@@ -442,11 +515,28 @@ func (ms MigrationSet) PlanMigrationPatch(db *sql.DB, dialect string, m Migratio
 	// Add missing migrations up to the last run migration.
 	// This can happen for example when merges happened.
 	if len(existingMigrations) > 0 {
-		result = append(result, ToCatchupPatch(newMigrations, existingMigrations, lastMigration)...)
+		skipped := ms.patchFilter()
+		var names []string
+		for _, migration := range ToCatchupPatch(newMigrations, existingMigrations, lastMigration) {
+			if skipped(migration.MigrationPatch) {
+				continue
+			}
+			names = append(names, migration.Name)
+			result = append(result, migration)
+		}
+		if err := ms.checkOutOfOrder(names, lastMigration.Name); err != nil {
+			return nil, nil, err
+		}
 	}
 
 	// Figure out which migrations to apply
-	toApply := ToApplyPatch(newMigrations, lastMigration, dir)
+	skipped := ms.patchFilter()
+	var toApply []*MigrationPatch
+	for _, migration := range ToApplyPatch(newMigrations, lastMigration, dir) {
+		if !skipped(migration) {
+			toApply = append(toApply, migration)
+		}
+	}
 	toApplyCount := len(toApply)
 	if max > 0 && max < toApplyCount {
 		toApplyCount = max
@@ -457,27 +547,148 @@ func (ms MigrationSet) PlanMigrationPatch(db *sql.DB, dialect string, m Migratio
 			result = append(result, &PlannedMigrationPatch{
 				MigrationPatch:     v,
 				Queries:            v.Up,
+				Func:               v.UpFunc,
 				DisableTransaction: v.DisableTransactionUp,
 			})
 		} else if dir == Down {
 			result = append(result, &PlannedMigrationPatch{
 				MigrationPatch:     v,
 				Queries:            v.Down,
+				Func:               v.DownFunc,
 				DisableTransaction: v.DisableTransactionDown,
 			})
 		}
 	}
 
+	// Required migrations sort first, so they only have to be checked.
+	if deps != nil {
+		applied := appliedPatchNames(newMigrations, existingMigrations)
+		if err := deps.checkPlannedPatch(result, applied, dir); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Repeatable migrations run after the versioned ones, once none are left.
+	if dir == Up && toApplyCount == len(toApply) && (max <= 0 || toApplyCount < max) {
+		remaining := 0
+		if max > 0 {
+			remaining = max - toApplyCount
+		}
+		repeatable, err := ms.planRepeatablePatch(ctx, db, dialect, m, remaining)
+		if err != nil {
+			return nil, nil, err
+		}
+		result = append(result, repeatable...)
+	}
+
+	ms.log(LogDebug, "Planned migrations", "direction", dir, "count", len(result))
 	return result, dbMap, nil
 }
 
+// loadMigrationsPatch returns the migrations of m for dialect and those applied
+// to the database, sorted by version and patch, after making sure the two
+// agree.
+func (ms MigrationSet) loadMigrationsPatch(ctx context.Context, db *sql.DB, dbMap *gorp.DbMap,
+	dialect string, m MigrationSource) ([]*MigrationPatch, []*MigrationPatch, error) {
+	if err := ms.checkDirty(ctx, db, dbMap.Dialect); err != nil {
+		return nil, nil, err
+	}
+
+	newMigrations, err := ms.findMigrationsPatch(m, dialect)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	migrationRecords, err := ms.selectPatchRecords(ctx, db, dbMap)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Sort migrations that have been run by Id.
+	var existingMigrations []*MigrationPatch
+	for _, migrationRecord := range migrationRecords {
+		em := &MigrationPatch{
+			Name:  migrationRecord.Name,
+			Ver:   migrationRecord.Ver,
+			Patch: migrationRecord.Patch,
+		}
+
+		if err := em.ParseName(); err != nil {
+			return nil, nil, err
+		}
+		existingMigrations = append(existingMigrations, em)
+	}
+	sort.Sort(byIdPatch(existingMigrations))
+
+	// Make sure all migrations in the database are among the found migrations which
+	// are to be applied.
+	migrationsSearch := make(map[string]int64)
+	for _, migration := range newMigrations {
+		migrationsSearch[migration.Ver] = migration.PatchInt
+	}
+
+	for _, existingMigration := range existingMigrations {
+		patch, ok := migrationsSearch[existingMigration.Ver]
+
+		if !ok || existingMigration.PatchInt > patch {
+			if !ms.IgnoreUnknown {
+				return nil, nil, newPlanError(existingMigration.Name,
+					fmt.Sprintf("unknown migration in database (version: %s; patch: %s)",
+						existingMigration.Ver, existingMigration.Patch),
+				)
+			}
+			ms.log(LogInfo, "Ignoring unknown migration in database",
+				"migration", existingMigration.Name, "version", existingMigration.Ver, "patch", existingMigration.Patch)
+		}
+	}
+
+	// Make sure the applied patches weren't changed since.
+	for _, migrationRecord := range migrationRecords {
+		for _, migration := range newMigrations {
+			if migration.Ver == migrationRecord.Ver && migration.Patch == migrationRecord.Patch {
+				if err := ms.verifyChecksum(migration.Name, migrationRecord.Checksum, migration.Checksum()); err != nil {
+					return nil, nil, err
+				}
+				break
+			}
+		}
+	}
+
+	return newMigrations, existingMigrations, nil
+}
+
 // Skip a set of migrations
 //
 // Will skip at most `max` migrations. Pass 0 for no limit.
 //
 // Returns the number of skipped migrations.
 func SkipMaxPatch(db *sql.DB, dialect string, m MigrationSource, dir MigrationDirection, max int) (int, error) {
-	migrations, dbMap, err := PlanMigrationPatch(db, dialect, m, dir, max)
+	return migSet.SkipMaxPatch(db, dialect, m, dir, max)
+}
+
+// Skip a set of migrations with a context
+//
+// Will skip at most `max` migrations. Pass 0 for no limit.
+//
+// Returns the number of skipped migrations.
+func SkipMaxPatchContext(ctx context.Context, db *sql.DB, dialect string, m MigrationSource, dir MigrationDirection, max int) (int, error) {
+	return migSet.SkipMaxPatchContext(ctx, db, dialect, m, dir, max)
+}
+
+// Returns the number of skipped migrations.
+func (ms MigrationSet) SkipMaxPatch(db *sql.DB, dialect string, m MigrationSource, dir MigrationDirection, max int) (int, error) {
+	return ms.SkipMaxPatchContext(context.Background(), db, dialect, m, dir, max)
+}
+
+// Returns the number of skipped migrations.
+func (ms MigrationSet) SkipMaxPatchContext(ctx context.Context, db *sql.DB, dialect string, m MigrationSource, dir MigrationDirection, max int) (int, error) {
+	lock, err := ms.lockIfEnabled(ctx, db, dialect)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = lock.Unlock() }()
+
+	migrations, dbMap, err := ms.PlanMigrationPatchContext(ctx, db, dialect, m, dir, max)
 	if err != nil {
 		return 0, err
 	}
@@ -485,54 +696,16 @@ func SkipMaxPatch(db *sql.DB, dialect string, m MigrationSource, dir MigrationDi
 	// Skip migrations
 	applied := 0
 	for _, migration := range migrations {
-		var executor SqlExecutor
-
-		if migration.DisableTransaction {
-			executor = dbMap
-		} else {
-			executor, err = dbMap.Begin()
-			if err != nil {
-				return applied, newTxError(migration.Name, err)
+		err := ms.withExecutor(ctx, db, migration.Name, migration.DisableTransaction, func(executor SqlExecutorContext) error {
+			if migration.Repeatable {
+				return ms.recordRepeatable(ctx, executor, dbMap, migration.Name, migration.Up, migration.Down, 0)
 			}
-		}
-
-		obj, err := executor.Get(MigrationPatchRecord{}, migration.Ver)
-		if err != nil {
-			if trans, ok := executor.(*gorp.Transaction); ok {
-				_ = trans.Rollback()
-			}
-			return 0, newTxError(migration.Name, err)
-		}
-
-		if obj == nil {
-			err = executor.Insert(&MigrationPatchRecord{
-				Ver:       migration.Ver,
-				Patch:     migration.Patch,
-				Name:      migration.Name,
-				CreatedAt: time.Now(),
-				UpdatedAt: time.Now(),
-			})
-		} else {
-			original := obj.(*MigrationPatchRecord)
-			original.Patch = migration.Patch
-			original.UpdatedAt = time.Now()
-			_, err = executor.Update(original)
-		}
-
+			return ms.upsertPatchRecord(ctx, executor, dbMap, migration.MigrationPatch, time.Now(), 0)
+		})
 		if err != nil {
-			if trans, ok := executor.(*gorp.Transaction); ok {
-				_ = trans.Rollback()
-			}
-
 			return applied, newTxError(migration.Name, err)
 		}
 
-		if trans, ok := executor.(*gorp.Transaction); ok {
-			if err := trans.Commit(); err != nil {
-				return applied, newTxError(migration.Name, err)
-			}
-		}
-
 		applied++
 	}
 
@@ -600,6 +773,7 @@ func ToCatchupPatch(newMigrations, existingMigrations []*MigrationPatch, last *M
 			missing = append(missing, &PlannedMigrationPatch{
 				MigrationPatch:     migration,
 				Queries:            migration.Up,
+				Func:               migration.UpFunc,
 				DisableTransaction: migration.DisableTransactionUp,
 			})
 		}
@@ -611,18 +785,19 @@ func GetMigrationPatchRecords(db *sql.DB, dialect string) ([]*MigrationPatchReco
 	return migSet.GetMigrationPatchRecords(db, dialect)
 }
 
+func GetMigrationPatchRecordsContext(ctx context.Context, db *sql.DB, dialect string) ([]*MigrationPatchRecord, error) {
+	return migSet.GetMigrationPatchRecordsContext(ctx, db, dialect)
+}
+
 func (ms MigrationSet) GetMigrationPatchRecords(db *sql.DB, dialect string) ([]*MigrationPatchRecord, error) {
-	dbMap, err := ms.getMigrationDbMap(db, dialect)
-	if err != nil {
-		return nil, err
-	}
+	return ms.GetMigrationPatchRecordsContext(context.Background(), db, dialect)
+}
 
-	var records []*MigrationPatchRecord
-	query := fmt.Sprintf("SELECT * FROM %s ORDER BY ver ASC", dbMap.Dialect.QuotedTableForQuery(ms.SchemaName, ms.getTableName()))
-	_, err = dbMap.Select(&records, query)
+func (ms MigrationSet) GetMigrationPatchRecordsContext(ctx context.Context, db *sql.DB, dialect string) ([]*MigrationPatchRecord, error) {
+	dbMap, err := ms.getMigrationDbMap(ctx, db, dialect)
 	if err != nil {
 		return nil, err
 	}
 
-	return records, nil
+	return ms.selectPatchRecords(ctx, db, dbMap)
 }
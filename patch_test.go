@@ -1,7 +1,9 @@
 package migrate
 
 import (
+	"context"
 	"net/http"
+	"strings"
 
 	"github.com/gobuffalo/packr/v2"
 	_ "github.com/mattn/go-sqlite3"
@@ -674,3 +676,135 @@ func (s *SqliteMigrateSuite) TestErrorFormatMigrationName(c *C) {
 	c.Assert(err, Not(IsNil))
 	c.Assert(n, Equals, 0)
 }
+
+func (s *SqliteMigrateSuite) TestExecContextPatch(c *C) {
+	migrations := &MemoryMigrationSource{
+		MigrationsPatch: sqliteMigrationsPatch[:2],
+	}
+
+	ms := MigrationSet{EnablePatchMode: true}
+	n, err := ms.ExecContext(context.Background(), s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+
+	records, err := ms.GetMigrationPatchRecordsContext(context.Background(), s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 2)
+	c.Assert(records[0].Ver, Equals, "0001")
+	c.Assert(records[1].Ver, Equals, "0002")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err = ms.PlanMigrationPatchContext(ctx, s.Db, "sqlite3", migrations, Up, 0)
+	c.Assert(err, Equals, context.Canceled)
+}
+
+func (s *SqliteMigrateSuite) TestSkipMaxPatchContext(c *C) {
+	migrations := &MemoryMigrationSource{
+		MigrationsPatch: sqliteMigrationsPatch[:2],
+	}
+
+	ms := MigrationSet{EnablePatchMode: true}
+	n, err := ms.SkipMaxPatchContext(context.Background(), s.Db, "sqlite3", migrations, Up, 0)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+
+	// The skipped migrations did not run
+	_, err = s.DbMap.Exec("SELECT * FROM people")
+	c.Assert(err, NotNil)
+
+	records, err := ms.GetMigrationPatchRecordsContext(context.Background(), s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 2)
+}
+
+func (s *SqliteMigrateSuite) TestGoMigrationPatch(c *C) {
+	migrations := &MultiMigrationSource{
+		Sources: []MigrationSource{
+			&FileMigrationSource{
+				Dir: "test-migrations/patch",
+			},
+			&MemoryMigrationSource{
+				MigrationsPatch: []*MigrationPatch{
+					{
+						Name: "0002_01_go.sql",
+						UpFunc: func(ctx context.Context, executor SqlExecutorContext) error {
+							_, err := executor.ExecContext(ctx, "INSERT INTO people (id) VALUES (2)")
+							return err
+						},
+						DownFunc: func(ctx context.Context, executor SqlExecutorContext) error {
+							_, err := executor.ExecContext(ctx, "DELETE FROM people WHERE id = 2")
+							return err
+						},
+					},
+				},
+			},
+		},
+	}
+
+	ms := MigrationSet{EnablePatchMode: true}
+	n, err := ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 3)
+
+	count, err := s.DbMap.SelectInt("SELECT COUNT(*) FROM people")
+	c.Assert(err, IsNil)
+	c.Assert(count, Equals, int64(2))
+
+	records, err := ms.GetMigrationPatchRecords(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 2)
+	c.Assert(records[1].Patch, Equals, "01")
+}
+
+func (s *SqliteMigrateSuite) TestTxErrorStatementPatch(c *C) {
+	migration, err := ParseMigrationPatch("0001_00_people.sql", strings.NewReader(failingMigration))
+	c.Assert(err, IsNil)
+	migrations := &MemoryMigrationSource{
+		MigrationsPatch: []*MigrationPatch{migration},
+	}
+
+	_, err = MigrationSet{EnablePatchMode: true}.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, FitsTypeOf, &TxError{})
+	txErr := err.(*TxError)
+	c.Assert(txErr.MigrationName, Equals, "0001_00_people.sql")
+	c.Assert(txErr.StatementIndex, Equals, 2)
+	c.Assert(txErr.Line, Equals, 7)
+}
+
+func (s *SqliteMigrateSuite) TestMigrateDownPatchRecord(c *C) {
+	migrations := &MemoryMigrationSource{
+		MigrationsPatch: []*MigrationPatch{
+			{Name: "0001_00_people.sql", Up: []string{"CREATE TABLE people (id int)"}, Down: []string{"DROP TABLE people"}},
+			{Name: "0001_01_name.sql", Up: []string{"ALTER TABLE people ADD COLUMN name text"}, Down: []string{"SELECT 0"}},
+		},
+	}
+
+	ms := MigrationSet{EnablePatchMode: true}
+	n, err := ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+
+	// Rolling back a patch moves the record to the one before it
+	n, err = ms.ExecMaxPatch(s.Db, "sqlite3", migrations, Down, 1)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+	records, err := ms.GetMigrationPatchRecords(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 1)
+	c.Assert(records[0].Patch, Equals, "00")
+	c.Assert(records[0].Name, Equals, "0001_00_people.sql")
+
+	planned, _, err := ms.PlanMigrationPatch(s.Db, "sqlite3", migrations, Up, 0)
+	c.Assert(err, IsNil)
+	c.Assert(planned, HasLen, 1)
+	c.Assert(planned[0].Name, Equals, "0001_01_name.sql")
+
+	// Rolling back the first patch of a version removes its record
+	n, err = ms.ExecMaxPatch(s.Db, "sqlite3", &MemoryMigrationSource{MigrationsPatch: migrations.MigrationsPatch[:1]}, Down, 1)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+	records, err = ms.GetMigrationPatchRecords(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 0)
+}
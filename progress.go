@@ -0,0 +1,308 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"gopkg.in/gorp.v1"
+)
+
+// MigrationProgress records how far a notransaction migration got before it
+// failed. The statements that completed already took effect, so the next run
+// resumes after them instead of running them again.
+type MigrationProgress struct {
+	// Migration is the Id of the migration, or its name in patch mode.
+	Migration string `db:"migration"`
+	// Direction is "up" or "down".
+	Direction string `db:"direction"`
+	// Statements is the number of statements that completed.
+	Statements int `db:"statements"`
+	// Checksum of the statements that completed. The migration is only
+	// resumed when they are unchanged.
+	Checksum  string    `db:"checksum"`
+	UpdatedAt time.Time `db:"updated_at"`
+	// Dirty is set while the migration runs. It stays set when the run
+	// ended without recording how far it got, for example because the
+	// process crashed, and then planning fails with a *DirtyError.
+	Dirty bool `db:"dirty"`
+}
+
+var migrationProgressColumns = []string{"migration", "direction", "statements", "checksum", "updated_at", "dirty"}
+
+func (ms MigrationSet) progressTableName() string {
+	return ms.getTableName() + "_progress"
+}
+
+func (ms MigrationSet) quotedProgressTable(dbMap *gorp.DbMap) string {
+	return dbMap.Dialect.QuotedTableForQuery(ms.SchemaName, ms.progressTableName())
+}
+
+// getProgressDbMap returns a DbMap for the progress table, which is only
+// created once it is needed. A run creates it once, before its first
+// notransaction migration, and keeps it in progressMap.
+func (ms MigrationSet) getProgressDbMap(db *sql.DB, dialect gorp.Dialect) (*gorp.DbMap, error) {
+	dbMap := ms.newProgressDbMap(db, dialect)
+	if err := createTables(dbMap); err != nil {
+		return nil, err
+	}
+	return dbMap, nil
+}
+
+func (ms MigrationSet) newProgressDbMap(db *sql.DB, dialect gorp.Dialect) *gorp.DbMap {
+	dbMap := &gorp.DbMap{Db: db, Dialect: dialect}
+	table := dbMap.AddTableWithNameAndSchema(MigrationProgress{}, ms.SchemaName, ms.progressTableName()).
+		SetKeys(false, "Migration")
+	table.ColMap("Checksum").SetMaxSize(64)
+	if _, ok := dialect.(OracleDialect); ok {
+		table.ColMap("Migration").SetMaxSize(4000)
+	}
+	if ms.Logger != nil {
+		dbMap.TraceOn("", gorpLogger{ms.Logger})
+	}
+	return dbMap
+}
+
+func (ms MigrationSet) selectProgress(ctx context.Context, db *sql.DB, dbMap *gorp.DbMap, suffix string, args ...interface{}) ([]*MigrationProgress, error) {
+	query := selectQuery(dbMap.Dialect, ms.quotedProgressTable(dbMap), migrationProgressColumns, suffix)
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var progress []*MigrationProgress
+	for rows.Next() {
+		p := &MigrationProgress{}
+		if err := rows.Scan(&p.Migration, &p.Direction, &p.Statements, &p.Checksum, &p.UpdatedAt, &p.Dirty); err != nil {
+			return nil, err
+		}
+		progress = append(progress, p)
+	}
+	return progress, rows.Err()
+}
+
+// progressTracker records the progress of a notransaction migration as its
+// statements complete.
+type progressTracker struct {
+	ms       MigrationSet
+	db       *sql.DB
+	dbMap    *gorp.DbMap
+	progress *MigrationProgress
+	queries  []string
+	exists   bool
+	// hasFunc is set when a Go function runs after the statements.
+	hasFunc bool
+}
+
+// trackProgress returns the tracker of the migration of event, which resumes
+// after the statements that completed in an earlier run. The migration is
+// marked dirty until the tracker is finished or interrupted.
+func (ms MigrationSet) trackProgress(ctx context.Context, db *sql.DB, dialect gorp.Dialect, event *MigrationEvent,
+	queries []string) (*progressTracker, error) {
+	dbMap := ms.progressMap
+	if dbMap == nil {
+		var err error
+		if dbMap, err = ms.getProgressDbMap(db, dialect); err != nil {
+			return nil, err
+		}
+	}
+
+	t := &progressTracker{
+		ms:      ms,
+		db:      db,
+		dbMap:   dbMap,
+		queries: queries,
+		progress: &MigrationProgress{
+			Migration: event.Name(),
+			Direction: event.Direction.String(),
+		},
+	}
+
+	found, err := ms.selectProgress(ctx, db, dbMap, fmt.Sprintf("WHERE %s = %s",
+		dbMap.Dialect.QuoteField("migration"), dbMap.Dialect.BindVar(0)), event.Name())
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		return t, t.save(ctx)
+	}
+
+	previous := found[0]
+	if previous.Direction != t.progress.Direction {
+		return nil, fmt.Errorf("Migration %s was interrupted while migrating %s, reset its progress first",
+			previous.Migration, previous.Direction)
+	}
+	if previous.Statements > len(queries) || checksum(queries[:previous.Statements], nil) != previous.Checksum {
+		return nil, fmt.Errorf("Migration %s was changed in the %d statements that already ran, reset its progress first",
+			previous.Migration, previous.Statements)
+	}
+
+	t.progress = previous
+	t.exists = true
+	return t, t.save(ctx)
+}
+
+// skip returns the number of statements that completed in an earlier run.
+func (t *progressTracker) skip() int {
+	return t.progress.Statements
+}
+
+// completed records that the first n statements completed.
+func (t *progressTracker) completed(ctx context.Context, n int) error {
+	t.progress.Statements = n
+	return t.save(ctx)
+}
+
+// save stores the progress, marked dirty.
+func (t *progressTracker) save(ctx context.Context) error {
+	t.progress.Checksum = checksum(t.queries[:t.progress.Statements], nil)
+	t.progress.UpdatedAt = time.Now()
+	t.progress.Dirty = true
+	return t.store(ctx)
+}
+
+func (t *progressTracker) store(ctx context.Context) error {
+	d := t.dbMap.Dialect
+	table := t.ms.quotedProgressTable(t.dbMap)
+	p := t.progress
+	if t.exists {
+		query := updateQuery(d, table, migrationProgressColumns[1:], "migration")
+		_, err := t.db.ExecContext(ctx, query, p.Direction, p.Statements, p.Checksum, p.UpdatedAt, p.Dirty, p.Migration)
+		return err
+	}
+
+	query := insertQuery(d, table, migrationProgressColumns)
+	if _, err := t.db.ExecContext(ctx, query, p.Migration, p.Direction, p.Statements, p.Checksum, p.UpdatedAt, p.Dirty); err != nil {
+		return err
+	}
+	t.exists = true
+	return nil
+}
+
+// finish removes the progress once the migration was recorded.
+func (t *progressTracker) finish(ctx context.Context) error {
+	_, err := t.db.ExecContext(ctx, deleteQuery(t.dbMap.Dialect, t.ms.quotedProgressTable(t.dbMap), "migration"),
+		t.progress.Migration)
+	return err
+}
+
+// interrupted records that the migration failed. It is no longer dirty, as
+// the next run knows where to resume, unless it failed after all statements
+// completed: a Go function may have taken effect in part.
+func (t *progressTracker) interrupted(ctx context.Context) error {
+	if t.hasFunc && t.progress.Statements == len(t.queries) {
+		return nil
+	}
+	if t.progress.Statements == 0 {
+		return t.finish(ctx)
+	}
+	t.progress.Dirty = false
+	return t.store(ctx)
+}
+
+// checkDirty fails with a *DirtyError when a migration was left dirty. Nothing
+// can be dirty before the progress table exists.
+func (ms MigrationSet) checkDirty(ctx context.Context, db *sql.DB, dialect gorp.Dialect) error {
+	exists, err := tableExists(ctx, db, dialect, ms.SchemaName, ms.progressTableName())
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return nil
+	}
+
+	dbMap := ms.newProgressDbMap(db, dialect)
+
+	dirty, err := ms.selectProgress(ctx, db, dbMap, fmt.Sprintf("WHERE %s = %s",
+		dbMap.Dialect.QuoteField("dirty"), dbMap.Dialect.BindVar(0)), true)
+	if err != nil {
+		return err
+	}
+	if len(dirty) > 0 {
+		return &DirtyError{MigrationName: dirty[0].Migration, Direction: dirty[0].Direction}
+	}
+	return nil
+}
+
+// Get the progress of notransaction migrations that were interrupted
+func GetMigrationProgress(db *sql.DB, dialect string) ([]*MigrationProgress, error) {
+	return migSet.GetMigrationProgress(db, dialect)
+}
+
+// Get the progress of notransaction migrations that were interrupted, with a
+// context
+func GetMigrationProgressContext(ctx context.Context, db *sql.DB, dialect string) ([]*MigrationProgress, error) {
+	return migSet.GetMigrationProgressContext(ctx, db, dialect)
+}
+
+func (ms MigrationSet) GetMigrationProgress(db *sql.DB, dialect string) ([]*MigrationProgress, error) {
+	return ms.GetMigrationProgressContext(context.Background(), db, dialect)
+}
+
+func (ms MigrationSet) GetMigrationProgressContext(ctx context.Context, db *sql.DB, dialect string) ([]*MigrationProgress, error) {
+	d, ok := MigrationDialects[dialect]
+	if !ok {
+		return nil, fmt.Errorf("Unknown dialect: %s", dialect)
+	}
+
+	// Without the progress table no progress was recorded.
+	exists, err := tableExists(ctx, db, d, ms.SchemaName, ms.progressTableName())
+	if err != nil || !exists {
+		return nil, err
+	}
+
+	dbMap := ms.newProgressDbMap(db, d)
+	return ms.selectProgress(ctx, db, dbMap, fmt.Sprintf("ORDER BY %s ASC", dbMap.Dialect.QuoteField("migration")))
+}
+
+// Reset the progress of an interrupted notransaction migration
+//
+// Its statements all run again on the next run. Pass an empty migration to
+// reset the progress of all migrations.
+func ResetMigrationProgress(db *sql.DB, dialect string, migration string) error {
+	return migSet.ResetMigrationProgress(db, dialect, migration)
+}
+
+// Reset the progress of an interrupted notransaction migration with a context
+func ResetMigrationProgressContext(ctx context.Context, db *sql.DB, dialect string, migration string) error {
+	return migSet.ResetMigrationProgressContext(ctx, db, dialect, migration)
+}
+
+func (ms MigrationSet) ResetMigrationProgress(db *sql.DB, dialect string, migration string) error {
+	return ms.ResetMigrationProgressContext(context.Background(), db, dialect, migration)
+}
+
+func (ms MigrationSet) ResetMigrationProgressContext(ctx context.Context, db *sql.DB, dialect string, migration string) error {
+	d, ok := MigrationDialects[dialect]
+	if !ok {
+		return fmt.Errorf("Unknown dialect: %s", dialect)
+	}
+
+	exists, err := tableExists(ctx, db, d, ms.SchemaName, ms.progressTableName())
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if migration == "" {
+			return nil
+		}
+		return fmt.Errorf("No progress recorded for migration %s", migration)
+	}
+
+	dbMap := ms.newProgressDbMap(db, d)
+	if migration == "" {
+		_, err = db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s", ms.quotedProgressTable(dbMap)))
+		return err
+	}
+
+	result, err := db.ExecContext(ctx, deleteQuery(dbMap.Dialect, ms.quotedProgressTable(dbMap), "migration"), migration)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("No progress recorded for migration %s", migration)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package migrate
+
+import (
+	"context"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *SqliteMigrateSuite) TestResumeNoTransaction(c *C) {
+	migration := &Migration{
+		Id: "123",
+		Up: []string{
+			"CREATE TABLE people (id int)",
+			"INSERT INTO people (id) VALUES (1)",
+			"INSERT INTO nowhere (id) VALUES (2)",
+		},
+		Down:                 []string{"DROP TABLE people"},
+		DisableTransactionUp: true,
+	}
+	migrations := &MemoryMigrationSource{
+		Migrations: []*Migration{migration},
+	}
+
+	ms := MigrationSet{}
+	_, err := ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, FitsTypeOf, &TxError{})
+	c.Assert(err.(*TxError).StatementIndex, Equals, 2)
+
+	progress, err := ms.GetMigrationProgress(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(progress, HasLen, 1)
+	c.Assert(progress[0].Migration, Equals, "123")
+	c.Assert(progress[0].Direction, Equals, "up")
+	c.Assert(progress[0].Statements, Equals, 2)
+	c.Assert(progress[0].Dirty, Equals, false)
+
+	// Fixing the failed statement resumes after the completed ones
+	migration.Up[2] = "INSERT INTO people (id) VALUES (2)"
+	hooks := &recordingHooks{}
+	ms.Hooks = hooks
+	n, err := ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+	c.Assert(hooks.calls, DeepEquals, []string{"plan 0", "before 123", "statement 123 2", "after 123"})
+
+	count, err := s.DbMap.SelectInt("SELECT COUNT(*) FROM people")
+	c.Assert(err, IsNil)
+	c.Assert(count, Equals, int64(2))
+
+	progress, err = ms.GetMigrationProgress(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(progress, HasLen, 0)
+}
+
+func (s *SqliteMigrateSuite) TestResumeChangedStatements(c *C) {
+	migration := &Migration{
+		Id:                   "123",
+		Up:                   []string{"CREATE TABLE people (id int)", "SELECT * FROM nowhere"},
+		Down:                 []string{"DROP TABLE people"},
+		DisableTransactionUp: true,
+	}
+	migrations := &MemoryMigrationSource{
+		Migrations: []*Migration{migration},
+	}
+
+	ms := MigrationSet{}
+	_, err := ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, NotNil)
+
+	// A statement that already ran was changed
+	migration.Up = []string{"CREATE TABLE people (id int, name text)", "SELECT 1"}
+	_, err = ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, ErrorMatches, "Migration 123 was changed in the 1 statements that already ran.*")
+
+	// Resetting the progress runs all of them again
+	c.Assert(ms.ResetMigrationProgress(s.Db, "sqlite3", "124"), NotNil)
+	c.Assert(ms.ResetMigrationProgress(s.Db, "sqlite3", "123"), IsNil)
+	_, err = s.Db.Exec("DROP TABLE people")
+	c.Assert(err, IsNil)
+	_, err = ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+}
+
+func (s *SqliteMigrateSuite) TestResumeNoTransactionPatch(c *C) {
+	migration := &MigrationPatch{
+		Name:                 "0001_00_initial.sql",
+		Up:                   []string{"CREATE TABLE people (id int)", "SELECT * FROM nowhere"},
+		Down:                 []string{"DROP TABLE people"},
+		DisableTransactionUp: true,
+	}
+	migrations := &MemoryMigrationSource{
+		MigrationsPatch: []*MigrationPatch{migration},
+	}
+
+	ms := MigrationSet{EnablePatchMode: true}
+	_, err := ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, NotNil)
+
+	progress, err := ms.GetMigrationProgress(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(progress, HasLen, 1)
+	c.Assert(progress[0].Migration, Equals, "0001_00_initial.sql")
+
+	migration.Up[1] = "SELECT 1"
+	_, err = ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+}
+
+func (s *SqliteMigrateSuite) TestProgressTableCreatedOnce(c *C) {
+	ms := MigrationSet{}
+
+	// Reading the progress doesn't create the table
+	progress, err := ms.GetMigrationProgress(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(progress, HasLen, 0)
+	c.Assert(ms.ResetMigrationProgress(s.Db, "sqlite3", ""), IsNil)
+	_, _, err = ms.PlanMigration(s.Db, "sqlite3", &MemoryMigrationSource{Migrations: sqliteMigrations}, Up, 0)
+	c.Assert(err, IsNil)
+	exists, err := tableExists(context.Background(), s.Db, MigrationDialects["sqlite3"], "", ms.progressTableName())
+	c.Assert(err, IsNil)
+	c.Assert(exists, Equals, false)
+
+	// A run with notransaction migrations does
+	migrations := &MemoryMigrationSource{
+		Migrations: []*Migration{
+			{Id: "1", Up: []string{"CREATE TABLE people (id int)"}, DisableTransactionUp: true},
+			{Id: "2", Up: []string{"CREATE TABLE pets (id int)"}, DisableTransactionUp: true},
+		},
+	}
+	n, err := ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+	exists, err = tableExists(context.Background(), s.Db, MigrationDialects["sqlite3"], "", ms.progressTableName())
+	c.Assert(err, IsNil)
+	c.Assert(exists, Equals, true)
+}
@@ -0,0 +1,362 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"os/user"
+	"reflect"
+	"strings"
+	"time"
+
+	"gopkg.in/gorp.v1"
+)
+
+// gorp.v1 has no notion of a context, so the rows of the migration table are
+// read and written with plain database/sql calls. The table itself is still
+// created by gorp (see getMigrationDbMap), so the column names below have to
+// match the db tags of MigrationRecord and MigrationPatchRecord.
+
+func (ms MigrationSet) quotedTable(dbMap *gorp.DbMap) string {
+	return dbMap.Dialect.QuotedTableForQuery(ms.SchemaName, ms.getTableName())
+}
+
+func quoteFields(d gorp.Dialect, columns []string) []string {
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = d.QuoteField(column)
+	}
+	return quoted
+}
+
+func selectQuery(d gorp.Dialect, table string, columns []string, suffix string) string {
+	query := fmt.Sprintf("SELECT %s FROM %s", strings.Join(quoteFields(d, columns), ", "), table)
+	if suffix != "" {
+		query += " " + suffix
+	}
+	return query
+}
+
+func insertQuery(d gorp.Dialect, table string, columns []string) string {
+	binds := make([]string, len(columns))
+	for i := range columns {
+		binds[i] = d.BindVar(i)
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		table, strings.Join(quoteFields(d, columns), ", "), strings.Join(binds, ", "))
+}
+
+// updateQuery builds an UPDATE of columns keyed on key. The key is bound
+// last, after the values of columns.
+func updateQuery(d gorp.Dialect, table string, columns []string, key string) string {
+	sets := make([]string, len(columns))
+	for i, column := range columns {
+		sets[i] = fmt.Sprintf("%s = %s", d.QuoteField(column), d.BindVar(i))
+	}
+	return fmt.Sprintf("UPDATE %s SET %s WHERE %s = %s",
+		table, strings.Join(sets, ", "), d.QuoteField(key), d.BindVar(len(columns)))
+}
+
+func deleteQuery(d gorp.Dialect, table string, key string) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE %s = %s", table, d.QuoteField(key), d.BindVar(0))
+}
+
+var migrationRecordColumns = []string{"id", "applied_at", "checksum", "duration_ms", "applied_by", "host", "tool_version"}
+
+// upgradedFields are the fields of MigrationRecord and MigrationPatchRecord
+// that were added after their tables were first released.
+var upgradedFields = []string{"Checksum", "DurationMs", "AppliedBy", "Host", "ToolVersion"}
+
+// nullableFields scans the columns added by an upgrade, which are NULL for
+// migrations applied before.
+type nullableFields struct {
+	checksum    sql.NullString
+	durationMs  sql.NullInt64
+	appliedBy   sql.NullString
+	host        sql.NullString
+	toolVersion sql.NullString
+}
+
+func (f *nullableFields) dest() []interface{} {
+	return []interface{}{&f.checksum, &f.durationMs, &f.appliedBy, &f.host, &f.toolVersion}
+}
+
+// newRecord returns the record of migration, applied by this process.
+func (ms MigrationSet) newRecord(migration *Migration, duration time.Duration) *MigrationRecord {
+	appliedUser, appliedHost := appliedBy()
+	return &MigrationRecord{
+		Id:          migration.Id,
+		AppliedAt:   time.Now(),
+		Checksum:    migration.Checksum(),
+		DurationMs:  int64(duration / time.Millisecond),
+		AppliedBy:   appliedUser,
+		Host:        appliedHost,
+		ToolVersion: ms.getToolVersion(),
+	}
+}
+
+// appliedBy returns the OS user and the host of this process.
+func appliedBy() (string, string) {
+	name := os.Getenv("USER")
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	host, _ := os.Hostname()
+	return name, host
+}
+
+func (ms MigrationSet) selectRecords(ctx context.Context, executor SqlExecutorContext, dbMap *gorp.DbMap) ([]*MigrationRecord, error) {
+	query := selectQuery(dbMap.Dialect, ms.quotedTable(dbMap), migrationRecordColumns,
+		fmt.Sprintf("ORDER BY %s ASC", dbMap.Dialect.QuoteField("id")))
+	rows, err := executor.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var records []*MigrationRecord
+	for rows.Next() {
+		record := &MigrationRecord{}
+		var fields nullableFields
+		if err := rows.Scan(append([]interface{}{&record.Id, &record.AppliedAt}, fields.dest()...)...); err != nil {
+			return nil, err
+		}
+		record.Checksum = fields.checksum.String
+		record.DurationMs = fields.durationMs.Int64
+		record.AppliedBy = fields.appliedBy.String
+		record.Host = fields.host.String
+		record.ToolVersion = fields.toolVersion.String
+		records = append(records, record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+func (ms MigrationSet) insertRecord(ctx context.Context, executor SqlExecutorContext, dbMap *gorp.DbMap, record *MigrationRecord) error {
+	query := insertQuery(dbMap.Dialect, ms.quotedTable(dbMap), migrationRecordColumns)
+	_, err := executor.ExecContext(ctx, query, record.Id, record.AppliedAt, record.Checksum,
+		record.DurationMs, record.AppliedBy, record.Host, record.ToolVersion)
+	return err
+}
+
+func (ms MigrationSet) deleteRecord(ctx context.Context, executor SqlExecutorContext, dbMap *gorp.DbMap, id string) error {
+	query := deleteQuery(dbMap.Dialect, ms.quotedTable(dbMap), "id")
+	_, err := executor.ExecContext(ctx, query, id)
+	return err
+}
+
+var migrationPatchRecordColumns = []string{"ver", "patch", "name", "created_at", "updated_at", "checksum",
+	"duration_ms", "applied_by", "host", "tool_version"}
+
+func scanPatchRecord(scanner interface{ Scan(...interface{}) error }) (*MigrationPatchRecord, error) {
+	record := &MigrationPatchRecord{}
+	var fields nullableFields
+	err := scanner.Scan(append([]interface{}{&record.Ver, &record.Patch, &record.Name, &record.CreatedAt, &record.UpdatedAt},
+		fields.dest()...)...)
+	if err != nil {
+		return nil, err
+	}
+	record.Checksum = fields.checksum.String
+	record.DurationMs = fields.durationMs.Int64
+	record.AppliedBy = fields.appliedBy.String
+	record.Host = fields.host.String
+	record.ToolVersion = fields.toolVersion.String
+	return record, nil
+}
+
+func (ms MigrationSet) selectPatchRecords(ctx context.Context, executor SqlExecutorContext, dbMap *gorp.DbMap) ([]*MigrationPatchRecord, error) {
+	query := selectQuery(dbMap.Dialect, ms.quotedTable(dbMap), migrationPatchRecordColumns,
+		fmt.Sprintf("ORDER BY %s ASC", dbMap.Dialect.QuoteField("ver")))
+	rows, err := executor.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var records []*MigrationPatchRecord
+	for rows.Next() {
+		record, err := scanPatchRecord(rows)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// getPatchRecord returns the record of version ver, or nil when that version
+// has not been applied.
+func (ms MigrationSet) getPatchRecord(ctx context.Context, executor SqlExecutorContext, dbMap *gorp.DbMap, ver string) (*MigrationPatchRecord, error) {
+	query := selectQuery(dbMap.Dialect, ms.quotedTable(dbMap), migrationPatchRecordColumns,
+		fmt.Sprintf("WHERE %s = %s", dbMap.Dialect.QuoteField("ver"), dbMap.Dialect.BindVar(0)))
+	record, err := scanPatchRecord(executor.QueryRowContext(ctx, query, ver))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return record, err
+}
+
+func (ms MigrationSet) insertPatchRecord(ctx context.Context, executor SqlExecutorContext, dbMap *gorp.DbMap, record *MigrationPatchRecord) error {
+	query := insertQuery(dbMap.Dialect, ms.quotedTable(dbMap), migrationPatchRecordColumns)
+	_, err := executor.ExecContext(ctx, query, record.Ver, record.Patch, record.Name, record.CreatedAt, record.UpdatedAt, record.Checksum,
+		record.DurationMs, record.AppliedBy, record.Host, record.ToolVersion)
+	return err
+}
+
+func (ms MigrationSet) updatePatchRecord(ctx context.Context, executor SqlExecutorContext, dbMap *gorp.DbMap, record *MigrationPatchRecord) error {
+	query := updateQuery(dbMap.Dialect, ms.quotedTable(dbMap), migrationPatchRecordColumns[1:], "ver")
+	_, err := executor.ExecContext(ctx, query, record.Patch, record.Name, record.CreatedAt, record.UpdatedAt, record.Checksum,
+		record.DurationMs, record.AppliedBy, record.Host, record.ToolVersion, record.Ver)
+	return err
+}
+
+func (ms MigrationSet) deletePatchRecord(ctx context.Context, executor SqlExecutorContext, dbMap *gorp.DbMap, ver string) error {
+	query := deleteQuery(dbMap.Dialect, ms.quotedTable(dbMap), "ver")
+	_, err := executor.ExecContext(ctx, query, ver)
+	return err
+}
+
+// upsertPatchRecord stores migration as the applied patch of its version,
+// which took duration to run.
+func (ms MigrationSet) upsertPatchRecord(ctx context.Context, executor SqlExecutorContext, dbMap *gorp.DbMap, migration *MigrationPatch,
+	now time.Time, duration time.Duration) error {
+	original, err := ms.getPatchRecord(ctx, executor, dbMap, migration.Ver)
+	if err != nil {
+		return err
+	}
+
+	appliedUser, appliedHost := appliedBy()
+	if original == nil {
+		return ms.insertPatchRecord(ctx, executor, dbMap, &MigrationPatchRecord{
+			Ver:         migration.Ver,
+			Patch:       migration.Patch,
+			Name:        migration.Name,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+			Checksum:    migration.Checksum(),
+			DurationMs:  int64(duration / time.Millisecond),
+			AppliedBy:   appliedUser,
+			Host:        appliedHost,
+			ToolVersion: ms.getToolVersion(),
+		})
+	}
+
+	original.Patch = migration.Patch
+	original.UpdatedAt = now
+	original.Checksum = migration.Checksum()
+	original.DurationMs = int64(duration / time.Millisecond)
+	original.AppliedBy = appliedUser
+	original.Host = appliedHost
+	original.ToolVersion = ms.getToolVersion()
+	return ms.updatePatchRecord(ctx, executor, dbMap, original)
+}
+
+// upgradeTable adds the columns of fields, which were added to record after its
+// table was first released, to a migration table created by an older version.
+// Tables that don't have the key column have another layout and are left
+// alone.
+func (ms MigrationSet) upgradeTable(ctx context.Context, db *sql.DB, dbMap *gorp.DbMap, dialect string,
+	table *gorp.TableMap, record interface{}, key string, fields ...string) error {
+	existing, err := tableColumns(ctx, db, ms.quotedTable(dbMap))
+	if err != nil {
+		return err
+	}
+	if !existing[key] {
+		return nil
+	}
+
+	recordType := reflect.TypeOf(record)
+	for _, field := range fields {
+		column := table.ColMap(field)
+		if existing[strings.ToLower(column.ColumnName)] {
+			continue
+		}
+
+		structField, _ := recordType.FieldByName(field)
+		columnType := dbMap.Dialect.ToSqlType(structField.Type, column.MaxSize, false)
+		if _, err := db.ExecContext(ctx, addColumnQuery(dialect, ms.quotedTable(dbMap),
+			dbMap.Dialect.QuoteField(column.ColumnName), columnType)); err != nil {
+			return fmt.Errorf("Cannot upgrade migration table: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// tableExists reports whether table exists in schema, or in the default
+// schema when that is empty.
+func tableExists(ctx context.Context, db *sql.DB, d gorp.Dialect, schema, table string) (bool, error) {
+	var query string
+	args := []interface{}{schema, table}
+	switch d.(type) {
+	case gorp.SqliteDialect:
+		query = "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?"
+		if schema != "" {
+			query = "SELECT COUNT(*) FROM " + d.QuoteField(schema) + ".sqlite_master WHERE type = 'table' AND name = ?"
+		}
+		args = args[1:]
+	case gorp.PostgresDialect:
+		query = "SELECT COUNT(*) FROM information_schema.tables " +
+			"WHERE table_schema = COALESCE(NULLIF($1, ''), current_schema()) AND table_name = $2"
+	case gorp.MySQLDialect:
+		query = "SELECT COUNT(*) FROM information_schema.tables " +
+			"WHERE table_schema = COALESCE(NULLIF(?, ''), DATABASE()) AND table_name = ?"
+	case gorp.SqlServerDialect:
+		query = "SELECT COUNT(*) FROM information_schema.tables " +
+			"WHERE table_schema = COALESCE(NULLIF(?, ''), SCHEMA_NAME()) AND table_name = ?"
+	case OracleDialect:
+		// Oracle stores an empty string as NULL.
+		query = "SELECT COUNT(*) FROM all_tables " +
+			"WHERE UPPER(owner) = UPPER(COALESCE(:1, USER)) AND UPPER(table_name) = UPPER(:2)"
+	default:
+		// Without a catalog to ask, a table that can't be read is taken
+		// not to exist.
+		_, err := tableColumns(ctx, db, d.QuotedTableForQuery(schema, table))
+		return err == nil, nil
+	}
+
+	var n int
+	if err := db.QueryRowContext(ctx, query, args...).Scan(&n); err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// tableColumns returns the lower cased column names of the quoted table. It
+// fails when the table doesn't exist.
+func tableColumns(ctx context.Context, db *sql.DB, table string) (map[string]bool, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("SELECT * FROM %s WHERE 1 = 0", table))
+	if err != nil {
+		return nil, err
+	}
+	columns, err := rows.Columns()
+	_ = rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	existing := make(map[string]bool)
+	for _, column := range columns {
+		existing[strings.ToLower(column)] = true
+	}
+	return existing, nil
+}
+
+func addColumnQuery(dialect, table, column, columnType string) string {
+	switch dialect {
+	case "mssql":
+		return fmt.Sprintf("ALTER TABLE %s ADD %s %s", table, column, columnType)
+	case "oci8", "godror":
+		return fmt.Sprintf("ALTER TABLE %s ADD (%s %s)", table, column, columnType)
+	default:
+		return fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, columnType)
+	}
+}
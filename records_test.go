@@ -0,0 +1,76 @@
+package migrate
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *SqliteMigrateSuite) TestRecordDetails(c *C) {
+	migrations := &MemoryMigrationSource{
+		Migrations: sqliteMigrations[:1],
+	}
+
+	ms := MigrationSet{ToolVersion: "my-tool 2.0"}
+	_, err := ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+
+	records, err := ms.GetMigrationRecords(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 1)
+	c.Assert(records[0].DurationMs >= 0, Equals, true)
+	c.Assert(records[0].Host, Not(Equals), "")
+	c.Assert(records[0].ToolVersion, Equals, "my-tool 2.0")
+}
+
+func (s *SqliteMigrateSuite) TestRecordUpgradesTable(c *C) {
+	// Table layout before details were stored, with a migration applied
+	_, err := s.Db.Exec(`CREATE TABLE gorp_migrations (id varchar(255) not null primary key, applied_at datetime, checksum varchar(255))`)
+	c.Assert(err, IsNil)
+	_, err = s.Db.Exec(`INSERT INTO gorp_migrations (id, applied_at) VALUES (?, ?)`, "123", time.Now())
+	c.Assert(err, IsNil)
+	_, err = s.Db.Exec(`CREATE TABLE people (id int)`)
+	c.Assert(err, IsNil)
+
+	migrations := &MemoryMigrationSource{
+		Migrations: sqliteMigrations[:2],
+	}
+
+	ms := MigrationSet{}
+	n, err := ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+
+	records, err := ms.GetMigrationRecords(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 2)
+	c.Assert(records[0].ToolVersion, Equals, "")
+	c.Assert(records[1].ToolVersion, Equals, "sql-migrate "+Version)
+}
+
+func (s *SqliteMigrateSuite) TestRecordUpgradesPatchTable(c *C) {
+	_, err := s.Db.Exec(`CREATE TABLE gorp_migrations (ver int not null primary key, patch int, name varchar(255),
+		created_at datetime, updated_at datetime)`)
+	c.Assert(err, IsNil)
+
+	migrations := &MemoryMigrationSource{
+		MigrationsPatch: []*MigrationPatch{
+			{
+				Name: "0001_00_initial.sql",
+				Up:   []string{"CREATE TABLE people (id int)"},
+				Down: []string{"DROP TABLE people"},
+			},
+		},
+	}
+
+	ms := MigrationSet{EnablePatchMode: true}
+	_, err = ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+
+	records, err := ms.GetMigrationPatchRecords(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 1)
+	c.Assert(records[0].Checksum, Equals, migrations.MigrationsPatch[0].Checksum())
+	c.Assert(records[0].ToolVersion, Equals, "sql-migrate "+Version)
+	c.Assert(records[0].Host, Not(Equals), "")
+}
@@ -0,0 +1,234 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/gorp.v1"
+
+	"github.com/rubenv/sql-migrate/sqlparse"
+)
+
+// repeatablePrefix starts the names of repeatable migrations.
+const repeatablePrefix = "R_"
+
+// The checksum of a repeatable migration only covers its statements, so a
+// changed Go function would never run again.
+const errRepeatableFunc = "repeatable migrations cannot have Go functions"
+
+func isRepeatable(name string, r io.ReadSeeker) (bool, error) {
+	if strings.HasPrefix(name, repeatablePrefix) {
+		return true, nil
+	}
+	return sqlparse.IsRepeatable(r)
+}
+
+// findMigrations returns the versioned migrations of m for dialect.
+func (ms MigrationSet) findMigrations(m MigrationSource, dialect string) ([]*Migration, error) {
+	all, err := ms.findAllMigrations(m, dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]*Migration, 0, len(all))
+	for _, migration := range all {
+		if !migration.Repeatable {
+			migrations = append(migrations, migration)
+		}
+	}
+	return migrations, nil
+}
+
+// findRepeatable returns the repeatable migrations of m for dialect.
+func (ms MigrationSet) findRepeatable(m MigrationSource, dialect string) ([]*Migration, error) {
+	all, err := ms.findAllMigrations(m, dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []*Migration
+	for _, migration := range all {
+		if migration.Repeatable {
+			if migration.UpFunc != nil || migration.DownFunc != nil {
+				return nil, newPlanError(migration.Id, errRepeatableFunc)
+			}
+			migrations = append(migrations, migration)
+		}
+	}
+	return migrations, nil
+}
+
+// findMigrationsPatch returns the versioned patch mode migrations of m for
+// dialect.
+func (ms MigrationSet) findMigrationsPatch(m MigrationSource, dialect string) ([]*MigrationPatch, error) {
+	all, err := ms.findAllMigrationsPatch(m, dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]*MigrationPatch, 0, len(all))
+	for _, migration := range all {
+		if !migration.Repeatable {
+			migrations = append(migrations, migration)
+		}
+	}
+	return migrations, nil
+}
+
+// findRepeatablePatch returns the repeatable patch mode migrations of m for
+// dialect.
+func (ms MigrationSet) findRepeatablePatch(m MigrationSource, dialect string) ([]*MigrationPatch, error) {
+	all, err := ms.findAllMigrationsPatch(m, dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []*MigrationPatch
+	for _, migration := range all {
+		if migration.Repeatable {
+			if migration.UpFunc != nil || migration.DownFunc != nil {
+				return nil, newPlanError(migration.Name, errRepeatableFunc)
+			}
+			migrations = append(migrations, migration)
+		}
+	}
+	// They have no version to be sorted by.
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Name < migrations[j].Name })
+	return migrations, nil
+}
+
+// repeatableSet returns the set that records repeatable migrations, in the
+// <table>_repeatable table. In both modes it has the layout of the legacy
+// migration table, keyed on the name of the migration.
+func (ms MigrationSet) repeatableSet() MigrationSet {
+	rs := ms
+	rs.TableName = ms.getTableName() + "_repeatable"
+	rs.EnablePatchMode = false
+	return rs
+}
+
+// repeatableChecksums returns the checksums the repeatable migrations last ran
+// with, by name.
+func (ms MigrationSet) repeatableChecksums(ctx context.Context, db *sql.DB, dialect string) (map[string]string, error) {
+	records, err := ms.GetRepeatableRecordsContext(ctx, db, dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	checksums := make(map[string]string)
+	for _, record := range records {
+		checksums[record.Id] = record.Checksum
+	}
+	return checksums, nil
+}
+
+// planRepeatable returns the repeatable migrations of m that never ran or
+// changed since they last ran, sorted by name. No more than max are planned
+// when max is positive.
+func (ms MigrationSet) planRepeatable(ctx context.Context, db *sql.DB, dialect string, m MigrationSource,
+	max int) ([]*PlannedMigration, error) {
+	repeatable, err := ms.findRepeatable(m, dialect)
+	if err != nil || len(repeatable) == 0 {
+		return nil, err
+	}
+
+	checksums, err := ms.repeatableChecksums(ctx, db, dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*PlannedMigration
+	for _, migration := range repeatable {
+		if max > 0 && len(result) == max {
+			break
+		}
+		if checksum, ok := checksums[migration.Id]; ok && checksum == migration.Checksum() {
+			continue
+		}
+		if ms.skipped(migration.Id, migration.Tags) {
+			continue
+		}
+		result = append(result, &PlannedMigration{
+			Migration:          migration,
+			Queries:            migration.Up,
+			Func:               migration.UpFunc,
+			DisableTransaction: migration.DisableTransactionUp,
+		})
+	}
+	return result, nil
+}
+
+// planRepeatablePatch is planRepeatable for patch mode.
+func (ms MigrationSet) planRepeatablePatch(ctx context.Context, db *sql.DB, dialect string, m MigrationSource,
+	max int) ([]*PlannedMigrationPatch, error) {
+	repeatable, err := ms.findRepeatablePatch(m, dialect)
+	if err != nil || len(repeatable) == 0 {
+		return nil, err
+	}
+
+	checksums, err := ms.repeatableChecksums(ctx, db, dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*PlannedMigrationPatch
+	for _, migration := range repeatable {
+		if max > 0 && len(result) == max {
+			break
+		}
+		if checksum, ok := checksums[migration.Name]; ok && checksum == migration.Checksum() {
+			continue
+		}
+		if ms.skipped(migration.Name, migration.Tags) {
+			continue
+		}
+		result = append(result, &PlannedMigrationPatch{
+			MigrationPatch:     migration,
+			Queries:            migration.Up,
+			Func:               migration.UpFunc,
+			DisableTransaction: migration.DisableTransactionUp,
+		})
+	}
+	return result, nil
+}
+
+// recordRepeatable stores the checksum the repeatable migration named name
+// ran with.
+func (ms MigrationSet) recordRepeatable(ctx context.Context, executor SqlExecutorContext, dbMap *gorp.DbMap,
+	name string, up, down []string, duration time.Duration) error {
+	rs := ms.repeatableSet()
+	if err := rs.deleteRecord(ctx, executor, dbMap, name); err != nil {
+		return err
+	}
+	return rs.insertRecord(ctx, executor, dbMap, rs.newRecord(&Migration{Id: name, Up: up, Down: down}, duration))
+}
+
+// Get the records of the repeatable migrations that ran
+//
+// A record holds the checksum a repeatable migration last ran with.
+func GetRepeatableRecords(db *sql.DB, dialect string) ([]*MigrationRecord, error) {
+	return migSet.GetRepeatableRecords(db, dialect)
+}
+
+// Get the records of the repeatable migrations that ran with a context
+func GetRepeatableRecordsContext(ctx context.Context, db *sql.DB, dialect string) ([]*MigrationRecord, error) {
+	return migSet.GetRepeatableRecordsContext(ctx, db, dialect)
+}
+
+func (ms MigrationSet) GetRepeatableRecords(db *sql.DB, dialect string) ([]*MigrationRecord, error) {
+	return ms.GetRepeatableRecordsContext(context.Background(), db, dialect)
+}
+
+func (ms MigrationSet) GetRepeatableRecordsContext(ctx context.Context, db *sql.DB, dialect string) ([]*MigrationRecord, error) {
+	rs := ms.repeatableSet()
+	dbMap, err := rs.getMigrationDbMap(ctx, db, dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	return rs.selectRecords(ctx, db, dbMap)
+}
@@ -0,0 +1,143 @@
+package migrate
+
+import (
+	"context"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+const repeatableView = `-- +migrate Repeatable
+-- +migrate Up
+DROP VIEW IF EXISTS adults;
+CREATE VIEW adults AS SELECT id FROM people WHERE age >= %s;
+`
+
+func (s *SqliteMigrateSuite) TestRepeatableMigration(c *C) {
+	view, err := ParseMigration("adults.sql", strings.NewReader(strings.Replace(repeatableView, "%s", "18", 1)))
+	c.Assert(err, IsNil)
+	c.Assert(view.Repeatable, Equals, true)
+	migrations := &MemoryMigrationSource{
+		Migrations: []*Migration{
+			{
+				Id:   "1_people.sql",
+				Up:   []string{"CREATE TABLE people (id int, age int)"},
+				Down: []string{"DROP TABLE people"},
+			},
+			view,
+			{
+				Id:         "R_count.sql",
+				Up:         []string{"DROP VIEW IF EXISTS people_count", "CREATE VIEW people_count AS SELECT COUNT(*) AS n FROM people"},
+				Repeatable: true,
+			},
+		},
+	}
+
+	// Repeatable migrations run after the versioned ones
+	ms := MigrationSet{}
+	planned, _, err := ms.PlanMigration(s.Db, "sqlite3", migrations, Up, 0)
+	c.Assert(err, IsNil)
+	c.Assert(planned, HasLen, 3)
+	c.Assert(planned[0].Id, Equals, "1_people.sql")
+	c.Assert(planned[1].Id, Equals, "R_count.sql")
+	c.Assert(planned[2].Id, Equals, "adults.sql")
+
+	planned, _, err = ms.PlanMigration(s.Db, "sqlite3", migrations, Up, 1)
+	c.Assert(err, IsNil)
+	c.Assert(planned, HasLen, 1)
+
+	n, err := ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 3)
+	records, err := ms.GetMigrationRecords(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 1)
+
+	// Unchanged, they don't run again
+	n, err = ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 0)
+
+	changed, err := ParseMigration("adults.sql", strings.NewReader(strings.Replace(repeatableView, "%s", "21", 1)))
+	c.Assert(err, IsNil)
+	migrations.Migrations[1] = changed
+	n, err = ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+	_, err = s.Db.Exec("INSERT INTO people (id, age) VALUES (1, 20)")
+	c.Assert(err, IsNil)
+	var count int
+	c.Assert(s.Db.QueryRow("SELECT COUNT(*) FROM adults").Scan(&count), IsNil)
+	c.Assert(count, Equals, 0)
+
+	repeatable, err := ms.GetRepeatableRecords(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(repeatable, HasLen, 2)
+	c.Assert(repeatable[1].Id, Equals, "adults.sql")
+	c.Assert(repeatable[1].Checksum, Equals, changed.Checksum())
+
+	// Rolling back leaves them alone
+	n, err = ms.ExecMax(s.Db, "sqlite3", migrations, Down, 0)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+}
+
+func (s *SqliteMigrateSuite) TestRepeatableMigrationPatch(c *C) {
+	view, err := ParseMigrationPatch("R_adults.sql", strings.NewReader(strings.Replace(repeatableView, "%s", "18", 1)))
+	c.Assert(err, IsNil)
+	c.Assert(view.Repeatable, Equals, true)
+	migrations := &MemoryMigrationSource{
+		MigrationsPatch: []*MigrationPatch{
+			view,
+			{
+				Name: "0001_00_people.sql",
+				Up:   []string{"CREATE TABLE people (id int, age int)"},
+				Down: []string{"DROP TABLE people"},
+			},
+		},
+	}
+
+	ms := MigrationSet{EnablePatchMode: true}
+	n, err := ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+	_, err = s.Db.Exec("SELECT * FROM adults")
+	c.Assert(err, IsNil)
+
+	n, err = ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 0)
+}
+
+func (s *SqliteMigrateSuite) TestRepeatableMemoryName(c *C) {
+	migrations := &MemoryMigrationSource{
+		MigrationsPatch: []*MigrationPatch{
+			{Name: "R_view.sql", Up: []string{"DROP VIEW IF EXISTS people_ids", "CREATE VIEW people_ids AS SELECT id FROM people"}},
+			{Name: "0001_00_people.sql", Up: []string{"CREATE TABLE people (id int)"}, Down: []string{"DROP TABLE people"}},
+		},
+	}
+
+	// The R_ prefix makes it repeatable, as it does for files
+	ms := MigrationSet{EnablePatchMode: true}
+	n, err := ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+	c.Assert(migrations.MigrationsPatch[0].Repeatable, Equals, false)
+
+	records, err := ms.GetRepeatableRecords(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 1)
+	c.Assert(records[0].Id, Equals, "R_view.sql")
+}
+
+func (s *SqliteMigrateSuite) TestRepeatableFunc(c *C) {
+	migrations := &MemoryMigrationSource{
+		Migrations: []*Migration{
+			{Id: "R_func.sql", UpFunc: func(ctx context.Context, executor SqlExecutorContext) error { return nil }},
+		},
+	}
+
+	_, _, err := MigrationSet{}.PlanMigration(s.Db, "sqlite3", migrations, Up, 0)
+	c.Assert(err, FitsTypeOf, &PlanError{})
+	c.Assert(err, ErrorMatches, ".*repeatable migrations cannot have Go functions.*")
+}
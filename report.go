@@ -0,0 +1,166 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Report describes the migrations run by ExecReport or ExecToReport, in the
+// order they ran.
+type Report struct {
+	Migrations []*MigrationReport
+}
+
+// MigrationReport describes a migration that was run. When it failed, Err is
+// set and its statements were rolled back, unless it ran outside of a
+// transaction.
+type MigrationReport struct {
+	// Name is the Id of the migration, or its name in patch mode.
+	Name          string
+	Direction     MigrationDirection
+	InTransaction bool
+	StartedAt     time.Time
+	FinishedAt    time.Time
+	Statements    []*StatementReport
+	Err           error
+}
+
+// Duration returns how long the migration took.
+func (r *MigrationReport) Duration() time.Duration {
+	return r.FinishedAt.Sub(r.StartedAt)
+}
+
+// RowsAffected returns the total number of rows affected by the statements of
+// the migration, leaving out statements that didn't report it.
+func (r *MigrationReport) RowsAffected() int64 {
+	var rows int64
+	for _, stmt := range r.Statements {
+		if stmt.RowsAffected > 0 {
+			rows += stmt.RowsAffected
+		}
+	}
+	return rows
+}
+
+// StatementReport describes a statement of a migration that was run.
+type StatementReport struct {
+	Query    string
+	Duration time.Duration
+	// RowsAffected is -1 when the driver doesn't report it.
+	RowsAffected int64
+}
+
+// Execute a set of migrations and report on them
+//
+// Will apply at most `max` migrations. Pass 0 for no limit.
+//
+// The report is returned along with any error and covers the migrations run
+// up to and including the one that failed.
+func ExecReport(db *sql.DB, dialect string, m MigrationSource, dir MigrationDirection, max int) (*Report, error) {
+	return migSet.ExecReport(db, dialect, m, dir, max)
+}
+
+// Execute a set of migrations with a context and report on them
+func ExecReportContext(ctx context.Context, db *sql.DB, dialect string, m MigrationSource, dir MigrationDirection, max int) (*Report, error) {
+	return migSet.ExecReportContext(ctx, db, dialect, m, dir, max)
+}
+
+func (ms MigrationSet) ExecReport(db *sql.DB, dialect string, m MigrationSource, dir MigrationDirection, max int) (*Report, error) {
+	return ms.ExecReportContext(context.Background(), db, dialect, m, dir, max)
+}
+
+func (ms MigrationSet) ExecReportContext(ctx context.Context, db *sql.DB, dialect string, m MigrationSource, dir MigrationDirection, max int) (*Report, error) {
+	report := &Report{}
+	ms = ms.reporting(report)
+
+	var err error
+	if ms.EnablePatchMode {
+		_, err = ms.ExecMaxPatchContext(ctx, db, dialect, m, dir, max)
+	} else {
+		_, err = ms.ExecMaxContext(ctx, db, dialect, m, dir, max)
+	}
+	return report, err
+}
+
+// Migrate to a target migration and report on it
+func ExecToReport(db *sql.DB, dialect string, m MigrationSource, target string) (*Report, error) {
+	return migSet.ExecToReport(db, dialect, m, target)
+}
+
+// Migrate to a target migration with a context and report on it
+func ExecToReportContext(ctx context.Context, db *sql.DB, dialect string, m MigrationSource, target string) (*Report, error) {
+	return migSet.ExecToReportContext(ctx, db, dialect, m, target)
+}
+
+func (ms MigrationSet) ExecToReport(db *sql.DB, dialect string, m MigrationSource, target string) (*Report, error) {
+	return ms.ExecToReportContext(context.Background(), db, dialect, m, target)
+}
+
+func (ms MigrationSet) ExecToReportContext(ctx context.Context, db *sql.DB, dialect string, m MigrationSource, target string) (*Report, error) {
+	report := &Report{}
+	_, err := ms.reporting(report).ExecToContext(ctx, db, dialect, m, target)
+	return report, err
+}
+
+// reporting returns a copy of ms that fills in report as migrations run.
+func (ms MigrationSet) reporting(report *Report) MigrationSet {
+	ms.Hooks = &reportHooks{Hooks: ms.hooks(), report: report}
+	return ms
+}
+
+// reportHooks builds a report before passing events on to the configured
+// hooks.
+type reportHooks struct {
+	Hooks
+	report  *Report
+	current *MigrationReport
+}
+
+func (h *reportHooks) BeforeMigration(ctx context.Context, event *MigrationEvent) error {
+	_, inTransaction := event.Executor.(*sql.Tx)
+	h.current = &MigrationReport{
+		Name:          event.Name(),
+		Direction:     event.Direction,
+		InTransaction: inTransaction,
+		StartedAt:     event.StartedAt,
+	}
+	h.report.Migrations = append(h.report.Migrations, h.current)
+
+	return h.Hooks.BeforeMigration(ctx, event)
+}
+
+func (h *reportHooks) AfterStatement(ctx context.Context, event *StatementEvent) error {
+	rows, err := event.Result.RowsAffected()
+	if err != nil {
+		rows = -1
+	}
+	h.current.Statements = append(h.current.Statements, &StatementReport{
+		Query:        event.Query,
+		Duration:     event.Duration,
+		RowsAffected: rows,
+	})
+
+	return h.Hooks.AfterStatement(ctx, event)
+}
+
+func (h *reportHooks) AfterMigration(ctx context.Context, event *MigrationEvent) error {
+	h.current.FinishedAt = event.StartedAt.Add(event.Duration)
+	return h.Hooks.AfterMigration(ctx, event)
+}
+
+func (h *reportHooks) OnError(ctx context.Context, event *MigrationEvent, err error) {
+	// Failed before BeforeMigration ran, e.g. when starting the transaction.
+	if h.current == nil || h.current.Name != event.Name() || !h.current.StartedAt.Equal(event.StartedAt) {
+		h.current = &MigrationReport{
+			Name:      event.Name(),
+			Direction: event.Direction,
+			StartedAt: event.StartedAt,
+		}
+		h.report.Migrations = append(h.report.Migrations, h.current)
+	}
+	h.current.FinishedAt = event.StartedAt.Add(event.Duration)
+	h.current.Err = err
+
+	h.Hooks.OnError(ctx, event, err)
+}
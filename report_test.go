@@ -0,0 +1,107 @@
+package migrate
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+func (s *SqliteMigrateSuite) TestExecReport(c *C) {
+	migrations := &MemoryMigrationSource{
+		Migrations: []*Migration{
+			&Migration{
+				Id: "123",
+				Up: []string{
+					"CREATE TABLE people (id int)",
+					"INSERT INTO people (id) VALUES (1), (2), (3)",
+				},
+				Down: []string{"DROP TABLE people"},
+			},
+			&Migration{
+				Id:                   "124",
+				Up:                   []string{"UPDATE people SET id = id + 1 WHERE id > 1"},
+				Down:                 []string{"SELECT 0"},
+				DisableTransactionUp: true,
+			},
+		},
+	}
+
+	ms := MigrationSet{}
+	report, err := ms.ExecReport(s.Db, "sqlite3", migrations, Up, 0)
+	c.Assert(err, IsNil)
+	c.Assert(report.Migrations, HasLen, 2)
+
+	first := report.Migrations[0]
+	c.Assert(first.Name, Equals, "123")
+	c.Assert(first.Direction, Equals, Up)
+	c.Assert(first.InTransaction, Equals, true)
+	c.Assert(first.Err, IsNil)
+	c.Assert(first.FinishedAt.Before(first.StartedAt), Equals, false)
+	c.Assert(first.Statements, HasLen, 2)
+	c.Assert(first.Statements[0].Query, Equals, "CREATE TABLE people (id int)")
+	c.Assert(first.Statements[1].RowsAffected, Equals, int64(3))
+	c.Assert(first.RowsAffected(), Equals, int64(3))
+
+	second := report.Migrations[1]
+	c.Assert(second.Name, Equals, "124")
+	c.Assert(second.InTransaction, Equals, false)
+	c.Assert(second.RowsAffected(), Equals, int64(2))
+}
+
+func (s *SqliteMigrateSuite) TestExecReportFailure(c *C) {
+	migrations := &MemoryMigrationSource{
+		Migrations: []*Migration{
+			sqliteMigrations[0],
+			&Migration{
+				Id:   "124",
+				Up:   []string{"ALTER TABLE people ADD COLUMN first_name text", "THIS IS NOT SQL"},
+				Down: []string{"SELECT 0"},
+			},
+			&Migration{
+				Id:   "125",
+				Up:   []string{"CREATE TABLE pets (id int)"},
+				Down: []string{"DROP TABLE pets"},
+			},
+		},
+	}
+
+	hooks := &recordingHooks{}
+	ms := MigrationSet{Hooks: hooks}
+	report, err := ms.ExecReport(s.Db, "sqlite3", migrations, Up, 0)
+	c.Assert(err, FitsTypeOf, &TxError{})
+	c.Assert(report.Migrations, HasLen, 2)
+	c.Assert(report.Migrations[0].Err, IsNil)
+	c.Assert(report.Migrations[1].Name, Equals, "124")
+	c.Assert(report.Migrations[1].Err, NotNil)
+	c.Assert(report.Migrations[1].Statements, HasLen, 1)
+
+	// Configured hooks still run
+	c.Assert(hooks.calls[len(hooks.calls)-1], Equals, "error 124")
+}
+
+func (s *SqliteMigrateSuite) TestExecReportPatch(c *C) {
+	migrations := &MemoryMigrationSource{
+		MigrationsPatch: []*MigrationPatch{
+			{
+				Name: "0001_00_initial.sql",
+				Up:   []string{"CREATE TABLE people (id int)"},
+				Down: []string{"DROP TABLE people"},
+			},
+			{
+				Name: "0001_01_patch.sql",
+				Up:   []string{"ALTER TABLE people ADD COLUMN first_name text"},
+				Down: []string{"SELECT 0"},
+			},
+		},
+	}
+
+	ms := MigrationSet{EnablePatchMode: true}
+	report, err := ms.ExecReport(s.Db, "sqlite3", migrations, Up, 0)
+	c.Assert(err, IsNil)
+	c.Assert(report.Migrations, HasLen, 2)
+	c.Assert(report.Migrations[1].Name, Equals, "0001_01_patch.sql")
+
+	report, err = ms.ExecToReport(s.Db, "sqlite3", migrations, "0001_00")
+	c.Assert(err, IsNil)
+	c.Assert(report.Migrations, HasLen, 1)
+	c.Assert(report.Migrations[0].Name, Equals, "0001_01_patch.sql")
+	c.Assert(report.Migrations[0].Direction, Equals, Down)
+}
@@ -0,0 +1,339 @@
+package migrate
+
+import (
+	"fmt"
+	"strings"
+)
+
+// dependencies holds the migrations named in the '-- +migrate Requires:'
+// headers of a set of migrations.
+type dependencies struct {
+	requires   map[string][]string
+	dependents map[string][]string
+}
+
+// newDependencies returns the dependencies of the named migrations, given in
+// their sort order, or nil when none requires another. A *PlanError is
+// returned when a migration requires one that doesn't exist, or migrations
+// require each other in a cycle.
+func newDependencies(names []string, requires [][]string) (*dependencies, error) {
+	d := &dependencies{
+		requires:   make(map[string][]string),
+		dependents: make(map[string][]string),
+	}
+
+	known := make(map[string]bool)
+	for _, name := range names {
+		known[name] = true
+	}
+	for i, name := range names {
+		for _, required := range requires[i] {
+			if !known[required] {
+				return nil, newPlanError(name, fmt.Sprintf("requires unknown migration %s", required))
+			}
+			d.requires[name] = append(d.requires[name], required)
+			d.dependents[required] = append(d.dependents[required], name)
+		}
+	}
+	if len(d.requires) == 0 {
+		return nil, nil
+	}
+
+	if cycle := d.findCycle(names); cycle != nil {
+		return nil, newPlanError(cycle[0], fmt.Sprintf("migrations require each other in a cycle: %s",
+			strings.Join(cycle, " -> ")))
+	}
+	return d, nil
+}
+
+// findCycle returns the migrations of a cycle, starting and ending with the
+// same one, or nil.
+func (d *dependencies) findCycle(names []string) []string {
+	const (
+		visiting = iota + 1
+		visited
+	)
+	state := make(map[string]int)
+
+	var path []string
+	var visit func(name string) []string
+	visit = func(name string) []string {
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			for i, entry := range path {
+				if entry == name {
+					return append(append([]string{}, path[i:]...), name)
+				}
+			}
+		}
+
+		state[name] = visiting
+		path = append(path, name)
+		for _, required := range d.requires[name] {
+			if cycle := visit(required); cycle != nil {
+				return cycle
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		return nil
+	}
+
+	for _, name := range names {
+		if cycle := visit(name); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
+
+// order returns the order in which to run the named migrations in dir, as
+// indexes into names. Up, migrations come after the ones they require among
+// names, down before them. Otherwise the order of names is kept.
+func (d *dependencies) order(names []string, dir MigrationDirection) []int {
+	after := d.requires
+	if dir == Down {
+		after = d.dependents
+	}
+
+	index := make(map[string]int)
+	for i, name := range names {
+		index[name] = i
+	}
+
+	// Repeatedly take the first migration that doesn't have to wait for
+	// another that is still left.
+	var result []int
+	done := make([]bool, len(names))
+	for len(result) < len(names) {
+		for i, name := range names {
+			if done[i] {
+				continue
+			}
+			ready := true
+			for _, other := range after[name] {
+				if j, ok := index[other]; ok && !done[j] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				done[i] = true
+				result = append(result, i)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// check returns a *PlanError when the named migrations can't run in this
+// order in dir, with the migrations in applied applied: up, a migration
+// requires one that is neither applied nor planned before it; down, a
+// migration is required by one that stays applied.
+func (d *dependencies) check(names []string, applied map[string]bool, dir MigrationDirection) error {
+	planned := make(map[string]bool)
+	for _, name := range names {
+		if dir == Up {
+			for _, required := range d.requires[name] {
+				if !applied[required] && !planned[required] {
+					return newPlanError(name, fmt.Sprintf("requires migration %s, which is not applied", required))
+				}
+			}
+		} else {
+			for _, dependent := range d.dependents[name] {
+				if applied[dependent] && !planned[dependent] {
+					return newPlanError(name, fmt.Sprintf("cannot roll back while migration %s, which requires it, is applied",
+						dependent))
+				}
+			}
+		}
+		planned[name] = true
+	}
+	return nil
+}
+
+// migrationDependencies returns the dependencies of migrations, see
+// newDependencies. Requiring a squashed migration requires the one that
+// replaced it.
+func migrationDependencies(migrations []*Migration) (*dependencies, error) {
+	squashedBy := make(map[string]string)
+	for _, migration := range migrations {
+		for _, id := range migration.Squashes {
+			squashedBy[id] = migration.Id
+		}
+	}
+
+	names := make([]string, len(migrations))
+	requires := make([][]string, len(migrations))
+	for i, migration := range migrations {
+		names[i] = migration.Id
+		for _, required := range migration.Requires {
+			if id, ok := squashedBy[required]; ok {
+				required = id
+			}
+			requires[i] = append(requires[i], required)
+		}
+	}
+	return newDependencies(names, requires)
+}
+
+// closure returns the migrations in names together with the ones they
+// require, directly or through others.
+func (d *dependencies) closure(names map[string]bool) map[string]bool {
+	result := make(map[string]bool)
+	var visit func(name string)
+	visit = func(name string) {
+		if result[name] {
+			return
+		}
+		result[name] = true
+		for _, required := range d.requires[name] {
+			visit(required)
+		}
+	}
+	for name := range names {
+		visit(name)
+	}
+	return result
+}
+
+// outOfOrder returns those of names that come before an applied migration
+// in the order to run all migrations in. The others only sort before the
+// last applied migration because they require a later one.
+func (d *dependencies) outOfOrder(all, names []string, applied map[string]bool) []string {
+	position := make(map[string]int)
+	last := -1
+	for i, j := range d.order(all, Up) {
+		position[all[j]] = i
+		if applied[all[j]] {
+			last = i
+		}
+	}
+
+	var result []string
+	for _, name := range names {
+		if position[name] < last {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+// RunOrder returns migrations, sorted by Id, in the order they are applied
+// in: after the migrations they require, and otherwise by Id. A *PlanError is
+// returned when a migration requires an unknown migration, or migrations
+// require each other in a cycle.
+func RunOrder(migrations []*Migration) ([]*Migration, error) {
+	deps, err := migrationDependencies(migrations)
+	if deps == nil || err != nil {
+		return migrations, err
+	}
+	return deps.sortMigrations(migrations, Up), nil
+}
+
+// migrationIds returns the ids of migrations.
+func migrationIds(migrations []*Migration) []string {
+	ids := make([]string, len(migrations))
+	for i, migration := range migrations {
+		ids[i] = migration.Id
+	}
+	return ids
+}
+
+// sortMigrations puts migrations in the order to run them in dir.
+func (d *dependencies) sortMigrations(migrations []*Migration, dir MigrationDirection) []*Migration {
+	sorted := make([]*Migration, len(migrations))
+	for i, j := range d.order(migrationIds(migrations), dir) {
+		sorted[i] = migrations[j]
+	}
+	return sorted
+}
+
+// sortPlanned puts planned migrations in the order to run them in dir, and
+// checks that order, see check.
+func (d *dependencies) sortPlanned(planned []*PlannedMigration, applied map[string]bool, dir MigrationDirection) ([]*PlannedMigration, error) {
+	names := make([]string, len(planned))
+	for i, migration := range planned {
+		names[i] = migration.Id
+	}
+	sorted := make([]*PlannedMigration, len(planned))
+	sortedNames := make([]string, len(planned))
+	for i, j := range d.order(names, dir) {
+		sorted[i] = planned[j]
+		sortedNames[i] = names[j]
+	}
+	if err := d.check(sortedNames, applied, dir); err != nil {
+		return nil, err
+	}
+	return sorted, nil
+}
+
+// migrationPatchDependencies returns the dependencies of patch mode
+// migrations, see newDependencies. As the record of a version holds its
+// last applied patch, patches can't be run out of their order, so they can
+// only require earlier ones.
+func migrationPatchDependencies(migrations []*MigrationPatch) (*dependencies, error) {
+	names := make([]string, len(migrations))
+	requires := make([][]string, len(migrations))
+	for i, migration := range migrations {
+		names[i] = migration.Name
+		requires[i] = migration.Requires
+	}
+	d, err := newDependencies(names, requires)
+	if d == nil || err != nil {
+		return d, err
+	}
+
+	index := make(map[string]int)
+	for i, name := range names {
+		index[name] = i
+	}
+	for i, name := range names {
+		for _, required := range requires[i] {
+			if index[required] > i {
+				return nil, newPlanError(name, fmt.Sprintf("requires later migration %s, "+
+					"which patch mode can't run first", required))
+			}
+		}
+	}
+	return d, nil
+}
+
+// checkPlannedPatch checks the order of planned patch mode migrations, see
+// check.
+func (d *dependencies) checkPlannedPatch(planned []*PlannedMigrationPatch, applied map[string]bool, dir MigrationDirection) error {
+	names := make([]string, len(planned))
+	for i, migration := range planned {
+		names[i] = migration.Name
+	}
+	return d.check(names, applied, dir)
+}
+
+// appliedPatchNames returns the names of the migrations that are applied
+// according to the records in existing.
+func appliedPatchNames(migrations, existing []*MigrationPatch) map[string]bool {
+	patches := make(map[int64]int64)
+	for _, e := range existing {
+		patches[e.VerInt] = e.PatchInt
+	}
+
+	applied := make(map[string]bool)
+	for _, migration := range migrations {
+		if patch, ok := patches[migration.VerInt]; ok && patch >= migration.PatchInt {
+			applied[migration.Name] = true
+		}
+	}
+	return applied
+}
+
+// appliedIds returns the ids of the applied migrations in existing.
+func appliedIds(existing []*Migration) map[string]bool {
+	applied := make(map[string]bool)
+	for _, migration := range existing {
+		applied[migration.Id] = true
+	}
+	return applied
+}
@@ -0,0 +1,160 @@
+package migrate
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+func requiresSource() *MemoryMigrationSource {
+	return &MemoryMigrationSource{
+		Migrations: []*Migration{
+			&Migration{
+				Id:       "1_pets",
+				Up:       []string{"CREATE TABLE pets (id int, owner int)"},
+				Down:     []string{"DROP TABLE pets"},
+				Requires: []string{"2_people"},
+			},
+			&Migration{
+				Id:   "2_people",
+				Up:   []string{"CREATE TABLE people (id int)"},
+				Down: []string{"DROP TABLE people"},
+			},
+			&Migration{
+				Id:   "3_cars",
+				Up:   []string{"CREATE TABLE cars (id int)"},
+				Down: []string{"DROP TABLE cars"},
+			},
+		},
+	}
+}
+
+func plannedIds(planned []*PlannedMigration) []string {
+	var ids []string
+	for _, migration := range planned {
+		ids = append(ids, migration.Id)
+	}
+	return ids
+}
+
+func (s *SqliteMigrateSuite) TestRequires(c *C) {
+	migrations := requiresSource()
+	ms := MigrationSet{}
+
+	planned, _, err := ms.PlanMigration(s.Db, "sqlite3", migrations, Up, 0)
+	c.Assert(err, IsNil)
+	c.Assert(plannedIds(planned), DeepEquals, []string{"2_people", "1_pets", "3_cars"})
+
+	n, err := ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 3)
+
+	planned, _, err = ms.PlanMigration(s.Db, "sqlite3", migrations, Down, 0)
+	c.Assert(err, IsNil)
+	c.Assert(plannedIds(planned), DeepEquals, []string{"3_cars", "1_pets", "2_people"})
+
+	// people can't be rolled back before pets
+	migrations.Migrations[0].Tags = []string{"pets"}
+	skipPets := MigrationSet{Tags: TagFilter{Exclude: []string{"pets"}}}
+	_, _, err = skipPets.PlanMigration(s.Db, "sqlite3", migrations, Down, 0)
+	c.Assert(err, FitsTypeOf, &PlanError{})
+	c.Assert(err, ErrorMatches, ".*2_people: cannot roll back while migration 1_pets, which requires it, is applied.*")
+
+	n, err = ms.ExecMax(s.Db, "sqlite3", migrations, Down, 2)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+	_, err = s.DbMap.Exec("SELECT * FROM people")
+	c.Assert(err, IsNil)
+	_, err = s.DbMap.Exec("SELECT * FROM pets")
+	c.Assert(err, Not(IsNil))
+}
+
+func (s *SqliteMigrateSuite) TestRequiresInvalid(c *C) {
+	ms := MigrationSet{}
+
+	migrations := requiresSource()
+	migrations.Migrations[1].Requires = []string{"4_unknown"}
+	_, _, err := ms.PlanMigration(s.Db, "sqlite3", migrations, Up, 0)
+	c.Assert(err, FitsTypeOf, &PlanError{})
+	c.Assert(err, ErrorMatches, ".*2_people: requires unknown migration 4_unknown.*")
+
+	migrations = requiresSource()
+	migrations.Migrations[1].Requires = []string{"3_cars"}
+	migrations.Migrations[2].Requires = []string{"1_pets"}
+	_, _, err = ms.PlanMigration(s.Db, "sqlite3", migrations, Up, 0)
+	c.Assert(err, FitsTypeOf, &PlanError{})
+	c.Assert(err, ErrorMatches, ".*migrations require each other in a cycle: 1_pets -> 2_people -> 3_cars -> 1_pets.*")
+
+	// A required migration that is filtered out isn't applied first
+	migrations = requiresSource()
+	migrations.Migrations[1].Tags = []string{"people"}
+	ms.Tags = TagFilter{Exclude: []string{"people"}}
+	_, _, err = ms.PlanMigration(s.Db, "sqlite3", migrations, Up, 0)
+	c.Assert(err, ErrorMatches, ".*1_pets: requires migration 2_people, which is not applied.*")
+}
+
+func (s *SqliteMigrateSuite) TestRequiresTarget(c *C) {
+	migrations := requiresSource()
+	ms := MigrationSet{}
+
+	// pets needs people, which sorts after it
+	planned, dir, _, err := ms.PlanTo(s.Db, "sqlite3", migrations, "1_pets")
+	c.Assert(err, IsNil)
+	c.Assert(dir, Equals, Up)
+	c.Assert(plannedIds(planned), DeepEquals, []string{"2_people", "1_pets"})
+
+	n, err := ms.ExecTo(s.Db, "sqlite3", migrations, "3_cars")
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 3)
+
+	// Rolling back to pets keeps people
+	planned, dir, _, err = ms.PlanTo(s.Db, "sqlite3", migrations, "1_pets")
+	c.Assert(err, IsNil)
+	c.Assert(dir, Equals, Down)
+	c.Assert(plannedIds(planned), DeepEquals, []string{"3_cars"})
+}
+
+func (s *SqliteMigrateSuite) TestRequiresOutOfOrder(c *C) {
+	migrations := requiresSource()
+	ms := MigrationSet{OutOfOrder: OutOfOrderFail}
+
+	n, err := ms.ExecMax(s.Db, "sqlite3", migrations, Up, 1)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+
+	// pets sorts before people, but had to wait for it
+	planned, _, err := ms.PlanMigration(s.Db, "sqlite3", migrations, Up, 0)
+	c.Assert(err, IsNil)
+	c.Assert(plannedIds(planned), DeepEquals, []string{"1_pets", "3_cars"})
+
+	zoo := &Migration{Id: "0_zoo", Up: []string{"CREATE TABLE zoo (id int)"}, Down: []string{"DROP TABLE zoo"}}
+	migrations.Migrations = append([]*Migration{zoo}, migrations.Migrations...)
+	_, _, err = ms.PlanMigration(s.Db, "sqlite3", migrations, Up, 0)
+	c.Assert(err, FitsTypeOf, &OutOfOrderError{})
+	c.Assert(err.(*OutOfOrderError).Migrations, DeepEquals, []string{"0_zoo"})
+}
+
+func (s *SqliteMigrateSuite) TestRequiresPatch(c *C) {
+	migrations := &MemoryMigrationSource{
+		MigrationsPatch: []*MigrationPatch{
+			{Name: "0001_00_people.sql", Up: []string{"CREATE TABLE people (id int)"}, Down: []string{"DROP TABLE people"}},
+			{Name: "0002_00_pets.sql", Up: []string{"CREATE TABLE pets (id int)"}, Down: []string{"DROP TABLE pets"},
+				Requires: []string{"0001_00_people.sql"}},
+		},
+	}
+
+	ms := MigrationSet{EnablePatchMode: true}
+
+	n, err := ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+
+	n, err = ms.ExecTo(s.Db, "sqlite3", migrations, "0001")
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+
+	// Patch mode can't run a later migration first
+	migrations.MigrationsPatch[0].Requires = []string{"0002_00_pets.sql"}
+	migrations.MigrationsPatch[1].Requires = nil
+	_, _, err = ms.PlanMigrationPatch(s.Db, "sqlite3", migrations, Up, 0)
+	c.Assert(err, FitsTypeOf, &PlanError{})
+	c.Assert(err, ErrorMatches, ".*0001_00_people.sql: requires later migration 0002_00_pets.sql.*")
+}
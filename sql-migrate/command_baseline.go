@@ -0,0 +1,133 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/rubenv/sql-migrate"
+)
+
+type BaselineCommand struct {
+}
+
+func (c *BaselineCommand) Help() string {
+	helpText := `
+Usage: sql-migrate baseline [options] -to=<id>
+
+  Mark every migration up to and including the target as applied without
+  running it. Use it to adopt sql-migrate on an existing database, whose
+  schema already contains these migrations.
+
+Options:
+
+  -config=dbconfig.yml   Configuration file to use.
+  -env="development"     Environment.
+  -verbose               Log every statement, commit and rollback.
+  -quiet                 Only log errors.
+  -to=<id>               Last migration to mark as applied.
+  -dryrun                Don't record anything, just print the migrations that would be marked.
+  -enablePatch           Enable patch versions
+
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *BaselineCommand) Synopsis() string {
+	return "Mark the migrations up to a target as applied without running them"
+}
+
+func (c *BaselineCommand) Run(args []string) int {
+	var target string
+	var dryrun bool
+	var enablePatch bool
+
+	cmdFlags := flag.NewFlagSet("baseline", flag.ContinueOnError)
+	cmdFlags.Usage = func() { ui.Output(c.Help()) }
+	cmdFlags.StringVar(&target, "to", "", "Last migration to mark as applied.")
+	cmdFlags.BoolVar(&dryrun, "dryrun", false, "Don't record anything, just print the migrations that would be marked.")
+	cmdFlags.BoolVar(&enablePatch, "enablePatch", false, "Enable patch versions.")
+	ConfigFlags(cmdFlags)
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	if target == "" {
+		ui.Error("Please specify the last migration to mark as applied with -to")
+		return 1
+	}
+
+	migrate.EnablePatchMode(enablePatch)
+
+	if err := BaselineMigrations(target, dryrun, enablePatch); err != nil {
+		ui.Error(err.Error())
+		return 1
+	}
+
+	return 0
+}
+
+func BaselineMigrations(target string, dryrun, enablePatch bool) error {
+	env, err := GetEnvironment()
+	if err != nil {
+		return fmt.Errorf("Could not parse config: %s", err)
+	}
+
+	db, dialect, err := GetConnection(env)
+	if err != nil {
+		return err
+	}
+
+	source := migrate.FileMigrationSource{
+		Dir: env.Dir,
+	}
+
+	if dryrun {
+		var names []string
+		if enablePatch {
+			migrations, _, err := migrate.PlanBaselinePatch(db, dialect, source, target)
+			if err != nil {
+				return fmt.Errorf("Cannot plan baseline: %s", err)
+			}
+			for _, m := range migrations {
+				names = append(names, m.Name)
+			}
+		} else {
+			migrations, _, err := migrate.PlanBaseline(db, dialect, source, target)
+			if err != nil {
+				return fmt.Errorf("Cannot plan baseline: %s", err)
+			}
+			for _, m := range migrations {
+				names = append(names, m.Id)
+			}
+		}
+
+		for _, name := range names {
+			ui.Output(fmt.Sprintf("==> Would mark migration %s as applied", name))
+		}
+		return nil
+	}
+
+	lock, err := LockMigrations(db, dialect)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = lock.Unlock() }()
+
+	n, err := migrate.Baseline(db, dialect, source, target)
+	if err != nil {
+		return fmt.Errorf("Baseline failed: %s", err)
+	}
+
+	switch n {
+	case 0:
+		ui.Output(fmt.Sprintf("Migration %s has already been applied", target))
+	case 1:
+		ui.Output("Marked 1 migration as applied")
+	default:
+		ui.Output(fmt.Sprintf("Marked %d migrations as applied", n))
+	}
+
+	return nil
+}
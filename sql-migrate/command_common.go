@@ -1,12 +1,20 @@
 package main
 
 import (
+	"database/sql"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
 
 	"github.com/rubenv/sql-migrate"
 )
 
-func ApplyMigrations(dir migrate.MigrationDirection, dryrun, enablePatch bool, limit int) error {
+func ApplyMigrations(dir migrate.MigrationDirection, dryrun, enablePatch, report bool, limit int) error {
 	env, err := GetEnvironment()
 	if err != nil {
 		return fmt.Errorf("Could not parse config: %s", err)
@@ -42,21 +50,192 @@ func ApplyMigrations(dir migrate.MigrationDirection, dryrun, enablePatch bool, l
 			PrintMigration(m, dir)
 		}
 	} else {
-		n, err := migrate.ExecMax(db, dialect, source, dir, limit)
+		lock, err := LockMigrations(db, dialect)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = lock.Unlock() }()
+
+		r, err := migrate.ExecReport(db, dialect, source, dir, limit)
+		if err := printApplied(env.Dir, r, report, err); err != nil {
+			return err
+		}
+		return dumpAfterMigrate(env, db, dialect)
+	}
+
+	return nil
+}
+
+// ApplyMigrationsTo migrates the database to target, which has to lie in the
+// direction dir: up only applies migrations and down only rolls them back.
+func ApplyMigrationsTo(dir migrate.MigrationDirection, dryrun, enablePatch, report bool, target string) error {
+	env, err := GetEnvironment()
+	if err != nil {
+		return fmt.Errorf("Could not parse config: %s", err)
+	}
+
+	db, dialect, err := GetConnection(env)
+	if err != nil {
+		return err
+	}
+
+	source := migrate.FileMigrationSource{
+		Dir: env.Dir,
+	}
+
+	if !dryrun {
+		lock, err := LockMigrations(db, dialect)
 		if err != nil {
-			return fmt.Errorf("Migration failed: %s", err)
+			return err
+		}
+		defer func() { _ = lock.Unlock() }()
+	}
+
+	var planned int
+	var plannedDir migrate.MigrationDirection
+	var migrations []*migrate.PlannedMigration
+	var migrationsPatch []*migrate.PlannedMigrationPatch
+	if enablePatch {
+		migrationsPatch, plannedDir, _, err = migrate.PlanToPatch(db, dialect, source, target)
+		planned = len(migrationsPatch)
+	} else {
+		migrations, plannedDir, _, err = migrate.PlanTo(db, dialect, source, target)
+		planned = len(migrations)
+	}
+	if err != nil {
+		return fmt.Errorf("Cannot plan migration: %s", err)
+	}
+
+	if planned > 0 && plannedDir != dir {
+		if plannedDir == migrate.Up {
+			return fmt.Errorf("Migration %s has not been applied yet, use up to migrate to it", target)
 		}
+		return fmt.Errorf("Migration %s has already been applied, use down to roll back to it", target)
+	}
 
-		if n == 1 {
-			ui.Output("Applied 1 migration")
-		} else {
-			ui.Output(fmt.Sprintf("Applied %d migrations", n))
+	if dryrun {
+		for _, m := range migrationsPatch {
+			PrintMigrationPatch(m, dir)
+		}
+		for _, m := range migrations {
+			PrintMigration(m, dir)
 		}
+		return nil
+	}
+
+	r, err := migrate.ExecToReport(db, dialect, source, target)
+	if err := printApplied(env.Dir, r, report, err); err != nil {
+		return err
+	}
+	return dumpAfterMigrate(env, db, dialect)
+}
+
+// printApplied prints how many migrations were applied, or the report of the
+// run when asked for, along with err.
+func printApplied(migrationsDir string, r *migrate.Report, report bool, err error) error {
+	if report {
+		PrintReport(r)
+	}
+	if err != nil {
+		return fmt.Errorf("Migration failed: %s", FormatMigrationError(migrationsDir, err))
 	}
 
+	n := len(r.Migrations)
+	if n == 1 {
+		ui.Output("Applied 1 migration")
+	} else {
+		ui.Output(fmt.Sprintf("Applied %d migrations", n))
+	}
 	return nil
 }
 
+// PrintReport prints a summary table of the migrations that were run.
+func PrintReport(r *migrate.Report) {
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Migration", "Direction", "Transaction", "Statements", "Rows", "Duration", "Result"})
+	table.SetColWidth(60)
+
+	for _, m := range r.Migrations {
+		transaction := "no"
+		if m.InTransaction {
+			transaction = "yes"
+		}
+		result := "ok"
+		if m.Err != nil {
+			result = "failed"
+		}
+
+		table.Append([]string{
+			m.Name,
+			m.Direction.String(),
+			transaction,
+			strconv.Itoa(len(m.Statements)),
+			strconv.FormatInt(m.RowsAffected(), 10),
+			m.Duration().String(),
+			result,
+		})
+	}
+
+	table.Render()
+}
+
+// FormatMigrationError returns the message of err. When a statement of a
+// migration failed, it is followed by an excerpt of the migration file in
+// migrationsDir around the statement.
+func FormatMigrationError(migrationsDir string, err error) string {
+	txErr, ok := err.(*migrate.TxError)
+	if !ok || txErr.Statement == "" {
+		return err.Error()
+	}
+
+	var b strings.Builder
+	b.WriteString(err.Error())
+	b.WriteString("\n\n")
+
+	content, readErr := ioutil.ReadFile(filepath.Join(migrationsDir, txErr.MigrationName))
+	lines := strings.Split(string(content), "\n")
+	if readErr != nil || txErr.Line < 1 || txErr.Line > len(lines) {
+		// Without the file, show the statement itself.
+		for _, line := range strings.Split(txErr.Statement, "\n") {
+			fmt.Fprintf(&b, "    %s\n", line)
+		}
+		return strings.TrimSuffix(b.String(), "\n")
+	}
+
+	fmt.Fprintf(&b, "  --> %s:%d\n", txErr.MigrationName, txErr.Line)
+	first, last := txErr.Line-2, txErr.Line+2
+	if first < 1 {
+		first = 1
+	}
+	if last > len(lines) {
+		last = len(lines)
+	}
+	width := len(strconv.Itoa(last))
+	for n := first; n <= last; n++ {
+		line := lines[n-1]
+		marker := " "
+		if n == txErr.Line {
+			marker = ">"
+		}
+		fmt.Fprintf(&b, "  %s %*d | %s\n", marker, width, n, line)
+		if n == txErr.Line {
+			indent := len(line) - len(strings.TrimLeft(line, " \t"))
+			fmt.Fprintf(&b, "    %*s | %s^\n", width, "", line[:indent])
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// LockMigrations takes the migration lock, so that concurrent runs against the
+// same database wait for each other.
+func LockMigrations(db *sql.DB, dialect string) (*migrate.MigrationLock, error) {
+	lock, err := migrate.Lock(db, dialect)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot lock migrations: %s", err)
+	}
+	return lock, nil
+}
+
 func PrintMigration(m *migrate.PlannedMigration, dir migrate.MigrationDirection) {
 	if dir == migrate.Up {
 		ui.Output(fmt.Sprintf("==> Would apply migration %s (up)", m.Id))
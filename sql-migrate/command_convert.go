@@ -0,0 +1,214 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+
+	"github.com/rubenv/sql-migrate"
+)
+
+type ConvertCommand struct {
+}
+
+func (c *ConvertCommand) Help() string {
+	helpText := `
+Usage: sql-migrate convert [options] ...
+
+  Convert the migrations and the migration table to patch mode. Migrations
+  are renamed to the 0001_00_name.sql format, in the order they are applied.
+
+  The legacy migration table is kept aside, so the conversion can be undone
+  with -rollback as long as no patches were applied or rolled back since.
+
+Options:
+
+  -config=dbconfig.yml   Configuration file to use.
+  -env="development"     Environment.
+  -verbose               Log every statement, commit and rollback.
+  -quiet                 Only log errors.
+  -dryrun                Don't convert anything, just print the renames.
+  -rollback              Revert a previous conversion.
+
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *ConvertCommand) Synopsis() string {
+	return "Convert migrations and the migration table to patch mode"
+}
+
+func (c *ConvertCommand) Run(args []string) int {
+	var dryrun bool
+	var rollback bool
+
+	cmdFlags := flag.NewFlagSet("convert", flag.ContinueOnError)
+	cmdFlags.Usage = func() { ui.Output(c.Help()) }
+	cmdFlags.BoolVar(&dryrun, "dryrun", false, "Don't convert anything, just print the renames.")
+	cmdFlags.BoolVar(&rollback, "rollback", false, "Revert a previous conversion.")
+	ConfigFlags(cmdFlags)
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	var err error
+	if rollback {
+		err = RevertConversion(dryrun)
+	} else {
+		err = ConvertMigrations(dryrun)
+	}
+	if err != nil {
+		ui.Error(err.Error())
+		return 1
+	}
+
+	return 0
+}
+
+func ConvertMigrations(dryrun bool) error {
+	env, err := GetEnvironment()
+	if err != nil {
+		return fmt.Errorf("Could not parse config: %s", err)
+	}
+
+	db, dialect, err := GetConnection(env)
+	if err != nil {
+		return err
+	}
+
+	source := migrate.FileMigrationSource{
+		Dir: env.Dir,
+	}
+
+	if !dryrun {
+		lock, err := LockMigrations(db, dialect)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = lock.Unlock() }()
+	}
+
+	conversions, err := migrate.PlanConversion(db, dialect, source)
+	if err != nil {
+		return fmt.Errorf("Cannot plan conversion: %s", err)
+	}
+
+	printConversions(conversions, false)
+	if dryrun {
+		return nil
+	}
+
+	if err := checkRenames(env.Dir, conversions, false); err != nil {
+		return err
+	}
+
+	if _, err := migrate.ConvertToPatch(db, dialect, source); err != nil {
+		return fmt.Errorf("Conversion failed: %s", err)
+	}
+
+	if err := renameMigrations(env.Dir, conversions, false); err != nil {
+		return err
+	}
+
+	ui.Output(fmt.Sprintf("Converted %d migrations, use -enablePatch from now on", len(conversions)))
+	return nil
+}
+
+func RevertConversion(dryrun bool) error {
+	env, err := GetEnvironment()
+	if err != nil {
+		return fmt.Errorf("Could not parse config: %s", err)
+	}
+
+	db, dialect, err := GetConnection(env)
+	if err != nil {
+		return err
+	}
+
+	if !dryrun {
+		lock, err := LockMigrations(db, dialect)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = lock.Unlock() }()
+	}
+
+	conversions, err := migrate.PlanRevertConversion(db, dialect)
+	if err != nil {
+		return fmt.Errorf("Cannot plan rollback: %s", err)
+	}
+
+	printConversions(conversions, true)
+	if dryrun {
+		return nil
+	}
+
+	if err := checkRenames(env.Dir, conversions, true); err != nil {
+		return err
+	}
+
+	if _, err := migrate.RevertConversion(db, dialect); err != nil {
+		return fmt.Errorf("Rollback failed: %s", err)
+	}
+
+	if err := renameMigrations(env.Dir, conversions, true); err != nil {
+		return err
+	}
+
+	ui.Output(fmt.Sprintf("Reverted the conversion of %d migrations", len(conversions)))
+	return nil
+}
+
+func printConversions(conversions []*migrate.Conversion, rollback bool) {
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Migration", "Renamed to", "Applied"})
+	table.SetColWidth(60)
+
+	for _, conversion := range conversions {
+		from, to := conversionNames(conversion, rollback)
+		applied := "no"
+		if conversion.Applied {
+			applied = "yes"
+		}
+		table.Append([]string{from, to, applied})
+	}
+
+	table.Render()
+}
+
+// checkRenames makes sure all migrations can be renamed before anything is
+// changed.
+func checkRenames(dir string, conversions []*migrate.Conversion, rollback bool) error {
+	for _, conversion := range conversions {
+		from, to := conversionNames(conversion, rollback)
+		if _, err := os.Stat(filepath.Join(dir, from)); err != nil {
+			return fmt.Errorf("Cannot rename migration: %s", err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, to)); err == nil {
+			return fmt.Errorf("Cannot rename migration %s: %s already exists", from, to)
+		}
+	}
+	return nil
+}
+
+func renameMigrations(dir string, conversions []*migrate.Conversion, rollback bool) error {
+	for _, conversion := range conversions {
+		from, to := conversionNames(conversion, rollback)
+		if err := os.Rename(filepath.Join(dir, from), filepath.Join(dir, to)); err != nil {
+			return fmt.Errorf("Cannot rename migration: %s", err)
+		}
+	}
+	return nil
+}
+
+func conversionNames(conversion *migrate.Conversion, rollback bool) (string, string) {
+	if rollback {
+		return conversion.Name, conversion.Id
+	}
+	return conversion.Id, conversion.Name
+}
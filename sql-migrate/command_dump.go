@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/rubenv/sql-migrate"
+)
+
+type DumpCommand struct {
+}
+
+func (c *DumpCommand) Help() string {
+	helpText := `
+Usage: sql-migrate dump [options] ...
+
+  Dump the schema of the database: its tables, columns, indexes,
+  constraints, views and (on postgres) sequences as sorted DDL, followed by
+  the applied migrations. Supported for sqlite3, postgres and mysql.
+
+Options:
+
+  -config=dbconfig.yml   Configuration file to use.
+  -env="development"     Environment.
+  -verbose               Log every statement, commit and rollback.
+  -quiet                 Only log errors.
+  -output=<file>         Write the dump to this file instead of the standard output.
+  -enablePatch           Enable patch versions
+
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *DumpCommand) Synopsis() string {
+	return "Dump the schema of the database"
+}
+
+func (c *DumpCommand) Run(args []string) int {
+	var output string
+	var enablePatch bool
+
+	cmdFlags := flag.NewFlagSet("dump", flag.ContinueOnError)
+	cmdFlags.Usage = func() { ui.Output(c.Help()) }
+	cmdFlags.StringVar(&output, "output", "", "Write the dump to this file instead of the standard output.")
+	cmdFlags.BoolVar(&enablePatch, "enablePatch", false, "Enable patch versions.")
+	ConfigFlags(cmdFlags)
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	migrate.EnablePatchMode(enablePatch)
+
+	env, err := GetEnvironment()
+	if err != nil {
+		ui.Error(fmt.Sprintf("Could not parse config: %s", err))
+		return 1
+	}
+
+	db, dialect, err := GetConnection(env)
+	if err != nil {
+		ui.Error(err.Error())
+		return 1
+	}
+
+	if output != "" {
+		err = WriteSchemaDump(db, dialect, output)
+	} else {
+		var b bytes.Buffer
+		if err = migrate.DumpSchema(db, dialect, &b); err == nil {
+			ui.Output(strings.TrimSuffix(b.String(), "\n"))
+		}
+	}
+	if err != nil {
+		ui.Error(fmt.Sprintf("Cannot dump schema: %s", err))
+		return 1
+	}
+
+	return 0
+}
+
+// WriteSchemaDump writes the dump of the schema to the file at path.
+func WriteSchemaDump(db *sql.DB, dialect, path string) error {
+	var b bytes.Buffer
+	if err := migrate.DumpSchema(db, dialect, &b); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b.Bytes(), 0644)
+}
+
+// dumpAfterMigrate updates the schema dump of the environment after migrations
+// ran, when it is configured.
+func dumpAfterMigrate(env *Environment, db *sql.DB, dialect string) error {
+	if env.SchemaDump == "" {
+		return nil
+	}
+	if err := WriteSchemaDump(db, dialect, env.SchemaDump); err != nil {
+		return fmt.Errorf("Cannot dump schema: %s", err)
+	}
+	return nil
+}
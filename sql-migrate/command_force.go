@@ -0,0 +1,110 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/rubenv/sql-migrate"
+)
+
+type ForceCommand struct {
+}
+
+func (c *ForceCommand) Help() string {
+	helpText := `
+Usage: sql-migrate force [options] <id> [applied|unapplied]
+
+  Mark a migration as applied (the default) or unapplied without running it,
+  and clear its progress and dirty mark, which are kept in the
+  <table>_progress table next to the migration table. Use it to resolve a
+  dirty migration, which was interrupted and may have left the database
+  half-migrated, after repairing the database by hand.
+
+Options:
+
+  -config=dbconfig.yml   Configuration file to use.
+  -env="development"     Environment.
+  -verbose               Log every statement, commit and rollback.
+  -quiet                 Only log errors.
+  -enablePatch           Enable patch versions
+
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *ForceCommand) Synopsis() string {
+	return "Mark a migration as applied or unapplied without running it"
+}
+
+func (c *ForceCommand) Run(args []string) int {
+	var enablePatch bool
+
+	cmdFlags := flag.NewFlagSet("force", flag.ContinueOnError)
+	cmdFlags.Usage = func() { ui.Output(c.Help()) }
+	cmdFlags.BoolVar(&enablePatch, "enablePatch", false, "Enable patch versions.")
+	ConfigFlags(cmdFlags)
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	if cmdFlags.NArg() < 1 || cmdFlags.NArg() > 2 {
+		ui.Error("Please specify the migration and, optionally, applied or unapplied")
+		return 1
+	}
+
+	applied := true
+	if cmdFlags.NArg() == 2 {
+		switch cmdFlags.Arg(1) {
+		case "applied":
+		case "unapplied":
+			applied = false
+		default:
+			ui.Error(fmt.Sprintf("Unknown state %q, use applied or unapplied", cmdFlags.Arg(1)))
+			return 1
+		}
+	}
+
+	migrate.EnablePatchMode(enablePatch)
+
+	if err := ForceMigration(cmdFlags.Arg(0), applied); err != nil {
+		ui.Error(err.Error())
+		return 1
+	}
+
+	return 0
+}
+
+func ForceMigration(id string, applied bool) error {
+	env, err := GetEnvironment()
+	if err != nil {
+		return fmt.Errorf("Could not parse config: %s", err)
+	}
+
+	db, dialect, err := GetConnection(env)
+	if err != nil {
+		return err
+	}
+
+	source := migrate.FileMigrationSource{
+		Dir: env.Dir,
+	}
+
+	lock, err := LockMigrations(db, dialect)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = lock.Unlock() }()
+
+	if err := migrate.ForceMigration(db, dialect, source, id, applied); err != nil {
+		return fmt.Errorf("Cannot force migration: %s", err)
+	}
+
+	if applied {
+		ui.Output(fmt.Sprintf("Marked %s as applied", id))
+	} else {
+		ui.Output(fmt.Sprintf("Marked %s as unapplied", id))
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/rubenv/sql-migrate"
+)
+
+type LintCommand struct {
+}
+
+func (c *LintCommand) Help() string {
+	helpText := `
+Usage: sql-migrate lint [options] ...
+
+  Check the migrations for problems before they reach a database: empty Down
+  sections, notransaction sections with several statements, Postgres indexes
+  on big tables created without CONCURRENTLY, DROP TABLE and DROP COLUMN in
+  Up sections, and ids that don't start with a number among ones that do.
+  Exits with status 1 when issues are found.
+
+Options:
+
+  -config=dbconfig.yml   Configuration file to use.
+  -env="development"     Environment.
+  -format=text           Output format: text, or json for CI.
+  -enablePatch           Enable patch versions
+
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *LintCommand) Synopsis() string {
+	return "Check migrations for common problems"
+}
+
+func (c *LintCommand) Run(args []string) int {
+	var format string
+	var enablePatch bool
+
+	cmdFlags := flag.NewFlagSet("lint", flag.ContinueOnError)
+	cmdFlags.Usage = func() { ui.Output(c.Help()) }
+	cmdFlags.StringVar(&format, "format", "text", "Output format: text or json.")
+	cmdFlags.BoolVar(&enablePatch, "enablePatch", false, "Enable patch versions.")
+	ConfigFlags(cmdFlags)
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	if format != "text" && format != "json" {
+		ui.Error(fmt.Sprintf("Unknown format %q, use text or json", format))
+		return 1
+	}
+
+	migrate.EnablePatchMode(enablePatch)
+
+	n, err := LintMigrations(format)
+	if err != nil {
+		ui.Error(err.Error())
+		return 1
+	}
+	if n == 0 {
+		return 0
+	}
+
+	// A summary would make the JSON output unparseable.
+	if format == "text" {
+		if n == 1 {
+			ui.Output("Found 1 issue")
+		} else {
+			ui.Output(fmt.Sprintf("Found %d issues", n))
+		}
+	}
+	return 1
+}
+
+// LintMigrations prints the issues found in the migrations and returns how
+// many there are.
+func LintMigrations(format string) (int, error) {
+	env, err := GetEnvironment()
+	if err != nil {
+		return 0, fmt.Errorf("Could not parse config: %s", err)
+	}
+
+	source := migrate.FileMigrationSource{
+		Dir: env.Dir,
+	}
+
+	issues, err := migrate.Lint(source, env.Dialect, env.Lint.config())
+	if err != nil {
+		return 0, fmt.Errorf("Cannot lint migrations: %s", err)
+	}
+
+	if format == "json" {
+		if issues == nil {
+			issues = []*migrate.LintIssue{}
+		}
+		out, err := json.MarshalIndent(issues, "", "  ")
+		if err != nil {
+			return 0, err
+		}
+		ui.Output(string(out))
+	} else {
+		for _, issue := range issues {
+			file := path.Join(env.Dir, issue.Migration)
+			if issue.Line > 0 {
+				file = fmt.Sprintf("%s:%d", file, issue.Line)
+			}
+			ui.Output(fmt.Sprintf("%s: %s (%s)", file, issue.Message, issue.Rule))
+		}
+	}
+
+	return len(issues), nil
+}
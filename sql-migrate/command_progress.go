@@ -0,0 +1,112 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+
+	"github.com/rubenv/sql-migrate"
+)
+
+type ProgressCommand struct {
+}
+
+func (c *ProgressCommand) Help() string {
+	helpText := `
+Usage: sql-migrate progress [options] ...
+
+  Show the progress of notransaction migrations that failed part way. The
+  next run resumes them after the statements that completed.
+
+Options:
+
+  -config=dbconfig.yml   Configuration file to use.
+  -env="development"     Environment.
+  -verbose               Log every statement, commit and rollback.
+  -quiet                 Only log errors.
+  -reset=<id>            Forget the progress of a migration, so all of its
+                         statements run again.
+  -reset-all             Forget the progress of all migrations.
+
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *ProgressCommand) Synopsis() string {
+	return "Show or reset the progress of interrupted notransaction migrations"
+}
+
+func (c *ProgressCommand) Run(args []string) int {
+	var reset string
+	var resetAll bool
+
+	cmdFlags := flag.NewFlagSet("progress", flag.ContinueOnError)
+	cmdFlags.Usage = func() { ui.Output(c.Help()) }
+	cmdFlags.StringVar(&reset, "reset", "", "Forget the progress of a migration.")
+	cmdFlags.BoolVar(&resetAll, "reset-all", false, "Forget the progress of all migrations.")
+	ConfigFlags(cmdFlags)
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	env, err := GetEnvironment()
+	if err != nil {
+		ui.Error(fmt.Sprintf("Could not parse config: %s", err))
+		return 1
+	}
+
+	db, dialect, err := GetConnection(env)
+	if err != nil {
+		ui.Error(err.Error())
+		return 1
+	}
+
+	if reset != "" || resetAll {
+		if err := migrate.ResetMigrationProgress(db, dialect, reset); err != nil {
+			ui.Error(err.Error())
+			return 1
+		}
+		if resetAll {
+			ui.Output("Reset the progress of all migrations")
+		} else {
+			ui.Output(fmt.Sprintf("Reset the progress of migration %s", reset))
+		}
+		return 0
+	}
+
+	progress, err := migrate.GetMigrationProgress(db, dialect)
+	if err != nil {
+		ui.Error(err.Error())
+		return 1
+	}
+
+	if len(progress) == 0 {
+		ui.Output("No interrupted migrations")
+		return 0
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Migration", "Direction", "Completed statements", "Updated", "Dirty"})
+	table.SetColWidth(60)
+	for _, p := range progress {
+		dirty := "no"
+		if p.Dirty {
+			dirty = "yes"
+		}
+		table.Append([]string{
+			p.Migration,
+			p.Direction,
+			strconv.Itoa(p.Statements),
+			p.UpdatedAt.String(),
+			dirty,
+		})
+	}
+	table.Render()
+
+	return 0
+}
@@ -17,11 +17,20 @@ Usage: sql-migrate redo [options] ...
 
   Reapply the last migration.
 
+  There is no -atomic option: rolling the migration back and applying it
+  again are two runs, each in its own transaction. When applying it again
+  fails, the migration stays rolled back.
+
 Options:
 
   -config=dbconfig.yml   Configuration file to use.
   -env="development"     Environment.
+  -verbose               Log every statement, commit and rollback.
+  -quiet                 Only log errors.
+  -tags=a,b              Only run tagged migrations with one of these tags.
+  -skip-tags=a,b         Don't run migrations with any of these tags.
   -dryrun                Don't apply migrations, just print them.
+  -report                Print a summary table of the migrations that ran.
   -enablePatch           Enable patch versions
 
 `
@@ -34,13 +43,16 @@ func (c *RedoCommand) Synopsis() string {
 
 func (c *RedoCommand) Run(args []string) int {
 	var dryrun bool
+	var report bool
 	var enablePatch bool
 
 	cmdFlags := flag.NewFlagSet("redo", flag.ContinueOnError)
 	cmdFlags.Usage = func() { ui.Output(c.Help()) }
 	cmdFlags.BoolVar(&dryrun, "dryrun", false, "Don't apply migrations, just print them.")
+	cmdFlags.BoolVar(&report, "report", false, "Print a summary table of the migrations that ran.")
 	cmdFlags.BoolVar(&enablePatch, "enablePatch", false, "Enable patch versions.")
 	ConfigFlags(cmdFlags)
+	TagFlags(cmdFlags)
 
 	if err := cmdFlags.Parse(args); err != nil {
 		return 1
@@ -64,6 +76,17 @@ func (c *RedoCommand) Run(args []string) int {
 
 	migrate.EnablePatchMode(enablePatch)
 
+	// Hold the lock across planning, down and up, so no other run can slip in
+	// between.
+	if !dryrun {
+		lock, err := LockMigrations(db, dialect)
+		if err != nil {
+			ui.Error(err.Error())
+			return 1
+		}
+		defer func() { _ = lock.Unlock() }()
+	}
+
 	var migrations []*migrate.PlannedMigration
 	var migrationsPatch []*migrate.PlannedMigrationPatch
 	if enablePatch {
@@ -96,26 +119,35 @@ func (c *RedoCommand) Run(args []string) int {
 			PrintMigration(migrations[0], migrate.Up)
 		}
 	} else {
-		_, err := migrate.ExecMax(db, dialect, source, migrate.Down, 1)
+		down, err := migrate.ExecReport(db, dialect, source, migrate.Down, 1)
 		if err != nil {
-			ui.Error(fmt.Sprintf("Migration (down) failed: %s", err))
+			if report {
+				PrintReport(down)
+			}
+			ui.Error(fmt.Sprintf("Migration (down) failed: %s", FormatMigrationError(env.Dir, err)))
 			return 1
 		}
 
-		_, err = migrate.ExecMax(db, dialect, source, migrate.Up, 1)
+		up, err := migrate.ExecReport(db, dialect, source, migrate.Up, 1)
+		if report {
+			PrintReport(&migrate.Report{Migrations: append(down.Migrations, up.Migrations...)})
+		}
 		if err != nil {
-			ui.Error(fmt.Sprintf("Migration (up) failed: %s", err))
+			ui.Error(fmt.Sprintf("Migration (up) failed: %s", FormatMigrationError(env.Dir, err)))
 			return 1
 		}
 
 		if migrations != nil {
 			ui.Output(fmt.Sprintf("Reapplied migration %s.", migrations[0].Id))
-			return 0
 		}
 
 		if migrationsPatch != nil {
 			ui.Output(fmt.Sprintf("Reapplied migration %s.", migrationsPatch[0].Name))
-			return 0
+		}
+
+		if err := dumpAfterMigrate(env, db, dialect); err != nil {
+			ui.Error(err.Error())
+			return 1
 		}
 	}
 
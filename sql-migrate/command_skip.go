@@ -21,6 +21,10 @@ Options:
 
   -config=dbconfig.yml   Configuration file to use.
   -env="development"     Environment.
+  -verbose               Log every statement, commit and rollback.
+  -quiet                 Only log errors.
+  -tags=a,b              Only run tagged migrations with one of these tags.
+  -skip-tags=a,b         Don't run migrations with any of these tags.
   -limit=0               Limit the number of migrations (0 = unlimited).
   -enablePatch           Enable patch versions
 
@@ -42,6 +46,7 @@ func (c *SkipCommand) Run(args []string) int {
 	cmdFlags.IntVar(&limit, "limit", 0, "Max number of migrations to skip.")
 	cmdFlags.BoolVar(&enablePatch, "enablePatch", false, "Enable patch versions.")
 	ConfigFlags(cmdFlags)
+	TagFlags(cmdFlags)
 
 	if err := cmdFlags.Parse(args); err != nil {
 		return 1
@@ -73,6 +78,12 @@ func SkipMigrations(dir migrate.MigrationDirection, dryrun, enablePatch bool, li
 		Dir: env.Dir,
 	}
 
+	lock, err := LockMigrations(db, dialect)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = lock.Unlock() }()
+
 	var n int
 	if enablePatch {
 		n, err = migrate.SkipMaxPatch(db, dialect, source, dir, limit)
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/rubenv/sql-migrate"
+)
+
+type SquashCommand struct {
+}
+
+func (c *SquashCommand) Help() string {
+	helpText := `
+Usage: sql-migrate squash [options] -from=<id> -to=<id>
+
+  Replace a range of migrations by a single migration. Its Up statements are
+  those of the range in order, its Down statements those of the range in
+  reverse. Databases that have the whole range applied have it applied,
+  fresh databases only run the new migration. The squashed files are removed.
+
+Options:
+
+  -config=dbconfig.yml   Configuration file to use.
+  -env="development"     Environment.
+  -from=<id>             First migration to squash.
+  -to=<id>               Last migration to squash.
+  -name=<file>           File name of the new migration (defaults to the last one with a _squashed suffix).
+  -dryrun                Don't change any files, just print the new migration.
+
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *SquashCommand) Synopsis() string {
+	return "Squash a range of migrations into a single migration"
+}
+
+func (c *SquashCommand) Run(args []string) int {
+	var from, to, name string
+	var dryrun bool
+
+	cmdFlags := flag.NewFlagSet("squash", flag.ContinueOnError)
+	cmdFlags.Usage = func() { ui.Output(c.Help()) }
+	cmdFlags.StringVar(&from, "from", "", "First migration to squash.")
+	cmdFlags.StringVar(&to, "to", "", "Last migration to squash.")
+	cmdFlags.StringVar(&name, "name", "", "File name of the new migration.")
+	cmdFlags.BoolVar(&dryrun, "dryrun", false, "Don't change any files, just print the new migration.")
+	ConfigFlags(cmdFlags)
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	if from == "" || to == "" {
+		ui.Error("Please specify the migrations to squash with -from and -to")
+		return 1
+	}
+	if name == "" {
+		name = strings.TrimSuffix(to, ".sql") + "_squashed.sql"
+	}
+
+	if err := SquashMigrations(from, to, name, dryrun); err != nil {
+		ui.Error(err.Error())
+		return 1
+	}
+
+	return 0
+}
+
+func SquashMigrations(from, to, name string, dryrun bool) error {
+	env, err := GetEnvironment()
+	if err != nil {
+		return fmt.Errorf("Could not parse config: %s", err)
+	}
+
+	source := migrate.FileMigrationSource{
+		Dir: env.Dir,
+	}
+
+	squashed, err := migrate.Squash(source, name, from, to)
+	if err != nil {
+		return fmt.Errorf("Cannot squash migrations: %s", err)
+	}
+
+	if dryrun {
+		ui.Output(fmt.Sprintf("==> Would replace %s with %s", strings.Join(squashed.Squashes, ", "), name))
+		var b strings.Builder
+		if err := migrate.WriteMigration(&b, squashed); err != nil {
+			return err
+		}
+		ui.Output(b.String())
+		return nil
+	}
+
+	pathName := path.Join(env.Dir, name)
+	f, err := os.OpenFile(pathName, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if err := migrate.WriteMigration(f, squashed); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	// Migrations squashed before are gone already.
+	removed := 0
+	for _, id := range squashed.Squashes {
+		err := os.Remove(path.Join(env.Dir, id))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		removed++
+	}
+
+	ui.Output(fmt.Sprintf("Squashed %d migrations into %s", removed, pathName))
+	return nil
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"database/sql"
 	"flag"
 	"fmt"
 	"os"
@@ -25,6 +26,11 @@ Options:
 
   -config=dbconfig.yml   Configuration file to use.
   -env="development"     Environment.
+  -verbose               Log every statement, commit and rollback.
+  -quiet                 Only log errors.
+  -tags=a,b              Show which tagged migrations -tags would filter out.
+  -skip-tags=a,b         Show which migrations -skip-tags would filter out.
+  -to=<id>               Also show what migrating to this migration would do.
 
 `
 	return strings.TrimSpace(helpText)
@@ -35,9 +41,13 @@ func (c *StatusCommand) Synopsis() string {
 }
 
 func (c *StatusCommand) Run(args []string) int {
+	var target string
+
 	cmdFlags := flag.NewFlagSet("status", flag.ContinueOnError)
 	cmdFlags.Usage = func() { ui.Output(c.Help()) }
+	cmdFlags.StringVar(&target, "to", "", "Migration to migrate to.")
 	ConfigFlags(cmdFlags)
+	TagFlags(cmdFlags)
 
 	if err := cmdFlags.Parse(args); err != nil {
 		return 1
@@ -69,10 +79,35 @@ func (c *StatusCommand) Run(args []string) int {
 		Dir: env.Dir,
 	}
 
+	// Direction each migration would be run in to reach the target.
+	pending := make(map[string]migrate.MigrationDirection)
+	if target != "" {
+		if records != nil {
+			migrations, dir, _, err := migrate.PlanTo(db, dialect, source, target)
+			if err != nil {
+				ui.Error(fmt.Sprintf("Cannot plan migration: %s", err))
+				return 1
+			}
+			for _, m := range migrations {
+				pending[m.Id] = dir
+			}
+		} else {
+			migrate.EnablePatchMode(true)
+			migrations, dir, _, err := migrate.PlanToPatch(db, dialect, source, target)
+			if err != nil {
+				ui.Error(fmt.Sprintf("Cannot plan migration: %s", err))
+				return 1
+			}
+			for _, m := range migrations {
+				pending[m.Name] = dir
+			}
+		}
+	}
+
 	if records != nil {
-		err = c.showStatus(source, records)
+		err = c.showStatus(db, dialect, source, records, target, pending)
 	} else {
-		err = c.showStatusPatch(source, recordsPatch)
+		err = c.showStatusPatch(db, dialect, source, recordsPatch, target, pending)
 	}
 
 	if err != nil {
@@ -83,15 +118,24 @@ func (c *StatusCommand) Run(args []string) int {
 	return 0
 }
 
-func (c *StatusCommand) showStatus(source migrate.FileMigrationSource, records []*migrate.MigrationRecord) error {
+func (c *StatusCommand) showStatus(db *sql.DB, dialect string, source migrate.FileMigrationSource,
+	records []*migrate.MigrationRecord, target string, pending map[string]migrate.MigrationDirection) error {
 	migrations, err := source.FindMigrations()
 	if err != nil {
 		return err
 	}
 
-	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{"Migration", "Applied"})
-	table.SetColWidth(60)
+	var repeatable map[string]string
+	for _, m := range migrations {
+		if m.Repeatable {
+			if repeatable, err = repeatableStatus(db, dialect, source, false); err != nil {
+				return err
+			}
+			break
+		}
+	}
+
+	table := newStatusTable(target, pending)
 
 	rows := make(map[string]*statusRow)
 
@@ -102,7 +146,27 @@ func (c *StatusCommand) showStatus(source migrate.FileMigrationSource, records [
 		}
 	}
 
+	// Squashing migrations are applied when the last one they replace is.
+	squashedBy := make(map[string]*migrate.Migration)
+	lastSquashed := make(map[string]*migrate.Migration)
+	for _, m := range migrations {
+		for _, id := range m.Squashes {
+			squashed := &migrate.Migration{Id: id}
+			squashedBy[id] = m
+			if last := lastSquashed[m.Id]; last == nil || last.Less(squashed) {
+				lastSquashed[m.Id] = squashed
+			}
+		}
+	}
+
 	for _, r := range records {
+		if squashing := squashedBy[r.Id]; squashing != nil {
+			if r.Id == lastSquashed[squashing.Id].Id && !rows[squashing.Id].Migrated {
+				rows[squashing.Id].Migrated = true
+				rows[squashing.Id].AppliedAt = r.AppliedAt
+			}
+			continue
+		}
 		if rows[r.Id] == nil {
 			ui.Warn(fmt.Sprintf("Could not find migration file: %v", r.Id))
 			continue
@@ -112,17 +176,36 @@ func (c *StatusCommand) showStatus(source migrate.FileMigrationSource, records [
 		rows[r.Id].AppliedAt = r.AppliedAt
 	}
 
+	// Last applied migration in the order they run in, anything before it
+	// that wasn't applied is out of order.
+	var versioned []*migrate.Migration
 	for _, m := range migrations {
-		if rows[m.Id] != nil && rows[m.Id].Migrated {
-			table.Append([]string{
-				m.Id,
-				rows[m.Id].AppliedAt.String(),
-			})
+		if !m.Repeatable {
+			versioned = append(versioned, m)
+		}
+	}
+	order, err := migrate.RunOrder(versioned)
+	if err != nil {
+		return err
+	}
+	position := make(map[string]int)
+	last := -1
+	for i, m := range order {
+		position[m.Id] = i
+		if rows[m.Id].Migrated {
+			last = i
+		}
+	}
+
+	for _, m := range migrations {
+		if m.Repeatable {
+			table.appendRow(m.Id, repeatable[m.Id], m.Tags)
+		} else if rows[m.Id].Migrated {
+			table.appendRow(m.Id, rows[m.Id].AppliedAt.String(), m.Tags)
+		} else if position[m.Id] < last {
+			table.appendRow(m.Id, "no (out of order)", m.Tags)
 		} else {
-			table.Append([]string{
-				m.Id,
-				"no",
-			})
+			table.appendRow(m.Id, "no", m.Tags)
 		}
 	}
 
@@ -131,12 +214,23 @@ func (c *StatusCommand) showStatus(source migrate.FileMigrationSource, records [
 	return nil
 }
 
-func (c *StatusCommand) showStatusPatch(source migrate.FileMigrationSource, records []*migrate.MigrationPatchRecord) error {
+func (c *StatusCommand) showStatusPatch(db *sql.DB, dialect string, source migrate.FileMigrationSource,
+	records []*migrate.MigrationPatchRecord, target string, pending map[string]migrate.MigrationDirection) error {
 	migrations, err := source.FindMigrationsPatch()
 	if err != nil {
 		return err
 	}
 
+	var repeatable map[string]string
+	for _, m := range migrations {
+		if m.Repeatable {
+			if repeatable, err = repeatableStatus(db, dialect, source, true); err != nil {
+				return err
+			}
+			break
+		}
+	}
+
 	var existingMigrations []*statusRowPatch
 	for _, migrationRecord := range records {
 		em := &migrate.MigrationPatch{
@@ -154,11 +248,21 @@ func (c *StatusCommand) showStatusPatch(source migrate.FileMigrationSource, reco
 		})
 	}
 
-	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{"Migration", "Applied"})
-	table.SetColWidth(60)
+	table := newStatusTable(target, pending)
+
+	var last *migrate.MigrationPatch
+	for _, existing := range existingMigrations {
+		if last == nil || last.Less(existing.MigrationPatch) {
+			last = existing.MigrationPatch
+		}
+	}
 
 	for _, m := range migrations {
+		if m.Repeatable {
+			table.appendRow(m.Name, repeatable[m.Name], m.Tags)
+			continue
+		}
+
 		var existMigration *statusRowPatch
 		for _, existing := range existingMigrations {
 			if existing.VerInt == m.VerInt && existing.PatchInt >= m.PatchInt {
@@ -168,15 +272,11 @@ func (c *StatusCommand) showStatusPatch(source migrate.FileMigrationSource, reco
 		}
 
 		if existMigration != nil {
-			table.Append([]string{
-				m.Name,
-				existMigration.AppliedAt.String(),
-			})
+			table.appendRow(m.Name, existMigration.AppliedAt.String(), m.Tags)
+		} else if last != nil && m.Less(last) {
+			table.appendRow(m.Name, "no (out of order)", m.Tags)
 		} else {
-			table.Append([]string{
-				m.Name,
-				"no",
-			})
+			table.appendRow(m.Name, "no", m.Tags)
 		}
 	}
 
@@ -185,6 +285,103 @@ func (c *StatusCommand) showStatusPatch(source migrate.FileMigrationSource, reco
 	return nil
 }
 
+// repeatableStatus returns the Applied column of the repeatable migrations:
+// when they last ran, and whether they changed since.
+func repeatableStatus(db *sql.DB, dialect string, source migrate.MigrationSource, patch bool) (map[string]string, error) {
+	records, err := migrate.GetRepeatableRecords(db, dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := make(map[string]bool)
+	if patch {
+		planned, _, err := migrate.PlanMigrationPatch(db, dialect, source, migrate.Up, 0)
+		if err != nil {
+			ui.Warn(fmt.Sprintf("Could not plan repeatable migrations: %s", err))
+		}
+		for _, m := range planned {
+			if m.Repeatable {
+				changed[m.Name] = true
+			}
+		}
+	} else {
+		planned, _, err := migrate.PlanMigration(db, dialect, source, migrate.Up, 0)
+		if err != nil {
+			ui.Warn(fmt.Sprintf("Could not plan repeatable migrations: %s", err))
+		}
+		for _, m := range planned {
+			if m.Repeatable {
+				changed[m.Id] = true
+			}
+		}
+	}
+
+	status := make(map[string]string)
+	for _, r := range records {
+		status[r.Id] = r.AppliedAt.String()
+		if changed[r.Id] {
+			status[r.Id] += " (changed)"
+		}
+		delete(changed, r.Id)
+	}
+	for name := range changed {
+		status[name] = "no"
+	}
+	return status, nil
+}
+
+// statusTable lists migrations with their tags, and with the reason they
+// are filtered out when filtering by tags.
+type statusTable struct {
+	*tablewriter.Table
+	target  string
+	pending map[string]migrate.MigrationDirection
+	filter  migrate.TagFilter
+}
+
+func newStatusTable(target string, pending map[string]migrate.MigrationDirection) *statusTable {
+	t := &statusTable{
+		Table:   tablewriter.NewWriter(os.Stdout),
+		target:  target,
+		pending: pending,
+		filter:  GetTagFilter(),
+	}
+
+	header := []string{"Migration", "Applied", "Tags"}
+	if t.filtering() {
+		header = append(header, "Filtered")
+	}
+	if target != "" {
+		header = append(header, "Pending")
+	}
+	t.SetHeader(header)
+	t.SetColWidth(60)
+	return t
+}
+
+func (t *statusTable) filtering() bool {
+	return len(t.filter.Include) > 0 || len(t.filter.Exclude) > 0
+}
+
+func (t *statusTable) appendRow(name, applied string, tags []string) {
+	row := []string{name, applied, strings.Join(tags, ",")}
+	if t.filtering() {
+		row = append(row, t.filter.Reason(tags))
+	}
+	if t.target != "" {
+		action := ""
+		if dir, ok := t.pending[name]; ok {
+			if dir == migrate.Up {
+				action = "up"
+			} else {
+				action = "down"
+			}
+		}
+		row = append(row, action)
+	}
+	t.Append(row)
+}
+
 type statusRow struct {
 	Id        string
 	Migrated  bool
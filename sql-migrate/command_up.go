@@ -20,9 +20,16 @@ Options:
 
   -config=dbconfig.yml   Configuration file to use.
   -env="development"     Environment.
+  -verbose               Log every statement, commit and rollback.
+  -quiet                 Only log errors.
+  -tags=a,b              Only run tagged migrations with one of these tags.
+  -skip-tags=a,b         Don't run migrations with any of these tags.
   -limit=0               Limit the number of migrations (0 = unlimited).
+  -to=<id>               Migrate up to this migration instead (overrides -limit).
   -dryrun                Don't apply migrations, just print them.
+  -report                Print a summary table of the migrations that ran.
   -enablePatch           Enable patch versions
+  -atomic                Run all migrations in a single transaction.
 
 `
 	return strings.TrimSpace(helpText)
@@ -34,22 +41,35 @@ func (c *UpCommand) Synopsis() string {
 
 func (c *UpCommand) Run(args []string) int {
 	var limit int
+	var target string
 	var dryrun bool
+	var report bool
 	var enablePatch bool
+	var atomic bool
 
 	cmdFlags := flag.NewFlagSet("up", flag.ContinueOnError)
 	cmdFlags.Usage = func() { ui.Output(c.Help()) }
 	cmdFlags.IntVar(&limit, "limit", 0, "Max number of migrations to apply.")
+	cmdFlags.StringVar(&target, "to", "", "Migration to migrate to.")
 	cmdFlags.BoolVar(&dryrun, "dryrun", false, "Don't apply migrations, just print them.")
+	cmdFlags.BoolVar(&report, "report", false, "Print a summary table of the migrations that ran.")
 	cmdFlags.BoolVar(&enablePatch, "enablePatch", false, "Enable patch versions.")
+	cmdFlags.BoolVar(&atomic, "atomic", false, "Run all migrations in a single transaction.")
 	ConfigFlags(cmdFlags)
+	TagFlags(cmdFlags)
 
 	if err := cmdFlags.Parse(args); err != nil {
 		return 1
 	}
 
 	migrate.EnablePatchMode(enablePatch)
-	err := ApplyMigrations(migrate.Up, dryrun, enablePatch, limit)
+	migrate.SetAtomic(atomic)
+	var err error
+	if target != "" {
+		err = ApplyMigrationsTo(migrate.Up, dryrun, enablePatch, report, target)
+	} else {
+		err = ApplyMigrations(migrate.Up, dryrun, enablePatch, report, limit)
+	}
 	if err != nil {
 		ui.Error(err.Error())
 		return 1
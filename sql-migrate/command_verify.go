@@ -0,0 +1,148 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+
+	"github.com/rubenv/sql-migrate"
+)
+
+type VerifyCommand struct {
+}
+
+func (c *VerifyCommand) Help() string {
+	helpText := `
+Usage: sql-migrate verify [options] ...
+
+  Verify that migrations can be rolled back. Every pending migration is
+  applied, rolled back, checked to leave the schema as it was, and applied
+  again. Run it against a scratch database, or pass -sqlite to use a
+  throwaway SQLite database.
+
+Options:
+
+  -config=dbconfig.yml   Configuration file to use.
+  -env="development"     Environment.
+  -verbose               Log every statement, commit and rollback.
+  -quiet                 Only log errors.
+  -sqlite                Verify against a throwaway SQLite database instead.
+  -enablePatch           Enable patch versions
+
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *VerifyCommand) Synopsis() string {
+	return "Verify that migrations can be rolled back"
+}
+
+func (c *VerifyCommand) Run(args []string) int {
+	var scratch bool
+	var enablePatch bool
+
+	cmdFlags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	cmdFlags.Usage = func() { ui.Output(c.Help()) }
+	cmdFlags.BoolVar(&scratch, "sqlite", false, "Verify against a throwaway SQLite database instead.")
+	cmdFlags.BoolVar(&enablePatch, "enablePatch", false, "Enable patch versions.")
+	ConfigFlags(cmdFlags)
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	migrate.EnablePatchMode(enablePatch)
+
+	if err := VerifyMigrations(scratch); err != nil {
+		ui.Error(err.Error())
+		return 1
+	}
+
+	return 0
+}
+
+func VerifyMigrations(scratch bool) error {
+	env, err := GetEnvironment()
+	if err != nil {
+		return fmt.Errorf("Could not parse config: %s", err)
+	}
+
+	var db *sql.DB
+	var dialect string
+	if scratch {
+		f, err := ioutil.TempFile("", "sql-migrate-verify-*.db")
+		if err != nil {
+			return err
+		}
+		_ = f.Close()
+		defer func() { _ = os.Remove(f.Name()) }()
+
+		// The schema of the environment doesn't exist in SQLite.
+		migrate.SetSchema("")
+		dialect = "sqlite3"
+		if db, err = sql.Open(dialect, f.Name()); err != nil {
+			return fmt.Errorf("Cannot connect to database: %s", err)
+		}
+		defer func() { _ = db.Close() }()
+	} else {
+		if db, dialect, err = GetConnection(env); err != nil {
+			return err
+		}
+
+		lock, err := LockMigrations(db, dialect)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = lock.Unlock() }()
+	}
+
+	source := migrate.FileMigrationSource{
+		Dir: env.Dir,
+	}
+
+	results, err := migrate.Verify(db, dialect, source)
+	if err != nil {
+		return fmt.Errorf("Cannot verify migrations: %s", err)
+	}
+
+	if len(results) == 0 {
+		ui.Output("No pending migrations to verify")
+		return nil
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Migration", "Result", "Difference"})
+	table.SetColWidth(60)
+
+	var failed *migrate.VerifyResult
+	for _, r := range results {
+		result := "ok"
+		if !r.Passed() {
+			result = "failed"
+			failed = r
+		}
+		table.Append([]string{r.Migration, result, r.Difference()})
+	}
+	table.Render()
+
+	if failed == nil {
+		return nil
+	}
+	if failed.Object != "" {
+		ui.Output(fmt.Sprintf("\nBefore Up:\n%s\n\nAfter Down:\n%s", orNone(failed.Expected), orNone(failed.Actual)))
+	}
+	return errors.New("Migration " + failed.Migration + " is not reversible")
+}
+
+func orNone(ddl string) string {
+	if ddl == "" {
+		return "(none)"
+	}
+	return ddl
+}
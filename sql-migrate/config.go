@@ -6,7 +6,10 @@ import (
 	"flag"
 	"fmt"
 	"io/ioutil"
+	"log"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/rubenv/sql-migrate"
 	"gopkg.in/gorp.v1"
@@ -25,10 +28,37 @@ var dialects = map[string]gorp.Dialect{
 
 var ConfigFile string
 var ConfigEnvironment string
+var Verbose bool
+var Quiet bool
+var Tags string
+var SkipTags string
+
+// TagFlags adds the flags that filter migrations by their tags.
+func TagFlags(f *flag.FlagSet) {
+	f.StringVar(&Tags, "tags", "", "Only run tagged migrations with one of these tags.")
+	f.StringVar(&SkipTags, "skip-tags", "", "Don't run migrations with any of these tags.")
+}
+
+// GetTagFilter returns the filter of the -tags and -skip-tags flags.
+func GetTagFilter() migrate.TagFilter {
+	return migrate.TagFilter{Include: splitTags(Tags), Exclude: splitTags(SkipTags)}
+}
+
+func splitTags(tags string) []string {
+	var result []string
+	for _, tag := range strings.Split(tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			result = append(result, tag)
+		}
+	}
+	return result
+}
 
 func ConfigFlags(f *flag.FlagSet) {
 	f.StringVar(&ConfigFile, "config", "dbconfig.yml", "Configuration file to use.")
 	f.StringVar(&ConfigEnvironment, "env", "development", "Environment to use.")
+	f.BoolVar(&Verbose, "verbose", false, "Log every statement, commit and rollback.")
+	f.BoolVar(&Quiet, "quiet", false, "Only log errors.")
 }
 
 type Environment struct {
@@ -37,6 +67,30 @@ type Environment struct {
 	Dir        string `yaml:"dir"`
 	TableName  string `yaml:"table"`
 	SchemaName string `yaml:"schema"`
+
+	LockTimeout time.Duration            `yaml:"lock_timeout"`
+	OutOfOrder  migrate.OutOfOrderPolicy `yaml:"out_of_order"`
+
+	Vars map[string]interface{} `yaml:"vars"`
+
+	// SchemaDump is the file the schema is dumped to after migrations ran.
+	SchemaDump string `yaml:"schema_dump"`
+
+	Lint LintSettings `yaml:"lint"`
+}
+
+// LintSettings configures the lint command for an environment.
+type LintSettings struct {
+	Disable   []string `yaml:"disable"`
+	BigTables []string `yaml:"big_tables"`
+}
+
+func (s LintSettings) config() migrate.LintConfig {
+	config := migrate.LintConfig{BigTables: s.BigTables}
+	for _, rule := range s.Disable {
+		config.Disabled = append(config.Disabled, migrate.LintRule(rule))
+	}
+	return config
 }
 
 func ReadConfig() (map[string]*Environment, error) {
@@ -86,9 +140,32 @@ func GetEnvironment() (*Environment, error) {
 		migrate.SetSchema(env.SchemaName)
 	}
 
+	if err := env.OutOfOrder.Validate(); err != nil {
+		return nil, err
+	}
+
+	migrate.SetLockTimeout(env.LockTimeout)
+	migrate.SetOutOfOrderPolicy(env.OutOfOrder)
+	migrate.SetTemplateVars(env.Vars)
+	filter := GetTagFilter()
+	migrate.SetTagFilter(filter.Include, filter.Exclude)
+	migrate.SetLogger(NewLogger())
+
 	return env, nil
 }
 
+// NewLogger returns the logger of the library for the -verbose and -quiet
+// flags. By default plan decisions and applied migrations are logged.
+func NewLogger() migrate.Logger {
+	level := migrate.LogInfo
+	if Verbose {
+		level = migrate.LogDebug
+	} else if Quiet {
+		level = migrate.LogError
+	}
+	return migrate.NewStdLogger(log.New(os.Stderr, "", 0), level)
+}
+
 func GetConnection(env *Environment) (*sql.DB, string, error) {
 	db, err := sql.Open(env.Dialect, env.DataSource)
 	if err != nil {
@@ -5,6 +5,7 @@ import (
 	"os"
 
 	"github.com/mitchellh/cli"
+	"github.com/rubenv/sql-migrate"
 )
 
 func main() {
@@ -37,9 +38,33 @@ func realMain() int {
 			"skip": func() (cli.Command, error) {
 				return &SkipCommand{}, nil
 			},
+			"baseline": func() (cli.Command, error) {
+				return &BaselineCommand{}, nil
+			},
+			"squash": func() (cli.Command, error) {
+				return &SquashCommand{}, nil
+			},
+			"convert": func() (cli.Command, error) {
+				return &ConvertCommand{}, nil
+			},
+			"force": func() (cli.Command, error) {
+				return &ForceCommand{}, nil
+			},
+			"progress": func() (cli.Command, error) {
+				return &ProgressCommand{}, nil
+			},
+			"dump": func() (cli.Command, error) {
+				return &DumpCommand{}, nil
+			},
+			"verify": func() (cli.Command, error) {
+				return &VerifyCommand{}, nil
+			},
+			"lint": func() (cli.Command, error) {
+				return &LintCommand{}, nil
+			},
 		},
 		HelpFunc: cli.BasicHelpFunc("sql-migrate"),
-		Version:  "1.0.0",
+		Version:  migrate.Version,
 	}
 
 	exitCode, err := cli.Run()
@@ -13,14 +13,68 @@ import (
 const (
 	sqlCmdPrefix        = "-- +migrate "
 	optionNoTransaction = "notransaction"
+	optionDialect       = "dialect="
+	commandTemplate     = "Template"
+	commandTags         = "Tags:"
+	commandRepeatable   = "Repeatable"
+	commandSquashes     = "Squashes:"
+	commandRequires     = "Requires:"
 )
 
 type ParsedMigration struct {
 	UpStatements   []string
 	DownStatements []string
 
+	// UpLines and DownLines hold the line, counting from 1, on which each of
+	// the statements starts in the source.
+	UpLines   []int
+	DownLines []int
+
 	DisableTransactionUp   bool
 	DisableTransactionDown bool
+
+	// UpDialects and DownDialects hold the sections annotated with
+	// dialect=<name>, by dialect. They replace the generic Up and Down
+	// statements for that dialect.
+	UpDialects   map[string]*DialectSection
+	DownDialects map[string]*DialectSection
+
+	// Tags are those of the '-- +migrate Tags: a,b' header.
+	Tags []string
+
+	// Squashes holds the ids of the migrations this one replaces, from the
+	// '-- +migrate Squashes: a,b' header.
+	Squashes []string
+
+	// Requires holds the ids of the migrations that have to be applied
+	// before this one, from the '-- +migrate Requires: a,b' header.
+	Requires []string
+}
+
+// DialectSection holds the statements of the Up or Down sections of a
+// migration that are annotated with a dialect.
+type DialectSection struct {
+	Statements []string
+	// Lines holds the line on which each of the statements starts.
+	Lines []int
+
+	DisableTransaction bool
+}
+
+// sectionsFor returns the sections of dialects in sections, which are created
+// when missing.
+func sectionsFor(sections *map[string]*DialectSection, dialects []string) []*DialectSection {
+	if *sections == nil {
+		*sections = make(map[string]*DialectSection)
+	}
+	var result []*DialectSection
+	for _, dialect := range dialects {
+		if (*sections)[dialect] == nil {
+			(*sections)[dialect] = &DialectSection{}
+		}
+		result = append(result, (*sections)[dialect])
+	}
+	return result
 }
 
 var (
@@ -84,6 +138,57 @@ func (c *migrateCommand) HasOption(opt string) bool {
 	return false
 }
 
+// KnownDialects are the dialect names accepted in dialect=<name> options, the
+// keys of migrate.MigrationDialects. Add to it when registering a dialect
+// there.
+var KnownDialects = []string{"sqlite3", "postgres", "mysql", "mssql", "oci8", "godror"}
+
+func knownDialect(name string) bool {
+	for _, dialect := range KnownDialects {
+		if dialect == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Dialects returns the dialects of a dialect=<name>[,<name>...] option on the
+// given line, or nil for a generic section.
+func (c *migrateCommand) Dialects(line int) ([]string, error) {
+	for _, specifiedOption := range c.Options {
+		if !strings.HasPrefix(specifiedOption, optionDialect) {
+			continue
+		}
+
+		var dialects []string
+		for _, dialect := range strings.Split(specifiedOption[len(optionDialect):], ",") {
+			if dialect == "" {
+				return nil, fmt.Errorf("ERROR: missing dialect name in '-- +migrate %s %s'",
+					c.Command, strings.Join(c.Options, " "))
+			}
+			if !knownDialect(dialect) {
+				return nil, fmt.Errorf("ERROR: unknown dialect %q on line %d, expected one of %s",
+					dialect, line, strings.Join(KnownDialects, ", "))
+			}
+			dialects = append(dialects, dialect)
+		}
+		return dialects, nil
+	}
+
+	return nil, nil
+}
+
+// List returns the comma separated values of a header such as Tags:.
+func (c *migrateCommand) List() []string {
+	var values []string
+	for _, value := range strings.Split(strings.Join(c.Options, ","), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
 func parseCommand(line string) (*migrateCommand, error) {
 	cmd := &migrateCommand{}
 
@@ -103,6 +208,39 @@ func parseCommand(line string) (*migrateCommand, error) {
 	return cmd, nil
 }
 
+// IsTemplate reports whether the migration is annotated with
+// '-- +migrate Template'. Such a migration is a text/template, which has to be
+// rendered before it can be parsed.
+func IsTemplate(r io.ReadSeeker) (bool, error) {
+	return hasCommand(r, commandTemplate)
+}
+
+// IsRepeatable reports whether the migration is annotated with
+// '-- +migrate Repeatable'. Such a migration runs again whenever it changes.
+// The annotation is found in templates as well, before they are rendered.
+func IsRepeatable(r io.ReadSeeker) (bool, error) {
+	return hasCommand(r, commandRepeatable)
+}
+
+func hasCommand(r io.ReadSeeker, command string) (bool, error) {
+	if _, err := r.Seek(0, 0); err != nil {
+		return false, err
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, sqlCmdPrefix) {
+			continue
+		}
+		if cmd, err := parseCommand(line); err == nil && cmd.Command == command {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
 // Split the given sql script into individual statements.
 //
 // The base case is to simply split on semicolons, as these
@@ -127,9 +265,14 @@ func ParseMigration(r io.ReadSeeker) (*ParsedMigration, error) {
 	statementEnded := false
 	ignoreSemicolons := false
 	currentDirection := directionNone
+	lineNumber := 0
+	statementLine := 0
+	// The dialect sections the current statements belong to, if any.
+	var sections []*DialectSection
 
 	for scanner.Scan() {
 		line := scanner.Text()
+		lineNumber++
 		// ignore comment except beginning with '-- +'
 		if strings.HasPrefix(line, "-- ") && !strings.HasPrefix(line, "-- +") {
 			continue
@@ -148,8 +291,22 @@ func ParseMigration(r io.ReadSeeker) (*ParsedMigration, error) {
 					return nil, errNoTerminator()
 				}
 				currentDirection = directionUp
+				dialects, err := cmd.Dialects(lineNumber)
+				if err != nil {
+					return nil, err
+				}
+				sections = nil
+				if dialects != nil {
+					sections = sectionsFor(&p.UpDialects, dialects)
+				}
 				if cmd.HasOption(optionNoTransaction) {
-					p.DisableTransactionUp = true
+					if sections != nil {
+						for _, section := range sections {
+							section.DisableTransaction = true
+						}
+					} else {
+						p.DisableTransactionUp = true
+					}
 				}
 				break
 
@@ -158,11 +315,37 @@ func ParseMigration(r io.ReadSeeker) (*ParsedMigration, error) {
 					return nil, errNoTerminator()
 				}
 				currentDirection = directionDown
+				dialects, err := cmd.Dialects(lineNumber)
+				if err != nil {
+					return nil, err
+				}
+				sections = nil
+				if dialects != nil {
+					sections = sectionsFor(&p.DownDialects, dialects)
+				}
 				if cmd.HasOption(optionNoTransaction) {
-					p.DisableTransactionDown = true
+					if sections != nil {
+						for _, section := range sections {
+							section.DisableTransaction = true
+						}
+					} else {
+						p.DisableTransactionDown = true
+					}
 				}
 				break
 
+			case commandTags:
+				p.Tags = append(p.Tags, cmd.List()...)
+				break
+
+			case commandSquashes:
+				p.Squashes = append(p.Squashes, cmd.List()...)
+				break
+
+			case commandRequires:
+				p.Requires = append(p.Requires, cmd.List()...)
+				break
+
 			case "StatementBegin":
 				if currentDirection != directionNone {
 					ignoreSemicolons = true
@@ -188,6 +371,9 @@ func ParseMigration(r io.ReadSeeker) (*ParsedMigration, error) {
 			if _, err := buf.WriteString(line + "\n"); err != nil {
 				return nil, err
 			}
+			if statementLine == 0 && strings.TrimSpace(line) != "" {
+				statementLine = lineNumber
+			}
 		}
 
 		// Wrap up the two supported cases: 1) basic with semicolon; 2) psql statement
@@ -195,18 +381,30 @@ func ParseMigration(r io.ReadSeeker) (*ParsedMigration, error) {
 		// do not conclude statement.
 		if (!ignoreSemicolons && (endsWithSemicolon(line) || isLineSeparator)) || statementEnded {
 			statementEnded = false
-			switch currentDirection {
-			case directionUp:
+			if statementLine == 0 {
+				statementLine = lineNumber
+			}
+			switch {
+			case sections != nil:
+				for _, section := range sections {
+					section.Statements = append(section.Statements, buf.String())
+					section.Lines = append(section.Lines, statementLine)
+				}
+
+			case currentDirection == directionUp:
 				p.UpStatements = append(p.UpStatements, buf.String())
+				p.UpLines = append(p.UpLines, statementLine)
 
-			case directionDown:
+			case currentDirection == directionDown:
 				p.DownStatements = append(p.DownStatements, buf.String())
+				p.DownLines = append(p.DownLines, statementLine)
 
 			default:
 				panic("impossible state")
 			}
 
 			buf.Reset()
+			statementLine = 0
 		}
 	}
 
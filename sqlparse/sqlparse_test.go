@@ -81,6 +81,78 @@ func (s *SqlParseSuite) TestSplitStatements(c *C) {
 	}
 }
 
+func (s *SqlParseSuite) TestStatementLines(c *C) {
+	migration, err := ParseMigration(strings.NewReader(functxt))
+	c.Assert(err, IsNil)
+	c.Assert(migration.UpLines, DeepEquals, []int{2, 9})
+	c.Assert(migration.DownLines, DeepEquals, []int{32, 33})
+
+	migration, err = ParseMigration(strings.NewReader(multitxt))
+	c.Assert(err, IsNil)
+	c.Assert(migration.UpLines, HasLen, len(migration.UpStatements))
+	c.Assert(migration.DownLines, HasLen, len(migration.DownStatements))
+}
+
+func (s *SqlParseSuite) TestIsTemplate(c *C) {
+	template, err := IsTemplate(strings.NewReader("-- +migrate Template\n-- +migrate Up\nCREATE TABLE {{.table}} (id int);\n"))
+	c.Assert(err, IsNil)
+	c.Assert(template, Equals, true)
+
+	template, err = IsTemplate(strings.NewReader(functxt))
+	c.Assert(err, IsNil)
+	c.Assert(template, Equals, false)
+}
+
+func (s *SqlParseSuite) TestDialectSections(c *C) {
+	migration, err := ParseMigration(strings.NewReader(dialectSections))
+	c.Assert(err, IsNil)
+
+	c.Assert(migration.UpStatements, DeepEquals, []string{"CREATE TABLE people (id int);\n"})
+	c.Assert(migration.UpDialects, HasLen, 2)
+	c.Assert(migration.UpDialects["postgres"].Statements, DeepEquals, []string{
+		"CREATE TABLE people (id serial);\n",
+		"CREATE INDEX CONCURRENTLY people_id ON people (id);\n",
+	})
+	c.Assert(migration.UpDialects["postgres"].Lines, DeepEquals, []int{5, 6})
+	c.Assert(migration.UpDialects["postgres"].DisableTransaction, Equals, true)
+	c.Assert(migration.UpDialects["mysql"].Statements, DeepEquals, []string{"CREATE TABLE people (id int AUTO_INCREMENT);\n"})
+	c.Assert(migration.UpDialects["mysql"].DisableTransaction, Equals, false)
+	c.Assert(migration.DisableTransactionUp, Equals, false)
+
+	c.Assert(migration.DownStatements, HasLen, 0)
+	c.Assert(migration.DownDialects["postgres"].Statements, DeepEquals, []string{"DROP TABLE people;\n"})
+	c.Assert(migration.DownDialects["sqlite3"].Statements, DeepEquals, []string{"DROP TABLE people;\n"})
+
+	_, err = ParseMigration(strings.NewReader("-- +migrate Up dialect=\nSELECT 1;\n"))
+	c.Assert(err, ErrorMatches, "ERROR: missing dialect name .*")
+
+	_, err = ParseMigration(strings.NewReader("-- +migrate Up\nSELECT 1;\n-- +migrate Down dialect=postgress\nSELECT 0;\n"))
+	c.Assert(err, ErrorMatches, `ERROR: unknown dialect "postgress" on line 3, .*`)
+}
+
+func (s *SqlParseSuite) TestTags(c *C) {
+	migration, err := ParseMigration(strings.NewReader("-- +migrate Tags: seed, staging\n-- +migrate Up\nSELECT 1;\n"))
+	c.Assert(err, IsNil)
+	c.Assert(migration.Tags, DeepEquals, []string{"seed", "staging"})
+	c.Assert(migration.UpStatements, HasLen, 1)
+
+	migration, err = ParseMigration(strings.NewReader(functxt))
+	c.Assert(err, IsNil)
+	c.Assert(migration.Tags, HasLen, 0)
+}
+
+func (s *SqlParseSuite) TestSquashes(c *C) {
+	migration, err := ParseMigration(strings.NewReader("-- +migrate Squashes: 1_a.sql,2_b.sql\n-- +migrate Up\nSELECT 1;\n"))
+	c.Assert(err, IsNil)
+	c.Assert(migration.Squashes, DeepEquals, []string{"1_a.sql", "2_b.sql"})
+}
+
+func (s *SqlParseSuite) TestRequires(c *C) {
+	migration, err := ParseMigration(strings.NewReader("-- +migrate Requires: 1_a.sql, 2_b.sql\n-- +migrate Up\nSELECT 1;\n"))
+	c.Assert(err, IsNil)
+	c.Assert(migration.Requires, DeepEquals, []string{"1_a.sql", "2_b.sql"})
+}
+
 func (s *SqlParseSuite) TestIntentionallyBadStatements(c *C) {
 	for _, test := range intentionallyBad {
 		_, err := ParseMigration(strings.NewReader(test))
@@ -377,3 +449,15 @@ CREATE TABLE post (
 -- +migrate Down
 -- no migration here
 `}
+
+var dialectSections = `-- +migrate Up
+CREATE TABLE people (id int);
+-- +migrate Up dialect=postgres notransaction
+-- Sections for a dialect replace the generic one
+CREATE TABLE people (id serial);
+CREATE INDEX CONCURRENTLY people_id ON people (id);
+-- +migrate Up dialect=mysql
+CREATE TABLE people (id int AUTO_INCREMENT);
+-- +migrate Down dialect=postgres,sqlite3
+DROP TABLE people;
+`
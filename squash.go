@@ -0,0 +1,202 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"gopkg.in/gorp.v1"
+)
+
+// Squash a range of migrations
+//
+// Returns a migration named id that replaces the migrations from from up to
+// and including to: its Up statements are theirs in order, its Down
+// statements theirs in reverse order, and its Squashes lists their ids. Once
+// it replaces them in the source, databases that have them applied have it
+// applied, and fresh databases only run it.
+//
+// Migrations that run outside a transaction, have Go functions, templates or
+// dialect sections can't be squashed.
+func Squash(m MigrationSource, id, from, to string) (*Migration, error) {
+	migrations, err := m.FindMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	start, end := -1, -1
+	var versioned []*Migration
+	for _, migration := range migrations {
+		if migration.Repeatable {
+			continue
+		}
+		if migration.Id == from {
+			start = len(versioned)
+		}
+		if migration.Id == to {
+			end = len(versioned)
+		}
+		versioned = append(versioned, migration)
+	}
+	if start == -1 {
+		return nil, newPlanError(from, "unknown migration")
+	}
+	if end == -1 {
+		return nil, newPlanError(to, "unknown migration")
+	}
+	if end < start {
+		return nil, newPlanError(to, fmt.Sprintf("migration comes before %s", from))
+	}
+
+	squashed := &Migration{Id: id}
+	for _, migration := range versioned[start : end+1] {
+		if err := checkSquash(migration); err != nil {
+			return nil, err
+		}
+
+		// Squashing a squashed migration keeps the migrations it replaced, as
+		// databases may still have those.
+		squashed.Squashes = append(squashed.Squashes, migration.Squashes...)
+		squashed.Squashes = append(squashed.Squashes, migration.Id)
+		squashed.Up = append(squashed.Up, migration.Up...)
+		squashed.Tags = appendTags(squashed.Tags, migration.Tags)
+	}
+	for i := end; i >= start; i-- {
+		squashed.Down = append(squashed.Down, versioned[i].Down...)
+	}
+
+	// Requirements among the squashed migrations are met by the order of
+	// their statements.
+	for _, migration := range versioned[start : end+1] {
+		for _, required := range migration.Requires {
+			if !containsTag(squashed.Squashes, required) {
+				squashed.Requires = appendTags(squashed.Requires, []string{required})
+			}
+		}
+	}
+	return squashed, nil
+}
+
+func checkSquash(migration *Migration) error {
+	switch {
+	case migration.DisableTransactionUp || migration.DisableTransactionDown:
+		return newPlanError(migration.Id, "cannot squash a notransaction migration")
+	case migration.UpFunc != nil || migration.DownFunc != nil:
+		return newPlanError(migration.Id, "cannot squash a migration with Go functions")
+	case migration.Template != "":
+		return newPlanError(migration.Id, "cannot squash a template migration")
+	case len(migration.UpDialects) > 0 || len(migration.DownDialects) > 0:
+		return newPlanError(migration.Id, "cannot squash a migration with dialect sections")
+	}
+	return nil
+}
+
+// appendTags adds the tags that aren't in tags yet.
+func appendTags(tags, more []string) []string {
+	for _, tag := range more {
+		if !containsTag(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// WriteMigration writes migration as a migration file, as returned by Squash.
+func WriteMigration(w io.Writer, migration *Migration) error {
+	var b strings.Builder
+	if len(migration.Squashes) > 0 {
+		fmt.Fprintf(&b, "-- +migrate Squashes: %s\n", strings.Join(migration.Squashes, ","))
+	}
+	if len(migration.Tags) > 0 {
+		fmt.Fprintf(&b, "-- +migrate Tags: %s\n", strings.Join(migration.Tags, ","))
+	}
+	if len(migration.Requires) > 0 {
+		fmt.Fprintf(&b, "-- +migrate Requires: %s\n", strings.Join(migration.Requires, ","))
+	}
+	b.WriteString("-- +migrate Up\n")
+	writeStatements(&b, migration.Up)
+	b.WriteString("-- +migrate Down\n")
+	writeStatements(&b, migration.Down)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeStatements writes statements, marking the boundaries of those that
+// contain semicolons of their own.
+func writeStatements(b *strings.Builder, statements []string) {
+	for _, stmt := range statements {
+		stmt = strings.TrimSpace(stmt)
+		body := strings.TrimSuffix(stmt, ";")
+		if strings.Contains(body, ";") {
+			fmt.Fprintf(b, "-- +migrate StatementBegin\n%s\n-- +migrate StatementEnd\n", stmt)
+			continue
+		}
+		fmt.Fprintf(b, "%s;\n", body)
+	}
+}
+
+// squashRecords replaces the records of squashed migrations by one for the
+// migration that squashes them. That migration counts as applied when all
+// the migrations it squashes are. Squashed migrations that are only partly
+// applied can't be caught up with, so a *PlanError is returned.
+func squashRecords(migrations []*Migration, records []*MigrationRecord) ([]*MigrationRecord, error) {
+	recordsById := make(map[string]*MigrationRecord)
+	for _, record := range records {
+		recordsById[record.Id] = record
+	}
+
+	squashed := make(map[string]bool)
+	var result []*MigrationRecord
+	for _, migration := range migrations {
+		if len(migration.Squashes) == 0 {
+			continue
+		}
+
+		var ids []*Migration
+		var applied []string
+		for _, id := range migration.Squashes {
+			squashed[id] = true
+			ids = append(ids, &Migration{Id: id})
+			if recordsById[id] != nil {
+				applied = append(applied, id)
+			}
+		}
+		if len(applied) == 0 || recordsById[migration.Id] != nil {
+			continue
+		}
+
+		if len(applied) != len(migration.Squashes) {
+			return nil, newPlanError(migration.Id, fmt.Sprintf("squashed migrations are partly applied (%s), "+
+				"apply the others with the original migrations first", strings.Join(applied, ", ")))
+		}
+		sort.Sort(byId(ids))
+		result = append(result, &MigrationRecord{
+			Id:        migration.Id,
+			AppliedAt: recordsById[ids[len(ids)-1].Id].AppliedAt,
+		})
+	}
+	if len(squashed) == 0 {
+		return records, nil
+	}
+
+	for _, record := range records {
+		if !squashed[record.Id] {
+			result = append(result, record)
+		}
+	}
+	return result, nil
+}
+
+// deleteRecords deletes the record of migration, along with those of the
+// migrations it squashes.
+func (ms MigrationSet) deleteRecords(ctx context.Context, executor SqlExecutorContext, dbMap *gorp.DbMap, migration *Migration) error {
+	for _, id := range append([]string{migration.Id}, migration.Squashes...) {
+		if err := ms.deleteRecord(ctx, executor, dbMap, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
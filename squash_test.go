@@ -0,0 +1,118 @@
+package migrate
+
+import (
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+var squashMigrations = []*Migration{
+	&Migration{
+		Id:   "1_people.sql",
+		Up:   []string{"CREATE TABLE people (id int);\n"},
+		Down: []string{"DROP TABLE people;\n"},
+	},
+	&Migration{
+		Id:   "2_name.sql",
+		Up:   []string{"ALTER TABLE people ADD COLUMN name text;\n"},
+		Down: []string{"SELECT 0;\n"},
+	},
+	&Migration{
+		Id:   "3_pets.sql",
+		Up:   []string{"CREATE TABLE pets (id int);\n"},
+		Down: []string{"DROP TABLE pets;\n"},
+	},
+}
+
+func (s *SqliteMigrateSuite) TestSquash(c *C) {
+	migrations := &MemoryMigrationSource{Migrations: squashMigrations}
+
+	squashed, err := Squash(migrations, "2_name_squashed.sql", "1_people.sql", "2_name.sql")
+	c.Assert(err, IsNil)
+	c.Assert(squashed.Squashes, DeepEquals, []string{"1_people.sql", "2_name.sql"})
+	c.Assert(squashed.Up, DeepEquals, []string{
+		"CREATE TABLE people (id int);\n",
+		"ALTER TABLE people ADD COLUMN name text;\n",
+	})
+	c.Assert(squashed.Down, DeepEquals, []string{"SELECT 0;\n", "DROP TABLE people;\n"})
+
+	// The written file parses back into the same migration
+	var b strings.Builder
+	c.Assert(WriteMigration(&b, squashed), IsNil)
+	parsed, err := ParseMigration("2_name_squashed.sql", strings.NewReader(b.String()))
+	c.Assert(err, IsNil)
+	c.Assert(parsed.Squashes, DeepEquals, squashed.Squashes)
+	c.Assert(parsed.Up, DeepEquals, squashed.Up)
+	c.Assert(parsed.Down, DeepEquals, squashed.Down)
+
+	_, err = Squash(migrations, "x.sql", "2_name.sql", "1_people.sql")
+	c.Assert(err, FitsTypeOf, &PlanError{})
+	_, err = Squash(migrations, "x.sql", "1_people.sql", "9_unknown.sql")
+	c.Assert(err, FitsTypeOf, &PlanError{})
+}
+
+func (s *SqliteMigrateSuite) TestSquashedMigrationsApplied(c *C) {
+	ms := MigrationSet{}
+	migrations := &MemoryMigrationSource{Migrations: squashMigrations}
+	n, err := ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 3)
+
+	squashed, err := Squash(migrations, "2_name_squashed.sql", "1_people.sql", "2_name.sql")
+	c.Assert(err, IsNil)
+	migrations = &MemoryMigrationSource{Migrations: []*Migration{squashed, squashMigrations[2]}}
+
+	// The database that has the squashed migrations is up to date
+	planned, _, err := ms.PlanMigration(s.Db, "sqlite3", migrations, Up, 0)
+	c.Assert(err, IsNil)
+	c.Assert(planned, HasLen, 0)
+
+	// Rolling back the squashing migration forgets the squashed ones
+	n, err = ms.Exec(s.Db, "sqlite3", migrations, Down)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+	records, err := ms.GetMigrationRecords(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 0)
+
+	// A fresh database only runs the squashing migration
+	planned, _, err = ms.PlanMigration(s.Db, "sqlite3", migrations, Up, 0)
+	c.Assert(err, IsNil)
+	c.Assert(planned, HasLen, 2)
+	c.Assert(planned[0].Id, Equals, "2_name_squashed.sql")
+	c.Assert(planned[1].Id, Equals, "3_pets.sql")
+}
+
+func (s *SqliteMigrateSuite) TestSquashedMigrationsPartlyApplied(c *C) {
+	ms := MigrationSet{}
+	n, err := ms.ExecMax(s.Db, "sqlite3", &MemoryMigrationSource{Migrations: squashMigrations}, Up, 1)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+
+	squashed, err := Squash(&MemoryMigrationSource{Migrations: squashMigrations}, "2_name_squashed.sql", "1_people.sql", "2_name.sql")
+	c.Assert(err, IsNil)
+
+	migrations := &MemoryMigrationSource{Migrations: []*Migration{squashed}}
+	_, _, err = ms.PlanMigration(s.Db, "sqlite3", migrations, Up, 0)
+	c.Assert(err, FitsTypeOf, &PlanError{})
+	c.Assert(err.(*PlanError).MigrationName, Equals, "2_name_squashed.sql")
+}
+
+func (s *SqliteMigrateSuite) TestSquashedMigrationsWithHole(c *C) {
+	ms := MigrationSet{}
+	applied := []*Migration{squashMigrations[0], squashMigrations[2]}
+	n, err := ms.Exec(s.Db, "sqlite3", &MemoryMigrationSource{Migrations: applied}, Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+
+	// The last squashed migration is applied, but one before it is not
+	squashed, err := Squash(&MemoryMigrationSource{Migrations: squashMigrations}, "3_pets_squashed.sql",
+		"1_people.sql", "3_pets.sql")
+	c.Assert(err, IsNil)
+
+	migrations := &MemoryMigrationSource{Migrations: []*Migration{squashed}}
+	_, _, err = ms.PlanMigration(s.Db, "sqlite3", migrations, Up, 0)
+	c.Assert(err, FitsTypeOf, &PlanError{})
+	c.Assert(err.(*PlanError).MigrationName, Equals, "3_pets_squashed.sql")
+	c.Assert(err, ErrorMatches, ".*partly applied \\(1_people.sql, 3_pets.sql\\).*")
+}
@@ -0,0 +1,87 @@
+package migrate
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TagFilter selects migrations by the tags of their '-- +migrate Tags:'
+// header. Migrations without tags are never filtered out.
+type TagFilter struct {
+	// Include makes tagged migrations run only when they have one of these
+	// tags. When it is empty, all of them run.
+	Include []string
+	// Exclude filters out migrations that have any of these tags, even when
+	// they have an included tag as well.
+	Exclude []string
+}
+
+// SetTagFilter sets the tags that migrations are filtered by. See TagFilter.
+func SetTagFilter(include, exclude []string) {
+	migSet.Tags = TagFilter{Include: include, Exclude: exclude}
+}
+
+// Reason returns why a migration with tags is filtered out, or an empty
+// string when it isn't.
+func (f TagFilter) Reason(tags []string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+
+	for _, tag := range tags {
+		if containsTag(f.Exclude, tag) {
+			return fmt.Sprintf("tag %s is skipped", tag)
+		}
+	}
+
+	if len(f.Include) == 0 {
+		return ""
+	}
+	for _, tag := range tags {
+		if containsTag(f.Include, tag) {
+			return ""
+		}
+	}
+	return fmt.Sprintf("not tagged %s", strings.Join(f.Include, " or "))
+}
+
+func containsTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// skipped reports whether the named migration is filtered out by the Tags of
+// the set, and logs why.
+func (ms MigrationSet) skipped(name string, tags []string) bool {
+	reason := ms.Tags.Reason(tags)
+	if reason == "" {
+		return false
+	}
+	ms.log(LogInfo, "Skipping migration filtered by tags", "migration", name, "reason", reason)
+	return true
+}
+
+// patchFilter returns a function that reports whether a patch is filtered out
+// by the Tags of the set, given patches in the order they would run. The
+// record of a version implies all of its patches up to the recorded one, so
+// once a patch is filtered out the patches of its version that would run
+// after it are filtered out too.
+func (ms MigrationSet) patchFilter() func(migration *MigrationPatch) bool {
+	held := make(map[string]string)
+	return func(migration *MigrationPatch) bool {
+		if name, ok := held[migration.Ver]; ok {
+			ms.log(LogInfo, "Skipping migration filtered by tags", "migration", migration.Name,
+				"reason", "follows filtered migration "+name)
+			return true
+		}
+		if ms.skipped(migration.Name, migration.Tags) {
+			held[migration.Ver] = migration.Name
+			return true
+		}
+		return false
+	}
+}
@@ -0,0 +1,131 @@
+package migrate
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+func (s *SqliteMigrateSuite) TestTagFilterReason(c *C) {
+	filter := TagFilter{Include: []string{"seed", "staging"}, Exclude: []string{"slow"}}
+	c.Assert(filter.Reason(nil), Equals, "")
+	c.Assert(filter.Reason([]string{"staging"}), Equals, "")
+	c.Assert(filter.Reason([]string{"ops"}), Equals, "not tagged seed or staging")
+	c.Assert(filter.Reason([]string{"seed", "slow"}), Equals, "tag slow is skipped")
+	c.Assert(TagFilter{}.Reason([]string{"ops"}), Equals, "")
+}
+
+func (s *SqliteMigrateSuite) TestTagFilter(c *C) {
+	migrations := &MemoryMigrationSource{
+		Migrations: []*Migration{
+			{
+				Id:   "1_people.sql",
+				Up:   []string{"CREATE TABLE people (id int)"},
+				Down: []string{"DROP TABLE people"},
+			},
+			{
+				Id:   "2_seed.sql",
+				Up:   []string{"INSERT INTO people (id) VALUES (1)"},
+				Down: []string{"DELETE FROM people"},
+				Tags: []string{"seed"},
+			},
+			{
+				Id:   "3_pets.sql",
+				Up:   []string{"CREATE TABLE pets (id int)"},
+				Down: []string{"DROP TABLE pets"},
+			},
+		},
+	}
+
+	ms := MigrationSet{Tags: TagFilter{Exclude: []string{"seed"}}}
+	planned, _, err := ms.PlanMigration(s.Db, "sqlite3", migrations, Up, 2)
+	c.Assert(err, IsNil)
+	c.Assert(planned, HasLen, 2)
+	c.Assert(planned[1].Id, Equals, "3_pets.sql")
+
+	n, err := ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+
+	// The seed is caught up on once it is included
+	ms.Tags = TagFilter{Include: []string{"seed"}}
+	n, err = ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+	var count int
+	c.Assert(s.Db.QueryRow("SELECT COUNT(*) FROM people").Scan(&count), IsNil)
+	c.Assert(count, Equals, 1)
+}
+
+func (s *SqliteMigrateSuite) TestTagFilterDown(c *C) {
+	migrations := &MemoryMigrationSource{
+		Migrations: []*Migration{
+			{
+				Id:   "1_people.sql",
+				Up:   []string{"CREATE TABLE people (id int)"},
+				Down: []string{"DROP TABLE people"},
+			},
+			{
+				Id:   "2_seed.sql",
+				Up:   []string{"INSERT INTO people (id) VALUES (1)"},
+				Down: []string{"DELETE FROM people"},
+				Tags: []string{"seed"},
+			},
+			{
+				Id:   "3_pets.sql",
+				Up:   []string{"CREATE TABLE pets (id int)"},
+				Down: []string{"DROP TABLE pets"},
+			},
+		},
+	}
+
+	ms := MigrationSet{Tags: TagFilter{Exclude: []string{"seed"}}}
+	n, err := ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+
+	// Rolling back without the filter leaves out the seed, which was never
+	// applied
+	ms.Tags = TagFilter{}
+	planned, _, err := ms.PlanMigration(s.Db, "sqlite3", migrations, Down, 0)
+	c.Assert(err, IsNil)
+	c.Assert(planned, HasLen, 2)
+	c.Assert(planned[0].Id, Equals, "3_pets.sql")
+	c.Assert(planned[0].Queries, DeepEquals, migrations.Migrations[2].Down)
+	c.Assert(planned[1].Id, Equals, "1_people.sql")
+	c.Assert(planned[1].Queries, DeepEquals, migrations.Migrations[0].Down)
+}
+
+func (s *SqliteMigrateSuite) TestTagFilterPatch(c *C) {
+	migrations := &MemoryMigrationSource{
+		MigrationsPatch: []*MigrationPatch{
+			{
+				Name: "0001_00_people.sql",
+				Up:   []string{"CREATE TABLE people (id int)"},
+				Down: []string{"DROP TABLE people"},
+			},
+			{
+				Name: "0001_01_reindex.sql",
+				Up:   []string{"REINDEX people"},
+				Down: []string{"SELECT 0"},
+				Tags: []string{"ops"},
+			},
+			{
+				Name: "0001_02_name.sql",
+				Up:   []string{"ALTER TABLE people ADD COLUMN name text"},
+				Down: []string{"SELECT 0"},
+			},
+			{
+				Name: "0002_00_pets.sql",
+				Up:   []string{"CREATE TABLE pets (id int)"},
+				Down: []string{"DROP TABLE pets"},
+			},
+		},
+	}
+
+	// The patches of a version after a filtered one are held back as well
+	ms := MigrationSet{EnablePatchMode: true, Tags: TagFilter{Include: []string{"seed"}}}
+	planned, _, err := ms.PlanMigrationPatch(s.Db, "sqlite3", migrations, Up, 0)
+	c.Assert(err, IsNil)
+	c.Assert(planned, HasLen, 2)
+	c.Assert(planned[0].Name, Equals, "0001_00_people.sql")
+	c.Assert(planned[1].Name, Equals, "0002_00_pets.sql")
+}
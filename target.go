@@ -0,0 +1,315 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"strconv"
+
+	"gopkg.in/gorp.v1"
+)
+
+var patchTargetRegex = regexp.MustCompile(`^(\d+)(?:_(\d+))?(?:_.*)?$`)
+
+// Migrate to a target migration
+//
+// Applies the migrations up to and including target when it hasn't been
+// applied yet, otherwise rolls back the migrations applied after it.
+//
+// Returns the number of applied migrations.
+func ExecTo(db *sql.DB, dialect string, m MigrationSource, target string) (int, error) {
+	return migSet.ExecTo(db, dialect, m, target)
+}
+
+// Migrate to a target migration with a context
+//
+// Returns the number of applied migrations.
+func ExecToContext(ctx context.Context, db *sql.DB, dialect string, m MigrationSource, target string) (int, error) {
+	return migSet.ExecToContext(ctx, db, dialect, m, target)
+}
+
+// Returns the number of applied migrations.
+func (ms MigrationSet) ExecTo(db *sql.DB, dialect string, m MigrationSource, target string) (int, error) {
+	return ms.ExecToContext(context.Background(), db, dialect, m, target)
+}
+
+// Returns the number of applied migrations.
+func (ms MigrationSet) ExecToContext(ctx context.Context, db *sql.DB, dialect string, m MigrationSource, target string) (int, error) {
+	if ms.EnablePatchMode {
+		return ms.ExecToPatchContext(ctx, db, dialect, m, target)
+	}
+
+	lock, err := ms.lockIfEnabled(ctx, db, dialect)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = lock.Unlock() }()
+
+	if err := ms.hooks().BeforePlan(ctx, &PlanEvent{Target: target, Executor: db}); err != nil {
+		return 0, err
+	}
+
+	migrations, dir, dbMap, err := ms.PlanToContext(ctx, db, dialect, m, target)
+	if err != nil {
+		return 0, err
+	}
+
+	return ms.applyMigrations(ctx, db, dbMap, migrations, dir)
+}
+
+// Plan a migration to a target migration.
+func PlanTo(db *sql.DB, dialect string, m MigrationSource, target string) ([]*PlannedMigration, MigrationDirection, *gorp.DbMap, error) {
+	return migSet.PlanTo(db, dialect, m, target)
+}
+
+// Plan a migration to a target migration with a context.
+func PlanToContext(ctx context.Context, db *sql.DB, dialect string, m MigrationSource, target string) ([]*PlannedMigration, MigrationDirection, *gorp.DbMap, error) {
+	return migSet.PlanToContext(ctx, db, dialect, m, target)
+}
+
+func (ms MigrationSet) PlanTo(db *sql.DB, dialect string, m MigrationSource, target string) ([]*PlannedMigration, MigrationDirection, *gorp.DbMap, error) {
+	return ms.PlanToContext(context.Background(), db, dialect, m, target)
+}
+
+// PlanToContext plans the migrations that bring the database to target, the
+// Id of a migration, and returns the direction they have to be run in.
+//
+// When target hasn't been applied, the unapplied migrations up to and
+// including it are planned Up, along with the migrations they require.
+// Otherwise the other applied migrations are planned Down, so that target is
+// the last applied migration. A *PlanError is returned when target is not
+// among the migrations.
+func (ms MigrationSet) PlanToContext(ctx context.Context, db *sql.DB, dialect string, m MigrationSource,
+	target string) ([]*PlannedMigration, MigrationDirection, *gorp.DbMap, error) {
+	dbMap, err := ms.getMigrationDbMap(ctx, db, dialect)
+	if err != nil {
+		return nil, Up, nil, err
+	}
+
+	migrations, existingMigrations, err := ms.loadMigrations(ctx, db, dbMap, dialect, m)
+	if err != nil {
+		return nil, Up, nil, err
+	}
+	deps, err := migrationDependencies(migrations)
+	if err != nil {
+		return nil, Up, nil, err
+	}
+
+	index := -1
+	for i, migration := range migrations {
+		if migration.Id == target {
+			index = i
+			break
+		}
+	}
+	if index == -1 {
+		return nil, Up, nil, newPlanError(target, "unknown migration target")
+	}
+
+	applied := make(map[string]bool)
+	for _, existing := range existingMigrations {
+		applied[existing.Id] = true
+	}
+
+	// The migrations that are applied once target is, those sorting after it
+	// included when they are required.
+	toTarget := make(map[string]bool)
+	for _, v := range migrations[:index+1] {
+		toTarget[v.Id] = true
+	}
+	if deps != nil {
+		toTarget = deps.closure(toTarget)
+	}
+
+	result := make([]*PlannedMigration, 0)
+	if !applied[target] {
+		for _, v := range migrations {
+			if toTarget[v.Id] && !applied[v.Id] && !ms.skipped(v.Id, v.Tags) {
+				result = append(result, &PlannedMigration{
+					Migration:          v,
+					Queries:            v.Up,
+					Func:               v.UpFunc,
+					DisableTransaction: v.DisableTransactionUp,
+				})
+			}
+		}
+		if deps != nil {
+			if result, err = deps.sortPlanned(result, applied, Up); err != nil {
+				return nil, Up, nil, err
+			}
+		}
+		ms.log(LogDebug, "Planned migrations", "direction", Up, "count", len(result), "target", target)
+		return result, Up, dbMap, nil
+	}
+
+	for i := len(migrations) - 1; i >= 0; i-- {
+		v := migrations[i]
+		if !toTarget[v.Id] && applied[v.Id] && !ms.skipped(v.Id, v.Tags) {
+			result = append(result, &PlannedMigration{
+				Migration:          v,
+				Queries:            v.Down,
+				Func:               v.DownFunc,
+				DisableTransaction: v.DisableTransactionDown,
+			})
+		}
+	}
+	if deps != nil {
+		if result, err = deps.sortPlanned(result, applied, Down); err != nil {
+			return nil, Down, nil, err
+		}
+	}
+	ms.log(LogDebug, "Planned migrations", "direction", Down, "count", len(result), "target", target)
+	return result, Down, dbMap, nil
+}
+
+// Returns the number of applied migrations.
+func (ms MigrationSet) ExecToPatch(db *sql.DB, dialect string, m MigrationSource, target string) (int, error) {
+	return ms.ExecToPatchContext(context.Background(), db, dialect, m, target)
+}
+
+// Returns the number of applied migrations.
+func (ms MigrationSet) ExecToPatchContext(ctx context.Context, db *sql.DB, dialect string, m MigrationSource, target string) (int, error) {
+	lock, err := ms.lockIfEnabled(ctx, db, dialect)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = lock.Unlock() }()
+
+	if err := ms.hooks().BeforePlan(ctx, &PlanEvent{Target: target, Executor: db}); err != nil {
+		return 0, err
+	}
+
+	migrations, dir, dbMap, err := ms.PlanToPatchContext(ctx, db, dialect, m, target)
+	if err != nil {
+		return 0, err
+	}
+
+	all, err := ms.findMigrationsPatch(m, dialect)
+	if err != nil {
+		return 0, err
+	}
+
+	return ms.applyMigrationsPatch(ctx, db, dbMap, all, migrations, dir)
+}
+
+// Plan a migration to a target patch.
+func PlanToPatch(db *sql.DB, dialect string, m MigrationSource, target string) ([]*PlannedMigrationPatch, MigrationDirection, *gorp.DbMap, error) {
+	return migSet.PlanToPatch(db, dialect, m, target)
+}
+
+// Plan a migration to a target patch with a context.
+func PlanToPatchContext(ctx context.Context, db *sql.DB, dialect string, m MigrationSource,
+	target string) ([]*PlannedMigrationPatch, MigrationDirection, *gorp.DbMap, error) {
+	return migSet.PlanToPatchContext(ctx, db, dialect, m, target)
+}
+
+func (ms MigrationSet) PlanToPatch(db *sql.DB, dialect string, m MigrationSource, target string) ([]*PlannedMigrationPatch, MigrationDirection, *gorp.DbMap, error) {
+	return ms.PlanToPatchContext(context.Background(), db, dialect, m, target)
+}
+
+// PlanToPatchContext is PlanToContext for patch mode. The target is given as
+// "version_patch", e.g. "0002_01", or as a migration name. A target of just a
+// version is its last patch. As patch mode migrations only require earlier
+// ones, the migrations up to target include those they require.
+func (ms MigrationSet) PlanToPatchContext(ctx context.Context, db *sql.DB, dialect string, m MigrationSource,
+	target string) ([]*PlannedMigrationPatch, MigrationDirection, *gorp.DbMap, error) {
+	dbMap, err := ms.getMigrationDbMap(ctx, db, dialect)
+	if err != nil {
+		return nil, Up, nil, err
+	}
+
+	newMigrations, existingMigrations, err := ms.loadMigrationsPatch(ctx, db, dbMap, dialect, m)
+	if err != nil {
+		return nil, Up, nil, err
+	}
+	deps, err := migrationPatchDependencies(newMigrations)
+	if err != nil {
+		return nil, Up, nil, err
+	}
+
+	index := findPatchTarget(newMigrations, target)
+	if index == -1 {
+		return nil, Up, nil, newPlanError(target, "unknown migration target")
+	}
+
+	// The record of a version holds its last applied patch.
+	appliedPatches := make(map[int64]int64)
+	for _, existing := range existingMigrations {
+		appliedPatches[existing.VerInt] = existing.PatchInt
+	}
+	isApplied := func(migration *MigrationPatch) bool {
+		patch, ok := appliedPatches[migration.VerInt]
+		return ok && patch >= migration.PatchInt
+	}
+
+	result := make([]*PlannedMigrationPatch, 0)
+	skipped := ms.patchFilter()
+	if !isApplied(newMigrations[index]) {
+		for _, v := range newMigrations[:index+1] {
+			if !isApplied(v) && !skipped(v) {
+				result = append(result, &PlannedMigrationPatch{
+					MigrationPatch:     v,
+					Queries:            v.Up,
+					Func:               v.UpFunc,
+					DisableTransaction: v.DisableTransactionUp,
+				})
+			}
+		}
+		if deps != nil {
+			applied := appliedPatchNames(newMigrations, existingMigrations)
+			if err := deps.checkPlannedPatch(result, applied, Up); err != nil {
+				return nil, Up, nil, err
+			}
+		}
+		ms.log(LogDebug, "Planned migrations", "direction", Up, "count", len(result), "target", target)
+		return result, Up, dbMap, nil
+	}
+
+	for i := len(newMigrations) - 1; i > index; i-- {
+		v := newMigrations[i]
+		if isApplied(v) && !skipped(v) {
+			result = append(result, &PlannedMigrationPatch{
+				MigrationPatch:     v,
+				Queries:            v.Down,
+				Func:               v.DownFunc,
+				DisableTransaction: v.DisableTransactionDown,
+			})
+		}
+	}
+	if deps != nil {
+		applied := appliedPatchNames(newMigrations, existingMigrations)
+		if err := deps.checkPlannedPatch(result, applied, Down); err != nil {
+			return nil, Down, nil, err
+		}
+	}
+	ms.log(LogDebug, "Planned migrations", "direction", Down, "count", len(result), "target", target)
+	return result, Down, dbMap, nil
+}
+
+// findPatchTarget returns the index of the migration target refers to, or -1.
+func findPatchTarget(migrations []*MigrationPatch, target string) int {
+	matches := patchTargetRegex.FindStringSubmatch(target)
+	if matches == nil {
+		return -1
+	}
+	ver, err := strconv.ParseInt(matches[1], 10, 64)
+	if err != nil {
+		return -1
+	}
+
+	index := -1
+	for i, migration := range migrations {
+		if migration.VerInt != ver {
+			continue
+		}
+		if matches[2] == "" {
+			// Migrations are sorted, so this ends on the last patch.
+			index = i
+			continue
+		}
+		if patch, err := strconv.ParseInt(matches[2], 10, 64); err == nil && migration.PatchInt == patch {
+			return i
+		}
+	}
+	return index
+}
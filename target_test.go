@@ -0,0 +1,167 @@
+package migrate
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+func (s *SqliteMigrateSuite) TestExecTo(c *C) {
+	migrations := &MemoryMigrationSource{
+		Migrations: []*Migration{
+			sqliteMigrations[0],
+			sqliteMigrations[1],
+			&Migration{
+				Id:   "125",
+				Up:   []string{"CREATE TABLE pets (id int)"},
+				Down: []string{"DROP TABLE pets"},
+			},
+		},
+	}
+
+	ms := MigrationSet{}
+
+	planned, dir, _, err := ms.PlanTo(s.Db, "sqlite3", migrations, "124")
+	c.Assert(err, IsNil)
+	c.Assert(dir, Equals, Up)
+	c.Assert(planned, HasLen, 2)
+	c.Assert(planned[0].Id, Equals, "123")
+	c.Assert(planned[1].Id, Equals, "124")
+
+	n, err := ms.ExecTo(s.Db, "sqlite3", migrations, "124")
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+
+	_, err = s.DbMap.Exec("SELECT first_name FROM people")
+	c.Assert(err, IsNil)
+	_, err = s.DbMap.Exec("SELECT * FROM pets")
+	c.Assert(err, Not(IsNil))
+
+	// Already there
+	n, err = ms.ExecTo(s.Db, "sqlite3", migrations, "124")
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 0)
+
+	n, err = ms.ExecTo(s.Db, "sqlite3", migrations, "125")
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+
+	// Back down to the first one
+	planned, dir, _, err = ms.PlanTo(s.Db, "sqlite3", migrations, "123")
+	c.Assert(err, IsNil)
+	c.Assert(dir, Equals, Down)
+	c.Assert(planned, HasLen, 2)
+	c.Assert(planned[0].Id, Equals, "125")
+	c.Assert(planned[1].Id, Equals, "124")
+
+	n, err = ms.ExecTo(s.Db, "sqlite3", migrations, "123")
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+
+	_, err = s.DbMap.Exec("SELECT * FROM pets")
+	c.Assert(err, Not(IsNil))
+	_, err = s.DbMap.Exec("SELECT * FROM people")
+	c.Assert(err, IsNil)
+
+	records, err := ms.GetMigrationRecords(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 1)
+	c.Assert(records[0].Id, Equals, "123")
+}
+
+func (s *SqliteMigrateSuite) TestExecToWithHoles(c *C) {
+	migrations := &MemoryMigrationSource{
+		Migrations: []*Migration{
+			sqliteMigrations[0],
+			&Migration{
+				Id:   "125",
+				Up:   []string{"CREATE TABLE pets (id int)"},
+				Down: []string{"DROP TABLE pets"},
+			},
+		},
+	}
+
+	ms := MigrationSet{}
+	_, err := ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+
+	// 124 was merged in later
+	migrations.Migrations = []*Migration{migrations.Migrations[0], sqliteMigrations[1], migrations.Migrations[1]}
+
+	planned, dir, _, err := ms.PlanTo(s.Db, "sqlite3", migrations, "124")
+	c.Assert(err, IsNil)
+	c.Assert(dir, Equals, Up)
+	c.Assert(planned, HasLen, 1)
+	c.Assert(planned[0].Id, Equals, "124")
+
+	// Only applied migrations are rolled back
+	planned, dir, _, err = ms.PlanTo(s.Db, "sqlite3", migrations, "123")
+	c.Assert(err, IsNil)
+	c.Assert(dir, Equals, Down)
+	c.Assert(planned, HasLen, 1)
+	c.Assert(planned[0].Id, Equals, "125")
+}
+
+func (s *SqliteMigrateSuite) TestExecToUnknownTarget(c *C) {
+	migrations := &MemoryMigrationSource{
+		Migrations: sqliteMigrations[:1],
+	}
+
+	ms := MigrationSet{}
+	n, err := ms.ExecTo(s.Db, "sqlite3", migrations, "999")
+	c.Assert(err, FitsTypeOf, &PlanError{})
+	c.Assert(err.(*PlanError).MigrationName, Equals, "999")
+	c.Assert(n, Equals, 0)
+}
+
+func (s *SqliteMigrateSuite) TestExecToPatch(c *C) {
+	migrations := &MemoryMigrationSource{
+		MigrationsPatch: sqliteMigrationsPatch,
+	}
+
+	ms := MigrationSet{EnablePatchMode: true}
+
+	planned, dir, _, err := ms.PlanToPatch(s.Db, "sqlite3", migrations, "0002_00")
+	c.Assert(err, IsNil)
+	c.Assert(dir, Equals, Up)
+	c.Assert(planned, HasLen, 2)
+	c.Assert(planned[0].Name, Equals, "0001_00_initial.sql")
+	c.Assert(planned[1].Name, Equals, "0002_00_second.sql")
+
+	// A version on its own is its last patch
+	n, err := ms.ExecTo(s.Db, "sqlite3", migrations, "2")
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 3)
+
+	_, err = s.DbMap.Exec("SELECT * FROM deposit")
+	c.Assert(err, IsNil)
+
+	n, err = ms.ExecTo(s.Db, "sqlite3", migrations, "0004_00_alter_people.sql")
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+
+	// Roll back into the middle of version 2
+	planned, dir, _, err = ms.PlanToPatch(s.Db, "sqlite3", migrations, "0002_00")
+	c.Assert(err, IsNil)
+	c.Assert(dir, Equals, Down)
+	c.Assert(planned, HasLen, 3)
+	c.Assert(planned[0].Name, Equals, "0004_00_alter_people.sql")
+	c.Assert(planned[1].Name, Equals, "0003_42_second_patch.sql")
+	c.Assert(planned[2].Name, Equals, "0002_01_second_patch.sql")
+
+	n, err = ms.ExecTo(s.Db, "sqlite3", migrations, "0002_00")
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 3)
+
+	_, err = s.DbMap.Exec("SELECT * FROM deposit")
+	c.Assert(err, Not(IsNil))
+	_, err = s.DbMap.Exec("SELECT * FROM balance")
+	c.Assert(err, IsNil)
+
+	records, err := ms.GetMigrationPatchRecords(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 2)
+	c.Assert(records[1].Ver, Equals, "0002")
+	c.Assert(records[1].Patch, Equals, "00")
+
+	_, err = ms.ExecTo(s.Db, "sqlite3", migrations, "0002_07")
+	c.Assert(err, FitsTypeOf, &PlanError{})
+}
@@ -0,0 +1,121 @@
+package migrate
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"text/template"
+
+	"github.com/rubenv/sql-migrate/sqlparse"
+)
+
+// SetTemplateVars sets the variables that migrations annotated with
+// '-- +migrate Template' are rendered with.
+func SetTemplateVars(vars map[string]interface{}) {
+	migSet.TemplateVars = vars
+}
+
+// readTemplate returns the source of r when it is a template migration.
+func readTemplate(r io.ReadSeeker) (string, bool, error) {
+	isTemplate, err := sqlparse.IsTemplate(r)
+	if err != nil || !isTemplate {
+		return "", false, err
+	}
+
+	if _, err := r.Seek(0, 0); err != nil {
+		return "", false, err
+	}
+	source, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", false, err
+	}
+	return string(source), true, nil
+}
+
+// render renders the template of the named migration with the TemplateVars
+// and parses the result. Using a variable that isn't set is an error.
+func (ms MigrationSet) render(name, source string) (*sqlparse.ParsedMigration, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(source)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing template of migration (%s): %s", name, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, ms.TemplateVars); err != nil {
+		return nil, fmt.Errorf("Error rendering migration (%s): %s", name, err)
+	}
+
+	parsed, err := sqlparse.ParseMigration(strings.NewReader(buf.String()))
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing migration (%s): %s", name, err)
+	}
+	return parsed, nil
+}
+
+// findAllMigrations returns the migrations of m for dialect, repeatable ones
+// included, with templates rendered.
+func (ms MigrationSet) findAllMigrations(m MigrationSource, dialect string) ([]*Migration, error) {
+	migrations, err := m.FindMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, migration := range migrations {
+		if migration.Template != "" {
+			parsed, err := ms.render(migration.Id, migration.Template)
+			if err != nil {
+				return nil, err
+			}
+
+			// The source may be reused, so it is left as it is. Lines of the
+			// rendered template don't match those of the file, so they are
+			// left out.
+			rendered := *migration
+			rendered.Up = parsed.UpStatements
+			rendered.Down = parsed.DownStatements
+			rendered.DisableTransactionUp = parsed.DisableTransactionUp
+			rendered.DisableTransactionDown = parsed.DisableTransactionDown
+			rendered.UpDialects = parsed.UpDialects
+			rendered.DownDialects = parsed.DownDialects
+			rendered.Tags = parsed.Tags
+			rendered.Squashes = parsed.Squashes
+			rendered.Requires = parsed.Requires
+			migration = &rendered
+		}
+		migrations[i] = migration.forDialect(dialect)
+	}
+	return migrations, nil
+}
+
+// findAllMigrationsPatch returns the patch mode migrations of m for dialect,
+// repeatable ones included, with templates rendered.
+func (ms MigrationSet) findAllMigrationsPatch(m MigrationSource, dialect string) ([]*MigrationPatch, error) {
+	migrations, err := m.FindMigrationsPatch()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, migration := range migrations {
+		if migration.Template != "" {
+			parsed, err := ms.render(migration.Name, migration.Template)
+			if err != nil {
+				return nil, err
+			}
+
+			rendered := *migration
+			rendered.Up = parsed.UpStatements
+			rendered.Down = parsed.DownStatements
+			rendered.DisableTransactionUp = parsed.DisableTransactionUp
+			rendered.DisableTransactionDown = parsed.DisableTransactionDown
+			rendered.UpDialects = parsed.UpDialects
+			rendered.DownDialects = parsed.DownDialects
+			rendered.Tags = parsed.Tags
+			rendered.Requires = parsed.Requires
+			migration = &rendered
+		}
+		migrations[i] = migration.forDialect(dialect)
+	}
+	return migrations, nil
+}
@@ -0,0 +1,71 @@
+package migrate
+
+import (
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+const templateMigration = `-- +migrate Template
+-- +migrate Up
+CREATE TABLE {{.table}} (
+{{- range $i, $c := .columns}}{{if $i}},{{end}} {{$c}} int{{end}});
+{{range .columns}}CREATE INDEX {{$.table}}_{{.}} ON {{$.table}} ({{.}});
+{{end -}}
+-- +migrate Down
+DROP TABLE {{.table}};
+`
+
+func (s *SqliteMigrateSuite) TestTemplateMigration(c *C) {
+	migration, err := ParseMigration("1_people.sql", strings.NewReader(templateMigration))
+	c.Assert(err, IsNil)
+	c.Assert(migration.Template, Equals, templateMigration)
+	migrations := &MemoryMigrationSource{Migrations: []*Migration{migration}}
+
+	ms := MigrationSet{TemplateVars: map[string]interface{}{"table": "people"}}
+	_, _, err = ms.PlanMigration(s.Db, "sqlite3", migrations, Up, 0)
+	c.Assert(err, ErrorMatches, `Error rendering migration \(1_people.sql\): .*columns.*`)
+
+	ms.TemplateVars["columns"] = []string{"id", "age"}
+	planned, _, err := ms.PlanMigration(s.Db, "sqlite3", migrations, Up, 0)
+	c.Assert(err, IsNil)
+	c.Assert(planned, HasLen, 1)
+	c.Assert(planned[0].Queries, DeepEquals, []string{
+		"CREATE TABLE people ( id int, age int);\n",
+		"CREATE INDEX people_id ON people (id);\n",
+		"CREATE INDEX people_age ON people (age);\n",
+	})
+	c.Assert(migrations.Migrations[0].Up, HasLen, 0)
+
+	n, err := ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+	_, err = s.Db.Exec("SELECT id, age FROM people")
+	c.Assert(err, IsNil)
+
+	// The checksum is that of the rendered migration
+	records, err := ms.GetMigrationRecords(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(planned[0].Down, DeepEquals, []string{"DROP TABLE people;\n"})
+	c.Assert(records[0].Checksum, Equals, planned[0].Checksum())
+
+	ms.TemplateVars["table"] = "persons"
+	_, _, err = ms.PlanMigration(s.Db, "sqlite3", migrations, Up, 0)
+	c.Assert(err, FitsTypeOf, &ChecksumError{})
+}
+
+func (s *SqliteMigrateSuite) TestTemplateMigrationPatch(c *C) {
+	migration, err := ParseMigrationPatch("0001_00_people.sql", strings.NewReader(templateMigration))
+	c.Assert(err, IsNil)
+	migrations := &MemoryMigrationSource{MigrationsPatch: []*MigrationPatch{migration}}
+
+	ms := MigrationSet{
+		EnablePatchMode: true,
+		TemplateVars:    map[string]interface{}{"table": "people", "columns": []string{"id"}},
+	}
+	n, err := ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+	_, err = s.Db.Exec("SELECT id FROM people")
+	c.Assert(err, IsNil)
+}
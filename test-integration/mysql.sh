@@ -9,6 +9,7 @@ set -ex
 
 sql-migrate status $OPTIONS
 sql-migrate up $OPTIONS
+sql-migrate dump $OPTIONS
 sql-migrate down $OPTIONS
 sql-migrate redo $OPTIONS
 sql-migrate status $OPTIONS
@@ -0,0 +1,231 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/gorp.v1"
+)
+
+// VerifyResult is the outcome of verifying that a migration can be rolled
+// back.
+type VerifyResult struct {
+	Migration string
+
+	// Err is set when running the migration Up or Down failed.
+	Err error
+
+	// Object names the first object, such as "table people", whose schema
+	// after Down differs from the one before Up. Expected and Actual hold its
+	// DDL before Up and after Down, empty when it didn't exist.
+	Object   string
+	Expected string
+	Actual   string
+}
+
+// Passed reports whether the migration was rolled back cleanly.
+func (r *VerifyResult) Passed() bool {
+	return r.Err == nil && r.Object == ""
+}
+
+// Difference describes why the migration didn't pass.
+func (r *VerifyResult) Difference() string {
+	switch {
+	case r.Err != nil:
+		return r.Err.Error()
+	case r.Object == "":
+		return ""
+	case r.Expected == "":
+		return fmt.Sprintf("%s is left after Down", r.Object)
+	case r.Actual == "":
+		return fmt.Sprintf("%s is missing after Down", r.Object)
+	default:
+		return fmt.Sprintf("%s differs after Down", r.Object)
+	}
+}
+
+// Verify that migrations can be rolled back
+//
+// Every pending migration, in order, is applied, rolled back, checked to leave
+// the schema as it was before it was applied, and applied again. Stops at the
+// first migration that fails. Repeatable migrations are not verified.
+//
+// Meant for a scratch database: the verified migrations are left applied.
+// Supported for the dialects DumpSchema supports.
+func Verify(db *sql.DB, dialect string, m MigrationSource) ([]*VerifyResult, error) {
+	return migSet.Verify(db, dialect, m)
+}
+
+// Verify that migrations can be rolled back with a context
+func VerifyContext(ctx context.Context, db *sql.DB, dialect string, m MigrationSource) ([]*VerifyResult, error) {
+	return migSet.VerifyContext(ctx, db, dialect, m)
+}
+
+func (ms MigrationSet) Verify(db *sql.DB, dialect string, m MigrationSource) ([]*VerifyResult, error) {
+	return ms.VerifyContext(context.Background(), db, dialect, m)
+}
+
+func (ms MigrationSet) VerifyContext(ctx context.Context, db *sql.DB, dialect string, m MigrationSource) ([]*VerifyResult, error) {
+	dump, err := getSchemaDumper(dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	lock, err := ms.lockIfEnabled(ctx, db, dialect)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = lock.Unlock() }()
+
+	if ms.EnablePatchMode {
+		return ms.verifyPatch(ctx, db, dialect, m, dump)
+	}
+
+	planned, dbMap, err := ms.PlanMigrationContext(ctx, db, dialect, m, Up, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []*VerifyResult
+	for _, migration := range planned {
+		if migration.Repeatable {
+			continue
+		}
+
+		down := &PlannedMigration{
+			Migration:          migration.Migration,
+			Queries:            migration.Down,
+			Func:               migration.DownFunc,
+			DisableTransaction: migration.DisableTransactionDown,
+		}
+		result, err := ms.verify(ctx, db, dbMap, dump, migration.Id, func(dir MigrationDirection) error {
+			if dir == Up {
+				_, err := ms.applyMigrations(ctx, db, dbMap, []*PlannedMigration{migration}, Up)
+				return err
+			}
+			_, err := ms.applyMigrations(ctx, db, dbMap, []*PlannedMigration{down}, Down)
+			return err
+		})
+		if err != nil {
+			return results, err
+		}
+
+		results = append(results, result)
+		if !result.Passed() {
+			break
+		}
+	}
+	return results, nil
+}
+
+func (ms MigrationSet) verifyPatch(ctx context.Context, db *sql.DB, dialect string, m MigrationSource,
+	dump schemaDumper) ([]*VerifyResult, error) {
+	planned, dbMap, err := ms.PlanMigrationPatchContext(ctx, db, dialect, m, Up, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	all, err := ms.findMigrationsPatch(m, dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []*VerifyResult
+	for _, migration := range planned {
+		if migration.Repeatable {
+			continue
+		}
+
+		down := &PlannedMigrationPatch{
+			MigrationPatch:     migration.MigrationPatch,
+			Queries:            migration.Down,
+			Func:               migration.DownFunc,
+			DisableTransaction: migration.DisableTransactionDown,
+		}
+		result, err := ms.verify(ctx, db, dbMap, dump, migration.Name, func(dir MigrationDirection) error {
+			if dir == Up {
+				_, err := ms.applyMigrationsPatch(ctx, db, dbMap, all, []*PlannedMigrationPatch{migration}, Up)
+				return err
+			}
+			_, err := ms.applyMigrationsPatch(ctx, db, dbMap, all, []*PlannedMigrationPatch{down}, Down)
+			return err
+		})
+		if err != nil {
+			return results, err
+		}
+
+		results = append(results, result)
+		if !result.Passed() {
+			break
+		}
+	}
+	return results, nil
+}
+
+// verify runs a migration up, down and up again with apply, comparing the
+// schema before the first Up with the one after Down. Failures of the
+// migration end up in the result, failures to dump the schema are returned.
+func (ms MigrationSet) verify(ctx context.Context, db *sql.DB, dbMap *gorp.DbMap, dump schemaDumper, name string,
+	apply func(MigrationDirection) error) (*VerifyResult, error) {
+	result := &VerifyResult{Migration: name}
+
+	before, err := ms.snapshot(ctx, db, dbMap, dump)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Err = apply(Up); result.Err != nil {
+		return result, nil
+	}
+	if result.Err = apply(Down); result.Err != nil {
+		return result, nil
+	}
+
+	after, err := ms.snapshot(ctx, db, dbMap, dump)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for key := range before {
+		keys = append(keys, key)
+	}
+	for key := range after {
+		if _, ok := before[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if before[key] != after[key] {
+			result.Object, result.Expected, result.Actual = key, before[key], after[key]
+			ms.log(LogError, "Migration is not reversible", "migration", name, "object", key)
+			return result, nil
+		}
+	}
+
+	result.Err = apply(Up)
+	return result, nil
+}
+
+// snapshot returns the DDL of the objects of the schema, by kind and name,
+// leaving out the tables of the migration set.
+func (ms MigrationSet) snapshot(ctx context.Context, db *sql.DB, dbMap *gorp.DbMap, dump schemaDumper) (map[string]string, error) {
+	objects, err := dump(ctx, db, dbMap.Dialect, ms.SchemaName)
+	if err != nil {
+		return nil, err
+	}
+
+	table := ms.getTableName()
+	snapshot := make(map[string]string)
+	for _, object := range objects {
+		if object.Table == table || strings.HasPrefix(object.Table, table+"_") {
+			continue
+		}
+		snapshot[object.Kind+" "+object.Name] = object.DDL
+	}
+	return snapshot, nil
+}
@@ -0,0 +1,80 @@
+package migrate
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+func (s *SqliteMigrateSuite) TestVerify(c *C) {
+	migrations := &MemoryMigrationSource{
+		Migrations: []*Migration{
+			sqliteMigrations[0],
+			&Migration{
+				Id:   "124",
+				Up:   []string{"CREATE INDEX people_id ON people (id)"},
+				Down: []string{"DROP INDEX people_id"},
+			},
+		},
+	}
+
+	ms := MigrationSet{}
+	results, err := ms.Verify(s.Db, "sqlite3", migrations)
+	c.Assert(err, IsNil)
+	c.Assert(results, HasLen, 2)
+	c.Assert(results[0].Migration, Equals, "123")
+	c.Assert(results[0].Passed(), Equals, true)
+	c.Assert(results[1].Passed(), Equals, true)
+
+	// The migrations are left applied
+	records, err := ms.GetMigrationRecords(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 2)
+	_, err = s.DbMap.Exec("SELECT * FROM people")
+	c.Assert(err, IsNil)
+}
+
+func (s *SqliteMigrateSuite) TestVerifyIrreversible(c *C) {
+	migrations := &MemoryMigrationSource{
+		Migrations: []*Migration{
+			sqliteMigrations[0],
+			sqliteMigrations[1],
+			&Migration{
+				Id:   "125",
+				Up:   []string{"CREATE TABLE pets (id int)"},
+				Down: []string{"DROP TABLE pets"},
+			},
+		},
+	}
+
+	ms := MigrationSet{}
+	results, err := ms.Verify(s.Db, "sqlite3", migrations)
+	c.Assert(err, IsNil)
+	c.Assert(results, HasLen, 2)
+	c.Assert(results[0].Passed(), Equals, true)
+
+	// The Down of 124 doesn't drop the column, so verification stops there
+	c.Assert(results[1].Migration, Equals, "124")
+	c.Assert(results[1].Passed(), Equals, false)
+	c.Assert(results[1].Object, Equals, "table people")
+	c.Assert(results[1].Expected, Equals, "CREATE TABLE people (id int)")
+	c.Assert(results[1].Actual, Equals, "CREATE TABLE people (id int, first_name text)")
+	c.Assert(results[1].Difference(), Equals, "table people differs after Down")
+}
+
+func (s *SqliteMigrateSuite) TestVerifyFailingDown(c *C) {
+	migrations := &MemoryMigrationSource{
+		Migrations: []*Migration{
+			&Migration{
+				Id:   "123",
+				Up:   []string{"CREATE TABLE people (id int)"},
+				Down: []string{"DROP TABLE persons"},
+			},
+		},
+	}
+
+	ms := MigrationSet{}
+	results, err := ms.Verify(s.Db, "sqlite3", migrations)
+	c.Assert(err, IsNil)
+	c.Assert(results, HasLen, 1)
+	c.Assert(results[0].Passed(), Equals, false)
+	c.Assert(results[0].Err, FitsTypeOf, &TxError{})
+}